@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+)
+
+// Runs the fmt command, which formats .goas files the standard way, and returns the exit code
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "Write the formatted program back to each file instead of printing it")
+	list := flags.Bool("l", false, "Only print the names of the files that are not formatted")
+	flags.Parse(args)
+
+	// Programs come from stdin when no files are given
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, err := assembler.Format(src)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		os.Stdout.Write(formatted)
+		return 0
+	}
+
+	exitCode := 0
+	for _, filePath := range flags.Args() {
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		formatted, err := assembler.Format(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filePath, err)
+			exitCode = 1
+			continue
+		}
+
+		changed := !bytes.Equal(src, formatted)
+		if *list && changed {
+			fmt.Println(filePath)
+		}
+		if *write && changed {
+			if err := os.WriteFile(filePath, formatted, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				exitCode = 1
+			}
+		}
+		if !*list && !*write {
+			os.Stdout.Write(formatted)
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/joshuaseligman/GoVM/pkg/lsp"
+)
+
+// Runs the language server for .goas files over stdin and stdout
+func main() {
+	// stdout is used for messages to the editor, so logs go to stderr
+	log.SetOutput(os.Stderr)
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/joshuaseligman/GoVM/pkg/assembler"
+	"github.com/joshuaseligman/GoVM/pkg/elf"
 	// "github.com/joshuaseligman/GoVM/internal/gui"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/clock"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/cpu"
@@ -11,15 +15,32 @@ import (
 )
 
 func main() {
-
-	assembledProgram, err := assembler.AssembleProgramFile("test.goas", 0x1000)
-	if err != nil {
-		log.Fatal(err)
+	// Subcommands come before the flags of the emulator
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFmt(os.Args[2:]))
 	}
 
+	listingFile := flag.String("listing", "", "The file to write the assembly listing to")
+	elfFile := flag.String("elf", "", "The ELF executable to run instead of test.goas")
+	defines := make(defineFlags)
+	flag.Var(defines, "D", "Defines a constant for test.goas as NAME=value, or NAME to define it as 1 (can be repeated)")
+	flag.Parse()
+
 	clk := clock.NewClock()
-	
-	mem := memory.NewFlashedMemory(assembledProgram, clk)
+
+	var mem *memory.Memory
+	if *elfFile != "" {
+		exe, err := elf.ReadFile(*elfFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mem, err = memory.NewELFMemory(exe, 0x4000, clk)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		mem = assembleTestProgram(*listingFile, defines, clk)
+	}
 		
 	cpu := cpu.NewCpu(mem, clk)
 	// guiData := gui.NewGuiData(cpu)
@@ -30,4 +51,48 @@ func main() {
 	clk.StartClock(1000)
 
 	// gui.CreateGui(guiData)
-}
\ No newline at end of file
+}
+
+// Assembles test.goas and flashes it to memory
+func assembleTestProgram(listingFile string, defines defineFlags, clk *clock.Clock) *memory.Memory {
+	progFile, err := os.Open("test.goas")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer progFile.Close()
+
+	res, err := assembler.Assemble(progFile, assembler.Options{FileName: "test.goas", MaxSize: 0x4000, Listing: listingFile != "", Defines: defines})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, diag := range res.Diagnostics {
+		log.Println(diag)
+	}
+	if listingFile != "" {
+		if err := res.Listing.WriteFile(listingFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	mem := memory.NewFlashedMemory(res.Image, clk)
+	mem.SetSourceMap(res.SourceMap)
+	return mem
+}
+
+// The constants given with -D flags by name
+type defineFlags map[string]string
+
+// Gets the defines as they would be written on the command line
+func (defines defineFlags) String() string {
+	strs := make([]string, 0, len(defines))
+	for name, value := range defines {
+		strs = append(strs, name+"="+value)
+	}
+	return strings.Join(strs, " ")
+}
+
+// Adds a define written as NAME=value or NAME
+func (defines defineFlags) Set(str string) error {
+	name, value, _ := strings.Cut(str, "=")
+	defines[name] = value
+	return nil
+}
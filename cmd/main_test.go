@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+)
+
+func TestDefineFlags(t *testing.T) {
+	defines := make(defineFlags)
+	flags := flag.NewFlagSet("govm", flag.ContinueOnError)
+	flags.Var(defines, "D", "")
+	if err := flags.Parse([]string{"-D", "MODE=2", "-D", "FLAG", "-D", "SIZE=1 << 4"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := defineFlags{"MODE": "2", "FLAG": "", "SIZE": "1 << 4"}
+	if !reflect.DeepEqual(defines, want) {
+		t.Fatalf("Defines = %v, want %v", defines, want)
+	}
+
+	// The defines pick the conditional blocks and can be used as constants
+	src := ".if MODE - 2\n\t.word 1\n.else\n\t.word SIZE\n.endif\n.ifdef FLAG\n\t.word MODE\n.endif\n"
+	res, err := assembler.Assemble(strings.NewReader(src), assembler.Options{FileName: "test.goas", Defines: defines})
+	if err != nil {
+		t.Fatalf("Program did not assemble: %v", err)
+	}
+	if image := res.Image; !reflect.DeepEqual(image, []uint8{0, 0, 0, 0x10, 0, 0, 0, 2}) {
+		t.Errorf("Image = %X, want 0000001000000002", image)
+	}
+}
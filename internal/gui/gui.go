@@ -8,6 +8,7 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/cpu"
 	"github.com/joshuaseligman/GoVM/pkg/util"
 )
@@ -21,6 +22,8 @@ type GuiData struct {
 	pcData *widget.Label // The label for the value stored in the program counter
 	accLabel *widget.Label // The label for the accumulator
 	accData *widget.Label // The label for the value stored in the accumulator
+	nzcvLabel *widget.Label // The label for the condition flags
+	nzcvData *widget.Label // The label for the flags that are set
 	regLabels []*widget.Label // The labels for the registers
 	regData []*widget.Label // The labels for the values stored in the registers
 	ifidLabels []*widget.Label // The labels for the IFID register
@@ -45,32 +48,21 @@ func NewGuiData(trackedCpu *cpu.Cpu) *GuiData {
 	guiData.accLabel = widget.NewLabel("ACC")
 	guiData.accData = widget.NewLabel(util.ConvertToHexUint64(uint64(0)))
 
+	// Add the NZCV labels
+	guiData.nzcvLabel = widget.NewLabel("NZCV")
+	guiData.nzcvData = widget.NewLabel(cpu.Nzcv{}.String())
+
 	// Create the lists of labels for the registers
 	guiData.regLabels = make([]*widget.Label, 32)
 	guiData.regData = make([]*widget.Label, 32)
 
 	for i := 0; i < len(guiData.regLabels); i++ {
-		// Add the special case text for the labels
-		specialReg := ""
-		switch i {
-		case 16:
-			specialReg = " (IP0)"
-		case 17:
-			specialReg = " (IP1)"
-		case 28:
-			specialReg = " (SP)"
-		case 29:
-			specialReg = " (FP)"
-		case 30:
-			specialReg = " (LR)"
-		}
-
 		if i == 31 {
 			// XZR is not represented by an X31
 			guiData.regLabels[i] = widget.NewLabel("XZR")
 		} else {
 			// Add the label with the special text if needed
-			guiData.regLabels[i] = widget.NewLabel(fmt.Sprintf("X%d%s", i, specialReg))
+			guiData.regLabels[i] = widget.NewLabel(registerText(i))
 		}
 
 		// Initialize registers to 0
@@ -109,40 +101,26 @@ func (guiData *GuiData) Pulse() {
 
 	// Update register labels with locks
 	for i := 0; i < len(guiData.regLabels) - 1; i++ {
-		// Add the special case text for the labels
-		specialReg := ""
-		switch i {
-		case 16:
-			specialReg = " (IP0)"
-		case 17:
-			specialReg = " (IP1)"
-		case 28:
-			specialReg = " (SP)"
-		case 29:
-			specialReg = " (FP)"
-		case 30:
-			specialReg = " (LR)"
-		}
-
 		lockText := " (Lock)"
 
 		if guiData.cpu.GetRegisterLocks().Contains(uint32(i)) {
-			guiData.regLabels[i].SetText(fmt.Sprintf("X%d%s%s", i, specialReg, lockText))
+			guiData.regLabels[i].SetText(registerText(i) + lockText)
 		} else {
-			guiData.regLabels[i].SetText(fmt.Sprintf("X%d%s", i, specialReg))
+			guiData.regLabels[i].SetText(registerText(i))
 		}
 	}
 
 	// Update the register values
 	guiData.curTime.SetText(fmt.Sprintf("%d", util.GetCurrentTime()))
-	guiData.pcData.SetText(util.ConvertToHexUint32(uint32(guiData.cpu.GetProgramCounter())))
+	guiData.pcData.SetText(util.ConvertToHexUint32(uint32(guiData.cpu.GetProgramCounter())) + guiData.sourceText(guiData.cpu.GetProgramCounter()))
+	guiData.nzcvData.SetText(guiData.cpu.GetNzcv().String())
 	for i := 0; i < len (guiData.regData); i++ {
 		guiData.regData[i].SetText(util.ConvertToHexUint64(guiData.cpu.GetRegisters()[i]))
 	}
 
 	// Update the IFID values
 	if guiData.cpu.GetIDEXReg() != nil {
-		guiData.ifidLabels[0].SetText(fmt.Sprintf("Instruction: %s", util.ConvertToHexUint32(guiData.cpu.GetIFIDReg().GetInstruction())))
+		guiData.ifidLabels[0].SetText(fmt.Sprintf("Instruction: %s (%s)%s", util.ConvertToHexUint32(guiData.cpu.GetIFIDReg().GetInstruction()), disassembler.Disassemble(guiData.cpu.GetIFIDReg().GetInstruction()), guiData.sourceText(guiData.cpu.GetIFIDReg().GetIncrementedPC() - 4)))
 		guiData.ifidLabels[1].SetText(fmt.Sprintf("Incremented PC: %s", util.ConvertToHexUint32(uint32(guiData.cpu.GetIFIDReg().GetIncrementedPC()))))
 	} else {
 		guiData.ifidLabels[0].SetText(fmt.Sprintf("Instruction: %s", util.ConvertToHexUint32(0)))
@@ -151,7 +129,7 @@ func (guiData *GuiData) Pulse() {
 
 	// Update the IDEX values
 	if guiData.cpu.GetIDEXReg() != nil {
-		guiData.idexLabels[0].SetText(fmt.Sprintf("Instruction: %s", util.ConvertToHexUint32(guiData.cpu.GetIDEXReg().GetInstruction())))
+		guiData.idexLabels[0].SetText(fmt.Sprintf("Instruction: %s (%s)%s", util.ConvertToHexUint32(guiData.cpu.GetIDEXReg().GetInstruction()), disassembler.Disassemble(guiData.cpu.GetIDEXReg().GetInstruction()), guiData.sourceText(guiData.cpu.GetIDEXReg().GetIncrementedPC() - 4)))
 		guiData.idexLabels[1].SetText(fmt.Sprintf("Incremented PC: %s", util.ConvertToHexUint32(uint32(guiData.cpu.GetIDEXReg().GetIncrementedPC()))))
 		guiData.idexLabels[2].SetText(fmt.Sprintf("Reg Read Data 1 PC: %s", util.ConvertToHexUint64(guiData.cpu.GetIDEXReg().GetRegReadData1())))
 		guiData.idexLabels[3].SetText(fmt.Sprintf("Reg Read Data 2 PC: %s", util.ConvertToHexUint64(guiData.cpu.GetIDEXReg().GetRegReadData2())))
@@ -166,7 +144,7 @@ func (guiData *GuiData) Pulse() {
 
 	// Update the EXMEM values
 	if guiData.cpu.GetEXMEMReg() != nil {
-		guiData.exmemLablels[0].SetText(fmt.Sprintf("Instruction: %s", util.ConvertToHexUint32(guiData.cpu.GetEXMEMReg().GetInstruction())))
+		guiData.exmemLablels[0].SetText(fmt.Sprintf("Instruction: %s (%s)%s", util.ConvertToHexUint32(guiData.cpu.GetEXMEMReg().GetInstruction()), disassembler.Disassemble(guiData.cpu.GetEXMEMReg().GetInstruction()), guiData.sourceText(guiData.cpu.GetEXMEMReg().GetIncrementedPC() - 4)))
 		guiData.exmemLablels[1].SetText(fmt.Sprintf("Write value: %s", util.ConvertToHexUint64(guiData.cpu.GetEXMEMReg().GetWriteVal())))
 		guiData.exmemLablels[2].SetText(fmt.Sprintf("Working Address: %s", util.ConvertToHexUint64(guiData.cpu.GetEXMEMReg().GetWorkingAddr())))
 	} else {
@@ -177,7 +155,7 @@ func (guiData *GuiData) Pulse() {
 
 	// Update the MEMWB values
 	if guiData.cpu.GetMEMWBReg() != nil {
-		guiData.memwbLabels[0].SetText(fmt.Sprintf("Instruction: %s", util.ConvertToHexUint32(guiData.cpu.GetMEMWBReg().GetInstruction())))
+		guiData.memwbLabels[0].SetText(fmt.Sprintf("Instruction: %s (%s)%s", util.ConvertToHexUint32(guiData.cpu.GetMEMWBReg().GetInstruction()), disassembler.Disassemble(guiData.cpu.GetMEMWBReg().GetInstruction()), guiData.sourceText(guiData.cpu.GetMEMWBReg().GetIncrementedPC() - 4)))
 		guiData.memwbLabels[1].SetText(fmt.Sprintf("Write value: %s", util.ConvertToHexUint64(guiData.cpu.GetMEMWBReg().GetWriteVal())))
 	} else {
 		guiData.memwbLabels[0].SetText(fmt.Sprintf("Instruction: %s", util.ConvertToHexUint32(0)))
@@ -185,6 +163,22 @@ func (guiData *GuiData) Pulse() {
 	}
 }
 
+// Gets the source location of the instruction at the address to show after its value, or "" if the source is not known
+func (guiData *GuiData) sourceText(addr uint64) string {
+	if location := guiData.cpu.GetSourceLocation(addr); location != "" {
+		return fmt.Sprintf(" at %s", location)
+	}
+	return ""
+}
+
+// Gets the name of a register with its alias, such as X28 (SP), in the same way the disassembler names it
+func registerText(reg int) string {
+	if alias, exists := disassembler.RegisterAliases[uint32(reg)]; exists {
+		return fmt.Sprintf("X%d (%s)", reg, alias)
+	}
+	return fmt.Sprintf("X%d", reg)
+}
+
 // Function that initializes and starts the gui
 func CreateGui(guiData *GuiData) {
 	// Create the app and window
@@ -203,6 +197,9 @@ func CreateGui(guiData *GuiData) {
 	grid.Add(guiData.accLabel)
 	grid.Add(guiData.accData)
 
+	grid.Add(guiData.nzcvLabel)
+	grid.Add(guiData.nzcvData)
+
 	for i := 0; i < len(guiData.regLabels); i++ {
 		grid.Add(guiData.regLabels[i])
 		grid.Add(guiData.regData[i])
@@ -1,17 +1,184 @@
 package assembler
 
 import (
-	"bufio"
-	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
-	"math"
-	"errors"
+
+	"github.com/joshuaseligman/GoVM/pkg/sourcemap"
 )
 
-// Assembles a program into instructions for the computer to read
-func AssembleProgramFile(filePath string, maxSize int) ([]uint32, error) {
+// The largest program in bytes that can be assembled when no size is given
+const defaultMaxSize = 0x100000
+
+// Options for assembling a program
+type Options struct {
+	FileName     string            // The name of the file used in error messages and to find included files
+	MaxSize      int               // The size of the memory image in bytes, or 0 to make the image just big enough for the program
+	IncludePaths []string          // The directories to search for included files after the directory of the file that includes them
+	NoIncludes   bool              // If .include is not allowed, such as for programs that do not come from a file
+	Listing      bool              // If the result should include a listing of the program
+	Relocatable  bool              // If the program should be assembled into an object for the linker instead of an image
+	Defines      map[string]string // Constants that conditions and the rest of the program can use, like -D NAME=value, where an empty value means 1
+}
+
+// The opcodes of all of the instructions the assembler understands
+var instructionOpcodes = []string{
+	"MOVZ", "MOVK",
+	"ADD", "ADDS", "SUB", "SUBS",
+	"MUL", "SMULH", "UMULH", "SDIV", "UDIV",
+	"ADDI", "ADDIS", "SUBI", "SUBIS",
+	"AND", "ANDS", "ORR", "EOR",
+	"ANDI", "ANDIS", "ORRI", "EORI",
+	"LSL", "LSR",
+	"LDUR", "LDURB", "LDURH", "LDURSW", "STUR", "STURB", "STURH", "STURW",
+	"B", "BL", "BR", "CBZ", "CBNZ",
+	"B.EQ", "B.NE", "B.HS", "B.LO", "B.MI", "B.PL", "B.VS", "B.VC",
+	"B.HI", "B.LS", "B.GE", "B.LT", "B.GT", "B.LE",
+	"DATA", "HLT",
+}
+
+// The condition codes that go in the Rt field of each B.cond instruction
+var conditionCodes = map[string]uint32{
+	"B.EQ": 0x0, // Equal: Z
+	"B.NE": 0x1, // Not equal: !Z
+	"B.HS": 0x2, // Unsigned higher or same: C
+	"B.LO": 0x3, // Unsigned lower: !C
+	"B.MI": 0x4, // Negative: N
+	"B.PL": 0x5, // Positive or zero: !N
+	"B.VS": 0x6, // Overflow: V
+	"B.VC": 0x7, // No overflow: !V
+	"B.HI": 0x8, // Unsigned higher: C && !Z
+	"B.LS": 0x9, // Unsigned lower or same: !C || Z
+	"B.GE": 0xA, // Signed greater than or equal: N == V
+	"B.LT": 0xB, // Signed less than: N != V
+	"B.GT": 0xC, // Signed greater than: !Z && N == V
+	"B.LE": 0xD, // Signed less than or equal: Z || N != V
+}
+
+// The values of the shift amount field of the R instructions that use it as part of the opcode
+var shamtOpcodes = map[string]uint32{
+	"MUL":   0b011111,
+	"SMULH": 0b011111,
+	"UMULH": 0b011111,
+	"UDIV":  0b000010,
+	"SDIV":  0b000011,
+}
+
+// Determines if an opcode is a real instruction
+func isInstruction(opcode string) bool {
+	for _, instr := range instructionOpcodes {
+		if opcode == instr {
+			return true
+		}
+	}
+	return false
+}
+
+// Struct for a named value in the program
+type Symbol struct {
+	Value   uint64 `json:"value"`   // The address of a label or the value of a constant
+	IsLabel bool   `json:"isLabel"` // If the symbol is a label rather than a constant
+	Line    int    `json:"line"`    // The line the symbol was defined on
+	File    string `json:"file"`    // The file the symbol was defined in
+	Section string `json:"section"` // The section a label is in, or "" for constants
+}
+
+// Struct for where a numeric label or scoped label is written, and the symbol it refers to there
+type Reference struct {
+	Name   string `json:"name"`   // The name as it is written, such as 1b or .Lloop
+	Symbol string `json:"symbol"` // The name of the symbol in Result.Symbols that the name refers to
+	Line   int    `json:"line"`   // The line the name is on
+	Column int    `json:"column"` // The column the name starts in, after any # before it
+	File   string `json:"file"`   // The file the name is in
+}
+
+// Struct for the output of the assembler
+type Result struct {
+	Image       []uint8             `json:"image"`       // The memory image of the program, or nil if there were errors or the program is relocatable
+	Object      *Object             `json:"object"`      // The relocatable object if Options.Relocatable is set, or nil if there were errors
+	Symbols     map[string]Symbol   `json:"symbols"`     // The labels and constants in the program
+	References  []Reference         `json:"references"`  // Where each numeric label and scoped label outside of macros is defined or used
+	SourceMap   sourcemap.SourceMap `json:"sourceMap"`   // The lines that placed each part of the image
+	Listing     *Listing            `json:"listing"`     // The listing of the program if Options.Listing is set, or nil if there were errors
+	Diagnostics Diagnostics         `json:"diagnostics"` // The errors and warnings found in the program
+}
+
+// Assembles a program read from r into a memory image, returning the errors as Diagnostics if there are any
+func Assemble(r io.Reader, opts Options) (*Result, error) {
+	res := &Result{Diagnostics: make(Diagnostics, 0)}
+
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return res, err
+	}
+
+	// Split the program into statements, bringing in included files, expanding macros, and leaving out what conditions exclude
+	defines, diags := evalDefines(opts)
+	res.Diagnostics = append(res.Diagnostics, diags...)
+	lines, diags := tokenize(string(src), opts.FileName)
+	res.Diagnostics = append(res.Diagnostics, diags...)
+	lines, diags = preprocess(lines, opts, defines)
+	res.Diagnostics = append(res.Diagnostics, diags...)
+	lines, res.References = resolveLocalLabels(lines)
+	statements, diags := parseStatements(lines)
+	res.Diagnostics = append(res.Diagnostics, diags...)
+
+	// First pass: find the address of every statement and label
+	statements, symbols, sections, diags := layoutProgram(statements, defines, opts.Relocatable)
+	res.Diagnostics = append(res.Diagnostics, diags...)
+	res.Symbols = symbols
+
+	if opts.Relocatable {
+		return assembleObject(res, lines, statements, sections, opts)
+	}
+
+	programSize := sections[0].size
+	maxSize := maxProgramSize(opts)
+	if programSize > maxSize {
+		res.Diagnostics = append(res.Diagnostics, newError(CodeProgramSize, opts.FileName, 0, 0, "Program is too large: Program needs %d bytes but the limit is %d bytes", programSize, maxSize))
+		return res, res.Diagnostics.Errors()
+	}
+
+	// Create the array that will become the memory
+	imageSize := programSize
+	if opts.MaxSize > 0 {
+		imageSize = maxSize
+	}
+	image := make([]uint8, imageSize)
+
+	// Second pass: assemble the program statement by statement
+	sourceMap := make(sourcemap.SourceMap, 0)
+	for _, stmt := range statements {
+		if diag := emitStatement(image, stmt, symbols, stmt.fileName); diag != nil {
+			res.Diagnostics = append(res.Diagnostics, diag)
+		}
+
+		// Record which line placed the data at the address
+		if stmt.size > 0 {
+			sourceMap = append(sourceMap, sourcemap.Entry{Addr: stmt.addr, Size: stmt.size, File: stmt.fileName, Line: stmt.lineNumber, Column: stmt.opcodeColumn})
+		}
+	}
+	res.SourceMap = sourceMap
+
+	// Look for likely mistakes in programs that are otherwise valid
+	res.Diagnostics = append(res.Diagnostics, findWarnings(statements)...)
+	res.Diagnostics = sortDiagnostics(res.Diagnostics)
+
+	if res.Diagnostics.HasErrors() {
+		return res, res.Diagnostics.Errors()
+	}
+	res.Image = image
+	if opts.Listing {
+		res.Listing = newListing(lines, statements, symbols, map[string][]uint8{textSection: image})
+	}
+	return res, nil
+}
+
+// Assembles a program into a memory image of maxSize bytes for the computer to read
+func AssembleProgramFile(filePath string, maxSize int) ([]uint8, error) {
 	// Open the file
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -19,166 +186,239 @@ func AssembleProgramFile(filePath string, maxSize int) ([]uint32, error) {
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
+	res, err := Assemble(f, Options{FileName: filePath, MaxSize: maxSize})
+	if err != nil {
+		return nil, err
+	}
+	return res.Image, nil
+}
 
-	// Create the array that will become the memory
-	program := make([]uint32, maxSize)
-	instrIndex := 0
-
-	// Read the file line by line
-	for scanner.Scan() {
-		instr := scanner.Text()
-
-		// Get the end of the opcode
-		opcodeSplit := strings.Index(instr, " ")
-
-		// Define the variables for the opcode and operands
-		var opcode string
-		var operands []string
-
-		if opcodeSplit == -1 && instr != "HLT" {
-			errMsg := fmt.Sprint("Invalid instruction ", instr)
-			return nil, errors.New(errMsg)
-		} else if opcodeSplit != -1 && instr != "HLT" {
-			// Get the opcode
-			opcode = instr[:opcodeSplit]
-
-			// Get a list of operands
-			operands = strings.Split(instr[opcodeSplit + 1:], ", ")
-		} else if instr == "HLT" {
-			opcode = "HLT"
-		}
+// Assembles a program into a memory image for the computer to read
+func AssembleProgramAPI(progStr string) ([]uint8, error) {
+	res, err := Assemble(strings.NewReader(progStr), Options{FileName: "Web form", NoIncludes: true})
+	if err != nil {
+		return nil, err
+	}
+	return res.Image, nil
+}
 
-		instrBin := uint32(0)
-		var err error
-
-		switch opcode {
-		// IM instructions
-		case "MOVZ", "MOVK":
-			instrBin, err = instrIM(opcode, operands, filePath, instrIndex + 1)
-		// R instructions
-		case "ADD", "ADDS", "SUB", "SUBS":
-			instrBin, err = instrR(opcode, operands, filePath, instrIndex + 1)
-		// I instructions
-		case "ADDI", "ADDIS", "SUBI", "SUBIS":
-			instrBin, err = instrI(opcode, operands, filePath, instrIndex + 1)
-		// D instructions
-		case "LDUR", "LDURB", "LDURH", "LDURSW", "STUR", "STURB", "STURH", "STURW":
-			instrBin, err = instrD(opcode, operands, filePath, instrIndex + 1)
-		// B instructions
-		case "B":
-			instrBin, err = instrB(opcode, operands, filePath, instrIndex + 1)
-		// CB instructions
-		case "CBZ", "CBNZ":
-			instrBin, err = instrCB(opcode, operands, filePath, instrIndex + 1)
-		// Constant data
-		case "DATA":
-			instrBin, err = instrData(operands, filePath, instrIndex + 1)
-		// Halt
-		case "HLT":
-			instrBin = 0
-		default:
-			errMsg := fmt.Sprintf("Invalid opcode; File: %s; Line: %d", filePath, instrIndex + 1)
-			err = errors.New(errMsg)
+// Assigns an address to every statement, expands pseudo-instructions, records the symbols, and returns the sections in the order they first appear
+func layoutProgram(statements []statement, defines map[string]Symbol, relocatable bool) ([]statement, map[string]Symbol, []*section, Diagnostics) {
+	symbols := make(map[string]Symbol)
+	for name, sym := range defines {
+		symbols[name] = sym
+	}
+	diags := make(Diagnostics, 0)
+	laidOut := make([]statement, 0, len(statements))
+	pending := make([]statement, 0)
+
+	// Each section has its own addresses, starting with the text section
+	sections := []*section{newSection(textSection)}
+	current := sections[0]
+	addr := uint64(0)
+
+	for _, stmt := range statements {
+		// Switching sections picks up where the section left off
+		if isSectionDirective(stmt.opcode) {
+			name, diag := getSectionName(stmt, stmt.fileName)
+			if diag == nil && !relocatable && name != textSection {
+				diag = newError(CodeSection, stmt.fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid section: Only the %s section can be used in programs that are not relocatable", textSection).suggest("Assemble the program with Options.Relocatable set and link it")
+			}
+			if diag != nil {
+				diags = append(diags, diag)
+			} else {
+				current.addr = addr
+				current = findSection(&sections, name)
+				addr = current.addr
+			}
 		}
 
-		if err != nil {
-			return nil, err
+		// Pseudo-instructions are laid out as the instructions they stand for
+		if isPseudoInstruction(stmt.opcode) {
+			expanded, diag := expandPseudo(stmt, symbols, relocatable, stmt.fileName)
+			if diag != nil {
+				diags = append(diags, diag)
+				// Keep the label so it does not cause more errors later on
+				expanded = []statement{{label: stmt.label, labelColumn: stmt.labelColumn, lineNumber: stmt.lineNumber, fileName: stmt.fileName, lineIndex: stmt.lineIndex}}
+			}
+			for _, expandedStmt := range expanded {
+				expandedStmt.section = current.name
+				addr = layoutStatement(&expandedStmt, addr, symbols, &pending, &diags)
+				laidOut = append(laidOut, expandedStmt)
+			}
+		} else {
+			stmt.section = current.name
+			addr = layoutStatement(&stmt, addr, symbols, &pending, &diags)
+			laidOut = append(laidOut, stmt)
 		}
 
-		// Add the instruction to the program
-		program[instrIndex] = instrBin
-		instrIndex++
+		if addr > current.size {
+			current.size = addr
+		}
+		// The section has to be placed at an address that keeps everything in it aligned
+		if stmt.opcode == ".ALIGN" && len(stmt.operands) == 1 {
+			if power, diag := getDirectiveValue(stmt.operands[0], 4, unsignedValue, "alignment", symbols, stmt.fileName, stmt.lineNumber); diag == nil && uint64(1)<<power > current.align {
+				current.align = uint64(1) << power
+			}
+		}
 	}
-	
-	return program, nil
+
+	// Constants that use labels defined later can be worked out now that every label has an address
+	diags = append(diags, resolveConstants(pending, symbols)...)
+
+	return laidOut, symbols, sections, diags
 }
 
-// Assembles a program into instructions for the computer to read
-func AssembleProgramAPI(progStr string) ([]uint32, error) {
-	// Create the array that will become the memory
-	program := make([]uint32, 0)
-	filePath := "Web form"
-
-	// Read the file line by line
-	for instrIndex, instr := range strings.Split(progStr, "\n") {
-
-		// Get the end of the opcode
-		opcodeSplit := strings.Index(instr, " ")
-
-		// Define the variables for the opcode and operands
-		var opcode string
-		var operands []string
-
-		if opcodeSplit == -1 && instr != "HLT" {
-			errMsg := fmt.Sprintf("Invalid instruction: %s; File: %s; Line: %d", instr, filePath, instrIndex + 1)
-			return nil, errors.New(errMsg)
-		} else if opcodeSplit != -1 && instr != "HLT" {
-			// Get the opcode
-			opcode = instr[:opcodeSplit]
-
-			// Get a list of operands
-			operands = strings.Split(instr[opcodeSplit + 1:], ", ")
-		} else if instr == "HLT" {
-			opcode = "HLT"
+// Assigns an address to a single statement and returns the address of the next statement, adding constants that cannot be worked out yet to pending
+func layoutStatement(stmt *statement, addr uint64, symbols map[string]Symbol, pending *[]statement, diags *Diagnostics) uint64 {
+	fileName := stmt.fileName
+
+	// Find where the statement starts and where the next statement starts
+	start, end := addr, addr
+	if isDirective(stmt.opcode) {
+		var diag *Diagnostic
+		start, end, diag = layoutDirective(*stmt, addr, symbols, fileName)
+		if diag != nil {
+			if stmt.opcode == ".EQU" && diag.Code == CodeUndefinedSymbol {
+				*pending = append(*pending, *stmt)
+			} else {
+				*diags = append(*diags, diag)
+			}
+			start, end = addr, addr
+		}
+	} else if stmt.opcode != "" {
+		// Instructions are always a full word and must be aligned for the fetch unit
+		if addr%4 != 0 {
+			*diags = append(*diags, newError(CodeAlignment, fileName, stmt.lineNumber, stmt.opcodeColumn, "Instruction is not word aligned: Address 0x%X is not a multiple of 4", addr).suggest("Add .align 2 before the instruction"))
 		}
+		end = addr + 4
+	}
 
-		instrBin := uint32(0)
-		var err error
-
-		switch opcode {
-		// IM instructions
-		case "MOVZ", "MOVK":
-			instrBin, err = instrIM(opcode, operands, filePath, instrIndex + 1)
-		// R instructions
-		case "ADD", "ADDS", "SUB", "SUBS":
-			instrBin, err = instrR(opcode, operands, filePath, instrIndex + 1)
-		// I instructions
-		case "ADDI", "ADDIS", "SUBI", "SUBIS":
-			instrBin, err = instrI(opcode, operands, filePath, instrIndex + 1)
-		// D instructions
-		case "LDUR", "LDURB", "LDURH", "LDURSW", "STUR", "STURB", "STURH", "STURW":
-			instrBin, err = instrD(opcode, operands, filePath, instrIndex + 1)
-		// B instructions
-		case "B":
-			instrBin, err = instrB(opcode, operands, filePath, instrIndex + 1)
-		// CB instructions
-		case "CBZ", "CBNZ":
-			instrBin, err = instrCB(opcode, operands, filePath, instrIndex + 1)
-		// Constant data
-		case "DATA":
-			instrBin, err = instrData(operands, filePath, instrIndex + 1)
-		// Halt
-		case "HLT":
-			instrBin = 0
-		default:
-			errMsg := fmt.Sprintf("Invalid opcode; File: %s; Line: %d", filePath, instrIndex + 1)
-			err = errors.New(errMsg)
+	// Labels point to where the statement places its data
+	if stmt.label != "" {
+		if diag := defineSymbol(symbols, stmt.label, start, stmt.section, stmt.lineNumber, stmt.labelColumn, fileName); diag != nil {
+			*diags = append(*diags, diag)
 		}
+	}
+
+	stmt.addr = start
+	stmt.size = end - start
+	return end
+}
+
+// Adds a symbol to the symbol table if it has not been defined yet, where labels are given their section and constants have none
+func defineSymbol(symbols map[string]Symbol, name string, value uint64, section string, lineNumber int, column int, fileName string) *Diagnostic {
+	// Make sure the symbol has not been used yet
+	if existing, exists := symbols[name]; exists && existing.Line == 0 {
+		return newError(CodeDuplicateSymbol, fileName, lineNumber, column, "Duplicate symbol: %s is already defined with -D", name).suggest("Rename %s or remove the define", name)
+	} else if exists {
+		return newError(CodeDuplicateSymbol, fileName, lineNumber, column, "Duplicate symbol: %s was already defined on line %d", name, existing.Line).suggest("Rename one of the definitions of %s", name)
+	}
+
+	symbols[name] = Symbol{Value: value, IsLabel: section != "", Line: lineNumber, File: fileName, Section: section}
+	return nil
+}
+
+// Gets the most bytes a program can need, which is the size of the memory image if one is given
+func maxProgramSize(opts Options) uint64 {
+	if opts.MaxSize <= 0 {
+		return defaultMaxSize
+	}
+	return uint64(opts.MaxSize)
+}
 
-		if err != nil {
-			return nil, err
+// Writes the binary for a statement into the program at the address of the statement
+func emitStatement(program []uint8, stmt statement, symbols map[string]Symbol, fileName string) *Diagnostic {
+	switch {
+	// Label-only lines have already been recorded
+	case stmt.opcode == "":
+		return nil
+	case isDirective(stmt.opcode):
+		return emitDirective(program, stmt, symbols, fileName)
+	default:
+		instrBin, diag := assembleInstruction(stmt, symbols, fileName)
+		if diag != nil {
+			return diag
 		}
+		putValue(program, stmt.addr, uint64(instrBin), 4)
+		return nil
+	}
+}
+
+// Writes a value into the program in big-endian order
+func putValue(program []uint8, addr uint64, val uint64, size int) {
+	for i := 0; i < size; i++ {
+		program[addr+uint64(i)] = uint8(val >> (8 * (size - 1 - i)))
+	}
+}
+
+// Generates the binary for a single instruction
+func assembleInstruction(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
+	switch stmt.opcode {
+	// IM instructions
+	case "MOVZ", "MOVK":
+		return instrIM(stmt, symbols, fileName)
+	// R instructions
+	case "ADD", "ADDS", "SUB", "SUBS", "MUL", "SMULH", "UMULH", "SDIV", "UDIV", "AND", "ANDS", "ORR", "EOR", "LSL", "LSR", "BR":
+		return instrR(stmt, symbols, fileName)
+	// I instructions
+	case "ADDI", "ADDIS", "SUBI", "SUBIS", "ANDI", "ANDIS", "ORRI", "EORI":
+		return instrI(stmt, symbols, fileName)
+	// D instructions
+	case "LDUR", "LDURB", "LDURH", "LDURSW", "STUR", "STURB", "STURH", "STURW":
+		return instrD(stmt, symbols, fileName)
+	// B instructions
+	case "B", "BL":
+		return instrB(stmt, symbols, fileName)
+	// CB instructions
+	case "CBZ", "CBNZ":
+		return instrCB(stmt, symbols, fileName)
+	case "B.EQ", "B.NE", "B.HS", "B.LO", "B.MI", "B.PL", "B.VS", "B.VC",
+		"B.HI", "B.LS", "B.GE", "B.LT", "B.GT", "B.LE":
+		return instrBCond(stmt, symbols, fileName)
+	// Constant data
+	case "DATA":
+		return instrData(stmt, symbols, fileName)
+	// Halt
+	case "HLT":
+		if err := checkOperandCount(stmt, 0, fileName); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	default:
+		diag := newError(CodeBadOpcode, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid opcode: %s", stmt.opcode)
+		if match := closestMatch(stmt.opcode, append(instructionOpcodes, pseudoOpcodes...)); match != "" {
+			diag.suggest("Did you mean %s?", match)
+		} else if strings.HasPrefix(stmt.opcode, "B.") {
+			diag.suggest("The conditions of B.cond are EQ, NE, HS, LO, MI, PL, VS, VC, HI, LS, GE, LT, GT, and LE")
+		}
+		return 0, diag
+	}
+}
 
-		// Add the instruction to the program
-		program = append(program, instrBin)
+// Makes sure the statement has the expected number of operands
+func checkOperandCount(stmt statement, expected int, fileName string) *Diagnostic {
+	if len(stmt.operands) == expected {
+		return nil
+	}
+	plural := "s"
+	if expected == 1 {
+		plural = ""
 	}
-	
-	return program, nil
+	return newError(CodeOperandCount, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid instruction format: Expected %d operand%s but got %d", expected, plural, len(stmt.operands))
 }
 
 // Generates the binary for IM instructions
-func instrIM(opcode string, operands []string, fileName string, lineNumber int) (uint32, error) {
+func instrIM(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
 	// Make sure we have the right number of operands
-	if len(operands) != 3 {
-		errMsg := fmt.Sprintf("Invalid instruction format: Expected 3 operands but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-		return 0, errors.New(errMsg)
+	if err := checkOperandCount(stmt, 3, fileName); err != nil {
+		return 0, err
 	}
 
 	outBin := uint32(0)
 
 	// Generate initial binary
-	switch opcode {
+	switch stmt.opcode {
 	case "MOVZ":
 		outBin = 0b110100101
 	case "MOVK":
@@ -186,29 +426,33 @@ func instrIM(opcode string, operands []string, fileName string, lineNumber int)
 	}
 
 	// Get the shift amount
-	shiftStr := strings.Split(operands[2], " ")[1]
-	shiftInt, errConv := strconv.ParseInt(shiftStr, 10, 0)
-	if errConv == nil {
+	shiftAmt, err := getShift(stmt.operands[2], fileName, stmt.lineNumber)
+	if err == nil {
 		// Add the shift to the binary
-		outBin  = outBin << 2 | uint32(shiftInt / 16)
+		outBin = outBin<<2 | uint32(shiftAmt/16)
 	} else {
-		// Bad shift value error
-		errMsg := fmt.Sprintf("Bad shift value; File: %s; Line: %d", fileName, lineNumber)
-		return 0, errors.New(errMsg)
+		return 0, err
 	}
 
 	// Get the value to move into the register
-	val, err := getValue(operands[1], 16, "move immediate", fileName, lineNumber)
+	var val uint64
+	if stmt.wideImm {
+		// Pick out the 16 bits of the full constant that the shift points to
+		val, err = getValue(stmt.operands[1], 64, anyValue, "move immediate", symbols, fileName, stmt.lineNumber)
+		val = val >> shiftAmt & 0xFFFF
+	} else {
+		val, err = getValue(stmt.operands[1], 16, unsignedValue, "move immediate", symbols, fileName, stmt.lineNumber)
+	}
 	if err == nil {
-		outBin = outBin << 16 | uint32(val)
+		outBin = outBin<<16 | uint32(val)
 	} else {
 		return 0, err
 	}
 
 	// Get the register to move the value to
-	destReg, err := getRegister(operands[0], fileName, lineNumber)
+	destReg, err := getRegister(stmt.operands[0], fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 5 | uint32(destReg)
+		outBin = outBin<<5 | uint32(destReg)
 	} else {
 		return 0, err
 	}
@@ -218,20 +462,23 @@ func instrIM(opcode string, operands []string, fileName string, lineNumber int)
 }
 
 // Generates the binary for R instructions
-func instrR(opcode string, operands []string, fileName string, lineNumber int) (uint32, error) {
+func instrR(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
 	// Make sure we have the right number of operands
-	switch opcode {
-	case "ADD", "ADDS", "SUB", "SUBS":
-		if len(operands) != 3 {
-			errMsg := fmt.Sprintf("Invalid instruction format: Expected 3 operands but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-			return 0, errors.New(errMsg)
+	switch stmt.opcode {
+	case "ADD", "ADDS", "SUB", "SUBS", "MUL", "SMULH", "UMULH", "SDIV", "UDIV", "AND", "ANDS", "ORR", "EOR", "LSL", "LSR":
+		if err := checkOperandCount(stmt, 3, fileName); err != nil {
+			return 0, err
+		}
+	case "BR":
+		if err := checkOperandCount(stmt, 1, fileName); err != nil {
+			return 0, err
 		}
 	}
 
 	outBin := uint32(0)
 
 	// Generate initial binary
-	switch opcode {
+	switch stmt.opcode {
 	case "ADD":
 		outBin = 0b10001011000
 	case "ADDS":
@@ -240,37 +487,102 @@ func instrR(opcode string, operands []string, fileName string, lineNumber int) (
 		outBin = 0b11001011000
 	case "SUBS":
 		outBin = 0b11101011000
+	case "MUL":
+		outBin = 0b10011011000
+	case "SMULH":
+		outBin = 0b10011011010
+	case "UMULH":
+		outBin = 0b10011011110
+	case "SDIV", "UDIV":
+		outBin = 0b10011010110
+	case "AND":
+		outBin = 0b10001010000
+	case "ANDS":
+		outBin = 0b11101010000
+	case "ORR":
+		outBin = 0b10101010000
+	case "EOR":
+		outBin = 0b11001010000
+	case "LSL":
+		outBin = 0b11010011011
+	case "LSR":
+		outBin = 0b11010011010
+	case "BR":
+		outBin = 0b11010110000
 	}
 
 	// Generate the remaining binary based on the instruction
-	switch opcode {
-	case "ADD", "ADDS", "SUB", "SUBS":
+	switch stmt.opcode {
+	case "ADD", "ADDS", "SUB", "SUBS", "MUL", "SMULH", "UMULH", "SDIV", "UDIV", "AND", "ANDS", "ORR", "EOR":
 		// Get the first register for the operation
-		readReg1, err := getRegister(operands[1], fileName, lineNumber)
+		readReg1, err := getRegister(stmt.operands[1], fileName, stmt.lineNumber)
 		if err == nil {
-			outBin = outBin << 5 | uint32(readReg1)
+			outBin = outBin<<5 | uint32(readReg1)
 		} else {
 			return 0, err
 		}
-		
-		// Add an empty shift amount
-		outBin = outBin << 6
+
+		// Add the shift amount, which is empty except for multiplies and divides, where it is part of the opcode
+		outBin = outBin<<6 | shamtOpcodes[stmt.opcode]
 
 		// Get the second register for the operation
-		readReg2, err := getRegister(operands[2], fileName, lineNumber)
+		readReg2, err := getRegister(stmt.operands[2], fileName, stmt.lineNumber)
+		if err == nil {
+			outBin = outBin<<5 | uint32(readReg2)
+		} else {
+			return 0, err
+		}
+
+		// Get the destination register for the operation
+		destReg, err := getRegister(stmt.operands[0], fileName, stmt.lineNumber)
+		if err == nil {
+			outBin = outBin<<5 | uint32(destReg)
+		} else {
+			return 0, err
+		}
+
+	case "LSL", "LSR":
+		// Shifts do not use Rm
+		outBin = outBin << 5
+
+		// Get the amount to shift by
+		shiftAmt, err := getValue(stmt.operands[2], 6, unsignedValue, "shift amount", symbols, fileName, stmt.lineNumber)
 		if err == nil {
-			outBin = outBin << 5 | uint32(readReg2)
+			outBin = outBin<<6 | uint32(shiftAmt)
+		} else {
+			return 0, err
+		}
+
+		// Get the register to shift
+		srcReg, err := getRegister(stmt.operands[1], fileName, stmt.lineNumber)
+		if err == nil {
+			outBin = outBin<<5 | uint32(srcReg)
 		} else {
 			return 0, err
 		}
 
 		// Get the destination register for the operation
-		destReg, err := getRegister(operands[0], fileName, lineNumber)
+		destReg, err := getRegister(stmt.operands[0], fileName, stmt.lineNumber)
+		if err == nil {
+			outBin = outBin<<5 | uint32(destReg)
+		} else {
+			return 0, err
+		}
+
+	case "BR":
+		// Branches do not use Rm or the shift amount
+		outBin = outBin << 11
+
+		// Get the register with the address to branch to
+		targetReg, err := getRegister(stmt.operands[0], fileName, stmt.lineNumber)
 		if err == nil {
-			outBin = outBin << 5 | uint32(destReg)
+			outBin = outBin<<5 | uint32(targetReg)
 		} else {
 			return 0, err
 		}
+
+		// Branches do not write to Rd
+		outBin = outBin << 5
 	}
 
 	// Return the instruction binary
@@ -278,20 +590,19 @@ func instrR(opcode string, operands []string, fileName string, lineNumber int) (
 }
 
 // Generates the binary for I instructions
-func instrI(opcode string, operands []string, fileName string, lineNumber int) (uint32, error) {
+func instrI(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
 	// Make sure we have the right number of operands
-	switch opcode {
-	case "ADDI", "ADDIS", "SUBI":
-		if len(operands) != 3 {
-			errMsg := fmt.Sprintf("Invalid instruction format: Expected 3 operands but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-			return 0, errors.New(errMsg)
+	switch stmt.opcode {
+	case "ADDI", "ADDIS", "SUBI", "SUBIS", "ANDI", "ANDIS", "ORRI", "EORI":
+		if err := checkOperandCount(stmt, 3, fileName); err != nil {
+			return 0, err
 		}
 	}
 
 	outBin := uint32(0)
 
 	// Generate initial binary
-	switch opcode {
+	switch stmt.opcode {
 	case "ADDI":
 		outBin = 0b1001000100
 	case "ADDIS":
@@ -300,31 +611,39 @@ func instrI(opcode string, operands []string, fileName string, lineNumber int) (
 		outBin = 0b1101000100
 	case "SUBIS":
 		outBin = 0b1111000100
+	case "ANDI":
+		outBin = 0b1001001000
+	case "ANDIS":
+		outBin = 0b1111001000
+	case "ORRI":
+		outBin = 0b1011001000
+	case "EORI":
+		outBin = 0b1101001000
 	}
 
 	// Generate the remaining binary based on the instruction
-	switch opcode {
-	case "ADDI", "ADDIS", "SUBI", "SUBIS":
-		// Get the immediate value for adding
-		val, err := getValue(operands[2], 12, "ALU immediate", fileName, lineNumber)
+	switch stmt.opcode {
+	case "ADDI", "ADDIS", "SUBI", "SUBIS", "ANDI", "ANDIS", "ORRI", "EORI":
+		// Get the immediate value for the operation
+		val, err := getValue(stmt.operands[2], 12, unsignedValue, "ALU immediate", symbols, fileName, stmt.lineNumber)
 		if err == nil {
-			outBin = outBin << 12 | uint32(val)
+			outBin = outBin<<12 | uint32(val)
 		} else {
 			return 0, err
 		}
 
 		// Get the register for the operation
-		srcReg, err := getRegister(operands[1], fileName, lineNumber)
+		srcReg, err := getRegister(stmt.operands[1], fileName, stmt.lineNumber)
 		if err == nil {
-			outBin = outBin << 5 | uint32(srcReg)
+			outBin = outBin<<5 | uint32(srcReg)
 		} else {
 			return 0, err
 		}
 
 		// Get the destination register for the operation
-		destReg, err := getRegister(operands[0], fileName, lineNumber)
+		destReg, err := getRegister(stmt.operands[0], fileName, stmt.lineNumber)
 		if err == nil {
-			outBin = outBin << 5 | uint32(destReg)
+			outBin = outBin<<5 | uint32(destReg)
 		} else {
 			return 0, err
 		}
@@ -335,17 +654,16 @@ func instrI(opcode string, operands []string, fileName string, lineNumber int) (
 }
 
 // Generates the binary for D instructions
-func instrD(opcode string, operands []string, fileName string, lineNumber int) (uint32, error) {
+func instrD(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
 	// Make sure we have the right number of operands
-	if len(operands) != 3 {
-		errMsg := fmt.Sprintf("Invalid instruction format: Expected 3 operands but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-		return 0, errors.New(errMsg)
+	if err := checkOperandCount(stmt, 3, fileName); err != nil {
+		return 0, err
 	}
 
 	outBin := uint32(0)
 
 	// Generate initial binary
-	switch opcode {
+	switch stmt.opcode {
 	case "LDUR":
 		outBin = 0b11111000010
 	case "LDURB":
@@ -365,9 +683,9 @@ func instrD(opcode string, operands []string, fileName string, lineNumber int) (
 	}
 
 	// Get the immediate value for adding
-	val, err := getValue(operands[2], 9, "destination address", fileName, lineNumber)
+	val, err := getValue(stmt.operands[2], 9, signedValue, "destination address", symbols, fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 9 | uint32(val)
+		outBin = outBin<<9 | uint32(val)
 	} else {
 		return 0, err
 	}
@@ -376,17 +694,22 @@ func instrD(opcode string, operands []string, fileName string, lineNumber int) (
 	outBin = outBin << 2
 
 	// Get the register for the operation
-	reg1, err := getRegister(operands[1], fileName, lineNumber)
+	reg1, err := getRegister(stmt.operands[1], fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 5 | uint32(reg1)
+		outBin = outBin<<5 | uint32(reg1)
 	} else {
 		return 0, err
 	}
 
-	// Get the destination register for the operation
-	destReg, err := getRegister(operands[0], fileName, lineNumber)
+	// Get the destination register for the operation, which can be a W register when only part of it is used
+	getDest := getRegister
+	switch stmt.opcode {
+	case "LDURB", "LDURH", "STURB", "STURH", "STURW":
+		getDest = getDataRegister
+	}
+	destReg, err := getDest(stmt.operands[0], fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 5 | uint32(destReg)
+		outBin = outBin<<5 | uint32(destReg)
 	} else {
 		return 0, err
 	}
@@ -396,25 +719,26 @@ func instrD(opcode string, operands []string, fileName string, lineNumber int) (
 }
 
 // Generates the binary for branch instructions
-func instrB(opcode string, operands []string, fileName string, lineNumber int) (uint32, error) {
+func instrB(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
 	// Make sure we only have 1 operand
-	if len(operands) != 1 {
-		errMsg := fmt.Sprintf("Invalid instruction format: Expected 1 operand but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-		return 0, errors.New(errMsg)
+	if err := checkOperandCount(stmt, 1, fileName); err != nil {
+		return 0, err
 	}
 
 	outBin := uint32(0)
 
 	// Generate initial binary
-	switch opcode {
+	switch stmt.opcode {
 	case "B":
 		outBin = 0b000101
+	case "BL":
+		outBin = 0b100101
 	}
 
 	// Get the relative branch address
-	branchAddr, err := getValue(operands[0], 26, "branch address", fileName, lineNumber)
+	branchAddr, err := getBranchAddress(stmt.operands[0], 26, stmt.addr, symbols, fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 26 | uint32(branchAddr)
+		outBin = outBin<<26 | uint32(branchAddr)
 	} else {
 		return 0, err
 	}
@@ -423,17 +747,16 @@ func instrB(opcode string, operands []string, fileName string, lineNumber int) (
 }
 
 // Generates the binary for conditional branch instructions
-func instrCB(opcode string, operands []string, fileName string, lineNumber int) (uint32, error) {
-	// Make sure we only have 1 operand
-	if len(operands) != 2 {
-		errMsg := fmt.Sprintf("Invalid instruction format: Expected 2 operands but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-		return 0, errors.New(errMsg)
+func instrCB(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
+	// Make sure we have the register and the address
+	if err := checkOperandCount(stmt, 2, fileName); err != nil {
+		return 0, err
 	}
 
 	outBin := uint32(0)
 
 	// Generate initial binary
-	switch opcode {
+	switch stmt.opcode {
 	case "CBZ":
 		outBin = 0b10110100
 	case "CBNZ":
@@ -441,17 +764,17 @@ func instrCB(opcode string, operands []string, fileName string, lineNumber int)
 	}
 
 	// Get the branch address
-	branchAddr, err := getValue(operands[1], 19, "branch address", fileName, lineNumber)
+	branchAddr, err := getBranchAddress(stmt.operands[1], 19, stmt.addr, symbols, fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 19 | uint32(branchAddr)
+		outBin = outBin<<19 | uint32(branchAddr)
 	} else {
 		return 0, err
 	}
 
 	// Get the register for the condition
-	register, err := getRegister(operands[0], fileName, lineNumber)
+	register, err := getRegister(stmt.operands[0], fileName, stmt.lineNumber)
 	if err == nil {
-		outBin = outBin << 5 | uint32(register)
+		outBin = outBin<<5 | uint32(register)
 	} else {
 		return 0, err
 	}
@@ -459,16 +782,39 @@ func instrCB(opcode string, operands []string, fileName string, lineNumber int)
 	return outBin, nil
 }
 
+// Generates the binary for conditional branches on the flags, which use the CB format with the condition in place of the register
+func instrBCond(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
+	// Make sure we only have the address
+	if err := checkOperandCount(stmt, 1, fileName); err != nil {
+		return 0, err
+	}
+
+	// Generate initial binary
+	outBin := uint32(0b01010100)
+
+	// Get the branch address
+	branchAddr, err := getBranchAddress(stmt.operands[0], 19, stmt.addr, symbols, fileName, stmt.lineNumber)
+	if err == nil {
+		outBin = outBin<<19 | uint32(branchAddr)
+	} else {
+		return 0, err
+	}
+
+	// Add the condition to test
+	outBin = outBin<<5 | conditionCodes[stmt.opcode]
+
+	return outBin, nil
+}
+
 // Generates the binary for constant data
-func instrData(operands []string, fileName string, lineNumber int) (uint32, error) {
+func instrData(stmt statement, symbols map[string]Symbol, fileName string) (uint32, *Diagnostic) {
 	// Make sure we only have 1 number
-	if len(operands) != 1 {
-		errMsg := fmt.Sprintf("Invalid instruction format: Expected 3 operands but got %d; File: %s; Line: %d", len(operands), fileName, lineNumber)
-		return 0, errors.New(errMsg)
+	if err := checkOperandCount(stmt, 1, fileName); err != nil {
+		return 0, err
 	}
 
 	// Get the value and return it
-	val, err := getValue(operands[0], 32, "data", fileName, lineNumber)
+	val, err := getValue(stmt.operands[0], 32, anyValue, "data", symbols, fileName, stmt.lineNumber)
 	var outBin uint32
 	if err == nil {
 		outBin = uint32(val)
@@ -479,61 +825,76 @@ func instrData(operands []string, fileName string, lineNumber int) (uint32, erro
 	return outBin, nil
 }
 
-// Parses a string for a register value
-func getRegister(regString string, fileName string, lineNumber int) (int64, error) {
-	// Get the register for the operation
-	reg, errConv := strconv.ParseInt(regString[1:], 10, 0)
-	if errConv != nil {
-		// Account for XZR register
-		if regString[1:] == "ZR" {
-			return 0x1F, nil
-		}
-		// Bad value error
-		errMsg := fmt.Sprintf("Bad register value; File: %s; Line: %d", fileName, lineNumber)
-		return -1, errors.New(errMsg)
-	} else if reg < 0 || reg > 30 {
-		// Invalid register error
-		errMsg := fmt.Sprintf("Bad register value: Register must be between 0 and 30 (inclusive); File: %s; Line: %d", fileName, lineNumber)
-		return -1, errors.New(errMsg)
-	} else {
-		// Return the register
-		return reg, nil
+// Parses an operand for a relative branch address, which is either a constant or a label
+func getBranchAddress(op operand, maxSize int, addr uint64, symbols map[string]Symbol, fileName string, lineNumber int) (uint64, *Diagnostic) {
+	// Constants are used as-is
+	if op.tokens[0].kind == tokenImmediate {
+		return getValue(op, maxSize, signedValue, "branch address", symbols, fileName, lineNumber)
 	}
+
+	if len(op.tokens) != 1 || op.tokens[0].kind != tokenIdent {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad branch address value: Expected a label or an immediate but got %s", op.text())
+	}
+
+	label := op.tokens[0].text
+	target, exists := symbols[label]
+	if !exists {
+		return 0, undefinedSymbol(label, "label", symbols, fileName, lineNumber, op.column)
+	} else if !target.IsLabel {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad branch address value: %s is a constant, not a label", label)
+	} else if target.Value%4 != 0 {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad branch address value: Label %s at address 0x%X is not word aligned", label, target.Value)
+	}
+
+	// The CPU adds the offset in words to the incremented program counter
+	offset := (int64(target.Value) - int64(addr+4)) / 4
+
+	// Make sure the offset fits in the signed field
+	minOffset := -(int64(1) << (maxSize - 1))
+	maxOffset := int64(1)<<(maxSize-1) - 1
+	if offset < minOffset || offset > maxOffset {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad branch address value: Label %s is %d instructions away but the offset must be between %d and %d (%d bits)", label, offset, minOffset, maxOffset, maxSize)
+	}
+
+	// Keep only the bits that fit in the field
+	return uint64(offset) & (uint64(1)<<maxSize - 1), nil
 }
 
-// Parses a string for a constant value
-func getValue(valStr string, maxSize int, valName string, fileName string, lineNumber int) (uint64, error) {
-	// Get the value to move into the register
-	base := 0
-	cut := 0
-	if len(valStr) >= 4 && valStr[:3] == "#0x" {
-		// Base 16
-		base = 16
-		cut = 3
-	} else {
-		// Base 10
-		base = 10
-		cut = 1
-	}
-	// Get the value based on the base that was decided earlier
-	val, errConv := strconv.ParseUint(valStr[cut:], base, maxSize)
-	if errConv == nil {
-		return val, nil
-	} else {
-		errMsg := ""
-		if strings.Contains(errConv.Error(), "value out of range") {
-			maxValue := uint(math.Pow(2, float64(maxSize)) - 1)
-			// Out of range errors
-			if base == 10 {
-				errMsg = fmt.Sprintf("Bad %s value: Value must be between 0 and %d (%d bits) but got %s; File: %s; Line: %d", valName, maxValue, maxSize, valStr, fileName, lineNumber)
-			} else {
-				repeatedZeros := strings.Repeat("0", int(math.Ceil(float64(maxSize) / 4)))
-				errMsg = fmt.Sprintf("Bad %s value: Value must be between 0x%s and 0x%X (%d bits) but got %s; File: %s; Line: %d", valName, repeatedZeros, maxValue, maxSize, valStr, fileName, lineNumber)
-			}
-		} else {
-			// Bad value error
-			errMsg = fmt.Sprintf("Bad %s value; File: %s; Line: %d", valName, fileName, lineNumber)
+// Creates the error for a name that is not defined, suggesting a similar name if there is one
+func undefinedSymbol(name string, kind string, symbols map[string]Symbol, fileName string, lineNumber int, column int) *Diagnostic {
+	diag := newError(CodeUndefinedSymbol, fileName, lineNumber, column, "Undefined %s: %s", kind, name)
+	if hint := localLabelHint(name, symbols); hint != "" {
+		return diag.suggest("%s", hint)
+	}
+
+	// The names made unique for macros and local labels cannot be written, so they are not suggested
+	names := make([]string, 0, len(symbols))
+	for symName := range symbols {
+		if !IsGeneratedName(symName) {
+			names = append(names, symName)
 		}
-		return 0, errors.New(errMsg)
 	}
-}
\ No newline at end of file
+	// Sort the names so the same suggestion is always given
+	sort.Strings(names)
+	if match := closestMatch(name, names); match != "" {
+		diag.suggest("Did you mean %s?", match)
+	}
+	return diag
+}
+
+// Parses an operand for the shift amount of a move instruction
+func getShift(op operand, fileName string, lineNumber int) (uint64, *Diagnostic) {
+	// The shift must be in the form LSL Amt
+	if len(op.tokens) != 2 || strings.ToUpper(op.tokens[0].text) != "LSL" || op.tokens[1].kind != tokenNumber {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad shift value: Expected LSL followed by the shift amount but got %s", op.text())
+	}
+
+	shiftAmt, errConv := strconv.ParseUint(op.tokens[1].text, 10, 64)
+	if errConv != nil || shiftAmt%16 != 0 || shiftAmt > 48 {
+		// Bad shift value error
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.tokens[1].column, "Bad shift value: Shift must be 0, 16, 32, or 48 but got %s", op.tokens[1].text)
+	}
+
+	return shiftAmt, nil
+}
+
@@ -0,0 +1,372 @@
+package assembler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Programs that are missing or mangle part of a line, which have to be reported as errors
+var malformedPrograms = []string{
+	"ADD",
+	"ADD ,",
+	"ADD X1, , X2",
+	"ADD X1, X2,",
+	"ADD X1, X2, #",
+	"ADD X1, X2, X",
+	"ADD X1, X2, W",
+	"ADD X1, X2, X-1",
+	"ADD X1, X2, X99999999999999999999",
+	"MUL X1, X2",
+	"SDIV X1, X2, #3",
+	"ADDI X1, X2, #",
+	"ADDI X1, X2, #(",
+	"ADDI X1, X2, #)",
+	"ADDI X1, X2, #1 +",
+	"ADDI X1, X2, #1 / 0",
+	"LDUR X1, X2",
+	"STURB , X2, #0",
+	"MOVZ X1, #1, LSL",
+	"MOVZ X1, #1, LSL 8",
+	"B",
+	"B #",
+	"BL",
+	"BR",
+	"BR #4",
+	"BR X1, X2",
+	"RET X1, X2",
+	"RET #0",
+	"CBZ",
+	"CBZ X1,",
+	"#",
+	",",
+	":",
+	"1b",
+	"B 1f",
+	".Lx",
+	"B .Lx",
+	".if",
+	".if 1",
+	".else",
+	".endif",
+	".elseif 1",
+	".ifdef",
+	".macro",
+	".macro m\nm",
+	".endm",
+	".equ",
+	".equ x,",
+	".word",
+	".word #",
+	".include",
+	".include \"x\"",
+	".section",
+	".align #100",
+	"\"",
+	"label: label:",
+	".macro m\nm\nm\n.endm\nm",
+}
+
+func TestAssembleMalformed(t *testing.T) {
+	for _, prog := range malformedPrograms {
+		t.Run(prog, func(t *testing.T) {
+			if _, err := AssembleProgramAPI(prog); err == nil {
+				t.Errorf("%q assembled without an error", prog)
+			}
+		})
+	}
+}
+
+func TestAssembleObjectBadRelocation(t *testing.T) {
+	for _, prog := range []string{
+		"B#0<<A",
+		"MOVZ X1, #1 << f, LSL 0",
+		".word 8 >> f",
+		".word f * f",
+	} {
+		t.Run(prog, func(t *testing.T) {
+			res, err := Assemble(strings.NewReader(prog), Options{FileName: "reloc", Relocatable: true})
+			if err == nil {
+				t.Fatalf("%q assembled without an error", prog)
+			}
+			if len(res.Diagnostics) == 0 || res.Diagnostics[0].Code != CodeRelocation {
+				t.Errorf("%q gave %v, want a %s error", prog, res.Diagnostics, CodeRelocation)
+			}
+		})
+	}
+}
+
+func TestAssembleObjectTooLarge(t *testing.T) {
+	for _, prog := range []string{
+		".org 0x7FFFFFFFFFFFFFF0\nHLT",
+		".data\n.space 0x7FFFFFFF",
+		".data\n.space 0x80000\n.text\n.space 0x80000\nHLT",
+	} {
+		t.Run(prog, func(t *testing.T) {
+			res, err := Assemble(strings.NewReader(prog), Options{FileName: "big", Relocatable: true})
+			if err == nil {
+				t.Fatalf("%q assembled without an error", prog)
+			}
+			if len(res.Diagnostics) == 0 || res.Diagnostics[0].Code != CodeProgramSize {
+				t.Errorf("%q gave %v, want a %s error", prog, res.Diagnostics, CodeProgramSize)
+			}
+		})
+	}
+}
+
+func TestReferences(t *testing.T) {
+	src := ".macro m\n2: B 2b\n.endm\nmain:\n1: B 1f\n1: B 1b\n.Lx: MOVZ X1, #.Lx, LSL 0\nm\n"
+	res, err := Assemble(strings.NewReader(src), Options{FileName: "refs"})
+	if err != nil {
+		t.Fatalf("Program did not assemble: %v", err)
+	}
+
+	// The labels in the expanded macro are left out since they are not written where they are used
+	want := []Reference{
+		{Name: "1", Symbol: "1@1", Line: 5, Column: 1, File: "refs"},
+		{Name: "1f", Symbol: "1@2", Line: 5, Column: 6, File: "refs"},
+		{Name: "1", Symbol: "1@2", Line: 6, Column: 1, File: "refs"},
+		{Name: "1b", Symbol: "1@2", Line: 6, Column: 6, File: "refs"},
+		{Name: ".Lx", Symbol: ".Lx@main", Line: 7, Column: 1, File: "refs"},
+		{Name: ".Lx", Symbol: ".Lx@main", Line: 7, Column: 16, File: "refs"},
+	}
+	if !reflect.DeepEqual(res.References, want) {
+		t.Errorf("References = %+v, want %+v", res.References, want)
+	}
+	for _, ref := range res.References {
+		if sym, exists := res.Symbols[ref.Symbol]; !exists || !sym.IsLabel {
+			t.Errorf("%s refers to %s, which is not a label", ref.Name, ref.Symbol)
+		}
+	}
+}
+
+func TestPseudoInstructions(t *testing.T) {
+	tests := []struct {
+		pseudo    string
+		expansion string
+	}{
+		{"MOV X1, X2", "ADD X1, X2, XZR"},
+		{"MOV X1, #5", "MOVZ X1, #5, LSL 0"},
+		{"CMP X1, X2", "SUBS XZR, X1, X2"},
+		{"CMP X1, #5", "SUBIS XZR, X1, #5"},
+		{"CMPI X1, #5", "SUBIS XZR, X1, #5"},
+		{"NEG X1, X2", "SUB X1, XZR, X2"},
+		{"NOP", "ADD XZR, XZR, XZR"},
+		{"TST X1", "ANDS XZR, X1, X1"},
+		{"TST X1, X2", "ANDS XZR, X1, X2"},
+		{"TST X1, #5", "ANDIS XZR, X1, #5"},
+		{"RET", "BR LR"},
+		{"RET X3", "BR X3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pseudo, func(t *testing.T) {
+			got, err := AssembleProgramAPI(tc.pseudo)
+			if err != nil {
+				t.Fatalf("%q did not assemble: %v", tc.pseudo, err)
+			}
+			want, err := AssembleProgramAPI(tc.expansion)
+			if err != nil {
+				t.Fatalf("%q did not assemble: %v", tc.expansion, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%q = %X, want %X from %q", tc.pseudo, got, want, tc.expansion)
+			}
+		})
+	}
+}
+
+func TestTSTEncoding(t *testing.T) {
+	// TST only sets the flags, so the result of the AND goes to XZR, and the first register goes in bits 16-20 like every other R-format instruction
+	tests := []struct {
+		prog string
+		word uint32
+	}{
+		{"TST X1", 0xEA01003F},
+		{"TST X1, X2", 0xEA01005F},
+		{"TST X1, #5", 0xF200143F},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.prog, func(t *testing.T) {
+			image, err := AssembleProgramAPI(tc.prog)
+			if err != nil {
+				t.Fatalf("%q did not assemble: %v", tc.prog, err)
+			}
+			if word := uint32(image[0])<<24 | uint32(image[1])<<16 | uint32(image[2])<<8 | uint32(image[3]); word != tc.word {
+				t.Errorf("%q = 0x%08X, want 0x%08X", tc.prog, word, tc.word)
+			}
+		})
+	}
+}
+
+// A program with a block for each kind of conditional, where each block places a different word
+const conditionalProgram = `.if BIG
+	.if BIG - 2
+		.word 3
+	.else
+		.word 2
+	.endif
+.elseif SMALL
+	.word 1
+.else
+	.word 0
+.endif
+.ifdef FLAG
+	.word 5
+.else
+	.word 6
+.endif
+.ifndef FLAG
+	.word 7
+.endif
+`
+
+func TestConditionals(t *testing.T) {
+	tests := []struct {
+		name    string
+		defines map[string]string
+		want    string // The program that has to assemble into the same bytes
+	}{
+		{".if", map[string]string{"BIG": "3", "SMALL": "1"}, ".word 3\n.word 6\n.word 7\n"},
+		{"Nested .else", map[string]string{"BIG": "2", "SMALL": "1"}, ".word 2\n.word 6\n.word 7\n"},
+		{".elseif", map[string]string{"BIG": "0", "SMALL": "1"}, ".word 1\n.word 6\n.word 7\n"},
+		{".else", map[string]string{"BIG": "0", "SMALL": "0"}, ".word 0\n.word 6\n.word 7\n"},
+		{".ifdef", map[string]string{"BIG": "0", "SMALL": "1", "FLAG": ""}, ".word 1\n.word 5\n"},
+		{"Define set to 0 is still defined", map[string]string{"BIG": "0", "SMALL": "0", "FLAG": "0"}, ".word 0\n.word 5\n"},
+		{"Define with an expression", map[string]string{"BIG": "(1 << 2) - 2", "SMALL": "0"}, ".word 2\n.word 6\n.word 7\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := Assemble(strings.NewReader(conditionalProgram), Options{FileName: "cond", Defines: tc.defines})
+			if err != nil {
+				t.Fatalf("Program did not assemble: %v", err)
+			}
+			want, err := AssembleProgramAPI(tc.want)
+			if err != nil {
+				t.Fatalf("%q did not assemble: %v", tc.want, err)
+			}
+			if !reflect.DeepEqual(res.Image, want) {
+				t.Errorf("Image = %X, want %X", res.Image, want)
+			}
+		})
+	}
+}
+
+func TestConditionalsUseConstants(t *testing.T) {
+	// Constants from .equ before the condition work the same as defines, and defines can be used like any other constant
+	src := ".equ MODE, 0\n.if MODE\n\tMOVZ X1, #0, LSL 0\n.else\n\tMOVZ X1, #SIZE, LSL 0\n.endif\n.ifndef MODE\n\t.word 1\n.endif\n"
+	res, err := Assemble(strings.NewReader(src), Options{FileName: "cond", Defines: map[string]string{"SIZE": "0x10"}})
+	if err != nil {
+		t.Fatalf("Program did not assemble: %v", err)
+	}
+	want, err := AssembleProgramAPI("MOVZ X1, #0x10, LSL 0\n")
+	if err != nil {
+		t.Fatalf("Expected program did not assemble: %v", err)
+	}
+	if !reflect.DeepEqual(res.Image, want) {
+		t.Errorf("Image = %X, want %X", res.Image, want)
+	}
+}
+
+func TestBadDefines(t *testing.T) {
+	for _, defines := range []map[string]string{
+		{"1X": "1"},
+		{"X Y": "1"},
+		{"BIG": "1 +"},
+		{"BIG": "missing"},
+	} {
+		t.Run(fmt.Sprint(defines), func(t *testing.T) {
+			res, err := Assemble(strings.NewReader(conditionalProgram), Options{FileName: "cond", Defines: defines})
+			if err == nil {
+				t.Fatalf("Program assembled with the defines %v", defines)
+			}
+			if len(res.Diagnostics) == 0 || res.Diagnostics[0].Code != CodeBadValue {
+				t.Errorf("Diagnostics = %v, want a %s error", res.Diagnostics, CodeBadValue)
+			}
+		})
+	}
+}
+
+// Programs that formatting must not change the meaning of
+var formatPrograms = []struct {
+	name        string
+	src         string
+	relocatable bool
+}{
+	{"Loop", "movz x0, #5, lsl 0\nmovz x2,#3,lsl 0\nloop: add x1,x1,x2\n  subi x0, x0, #1 ; count down\ncbnz x0, loop\nhlt\n", false},
+	{"Label on .align", "HLT\n.byte 1\nlbl: .align 2\nDATA #lbl\n", false},
+	{"Label on .org", "HLT\nstart: .org 0x10\nDATA #start\nend: .ORG 0x20 // the end\nDATA #end\n", false},
+	{"Label before .align", "HLT\n.byte 1\nlbl:\n.align 2\nDATA #lbl\n", false},
+	{"Macros and local labels", ".macro dec reg\nsubi \\reg, \\reg, #1\n.endm\nmain: movz x1, #3, lsl 0\n1: dec x1\ncbnz x1, 1b\n.Lend: hlt\n.equ N, 4 * 2\n.word N\n", false},
+	{"Sections", ".global main\nmain: movi x1, #table\nbl f\nhlt\n.data\n.byte 1\ntable: .align 3\n.dword main\n", true},
+}
+
+// Gets the bytes a program was assembled into and the values of its symbols
+func assembledOutput(res *Result) ([][]uint8, map[string]uint64) {
+	data := [][]uint8{res.Image}
+	if res.Object != nil {
+		data = data[:0]
+		for _, sec := range res.Object.Sections {
+			data = append(data, sec.Data)
+		}
+	}
+	values := make(map[string]uint64, len(res.Symbols))
+	for name, sym := range res.Symbols {
+		values[name] = sym.Value
+	}
+	return data, values
+}
+
+func TestFormatKeepsProgram(t *testing.T) {
+	for _, tc := range formatPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{FileName: "prog", Relocatable: tc.relocatable}
+			before, err := Assemble(strings.NewReader(tc.src), opts)
+			if err != nil {
+				t.Fatalf("Program did not assemble: %v", err)
+			}
+			formatted, err := Format([]byte(tc.src))
+			if err != nil {
+				t.Fatalf("Format failed: %v", err)
+			}
+			after, err := Assemble(strings.NewReader(string(formatted)), opts)
+			if err != nil {
+				t.Fatalf("Formatted program did not assemble: %v\n%s", err, formatted)
+			}
+
+			dataBefore, symbolsBefore := assembledOutput(before)
+			dataAfter, symbolsAfter := assembledOutput(after)
+			if !reflect.DeepEqual(dataBefore, dataAfter) {
+				t.Errorf("Formatting changed the bytes from %X to %X\n%s", dataBefore, dataAfter, formatted)
+			}
+			if !reflect.DeepEqual(symbolsBefore, symbolsAfter) {
+				t.Errorf("Formatting changed the symbols from %v to %v\n%s", symbolsBefore, symbolsAfter, formatted)
+			}
+
+			// Formatting a formatted program does not change it
+			if again, err := Format(formatted); err != nil || string(again) != string(formatted) {
+				t.Errorf("Formatting again gave %q, want %q (err %v)", again, formatted, err)
+			}
+		})
+	}
+}
+
+func FuzzAssembleProgramAPI(f *testing.F) {
+	for _, prog := range malformedPrograms {
+		f.Add(prog)
+	}
+	f.Add("")
+	f.Add("1:")
+	f.Add("main:\n\tMOVZ X1, #5, LSL 0\n1:\n\tSUBI X1, X1, #1\n\tCBNZ X1, 1b\n\tHLT\n")
+	f.Add(".macro dec reg\n\tSUBI \\reg, \\reg, #1\n.endm\n.if 1\n\tdec X1\n.else\n\tADD X1, X2, X3\n.endif\n")
+	f.Add("a:\n.Lloop:\n\tB .Lloop\n.equ N, 4 * 2\n.word N\n")
+	f.Fuzz(func(t *testing.T, prog string) {
+		// Errors are expected, but nothing should panic
+		AssembleProgramAPI(prog)
+		Format([]byte(prog))
+		Assemble(strings.NewReader(prog), Options{FileName: "fuzz", NoIncludes: true, Listing: true, Relocatable: true})
+	})
+}
@@ -0,0 +1,216 @@
+package assembler
+
+import (
+	"sort"
+	"strings"
+)
+
+// Struct for a .if block the preprocessor is inside of
+type conditional struct {
+	directive   string // The directive that started the block as it was written
+	fileName    string // The file the block starts in
+	lineNumber  int    // The line the block starts on
+	column      int    // The column of the directive that started the block
+	outerActive bool   // If the lines around the block are assembled
+	active      bool   // If the lines in the current branch are assembled
+	taken       bool   // If one of the branches so far was assembled, so the rest are skipped
+	elseLine    int    // The line of the .else, or 0 if there has not been one yet
+}
+
+// Determines if an opcode starts, continues, or ends a conditional block
+func isConditionalDirective(name string) bool {
+	switch name {
+	case ".IF", ".IFDEF", ".IFNDEF", ".ELSEIF", ".ELSE", ".ENDIF":
+		return true
+	}
+	return false
+}
+
+// Evaluates the values given in Options.Defines into constants that can be used anywhere in the program
+func evalDefines(opts Options) (map[string]Symbol, Diagnostics) {
+	defines := make(map[string]Symbol)
+	diags := make(Diagnostics, 0)
+
+	// Go through the names in order so the diagnostics are always the same
+	names := make([]string, 0, len(opts.Defines))
+	for name := range opts.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := opts.Defines[name]
+		nameLines, _ := tokenize(name, "")
+		if len(nameLines) != 1 || len(nameLines[0].tokens) != 1 || nameLines[0].tokens[0].kind != tokenIdent || !isWordStart(name[0]) {
+			diags = append(diags, newError(CodeBadValue, opts.FileName, 0, 0, "Bad define: %q is not a valid name", name).suggest("Names must start with a letter or underscore and may contain letters, digits, and underscores"))
+			continue
+		}
+
+		// A name on its own is defined as 1, like a flag
+		if strings.TrimSpace(value) == "" {
+			value = "1"
+		}
+		valueLines, tokDiags := tokenize(value, "")
+		if len(tokDiags) > 0 || len(valueLines) != 1 || len(valueLines[0].tokens) == 0 {
+			diags = append(diags, newError(CodeBadValue, opts.FileName, 0, 0, "Bad define: %s=%s is not a constant expression", name, value))
+			continue
+		}
+		val, diag := evalOperand(operand{tokens: valueLines[0].tokens, column: 1}, map[string]Symbol{}, opts.FileName, 0)
+		if diag != nil {
+			diags = append(diags, newError(CodeBadValue, opts.FileName, 0, 0, "Bad define: %s=%s: %s", name, value, diag.Message))
+			continue
+		}
+		defines[name] = Symbol{Value: uint64(val.Int64()), File: opts.FileName}
+	}
+	return defines, diags
+}
+
+// Handles a line that starts, continues, or ends a conditional block, updating the stack of blocks the preprocessor is inside of
+func (pp *preprocessor) conditional(conds []*conditional, line sourceLine, tokens []token) []*conditional {
+	name := strings.ToUpper(tokens[0].text)
+	var top *conditional
+	if len(conds) > 0 {
+		top = conds[len(conds)-1]
+	}
+
+	switch name {
+	case ".IF", ".IFDEF", ".IFNDEF":
+		cond := &conditional{
+			directive:   strings.ToLower(tokens[0].text),
+			fileName:    line.fileName,
+			lineNumber:  line.lineNumber,
+			column:      tokens[0].column,
+			outerActive: top == nil || top.active,
+		}
+		// Conditions inside of skipped lines are not checked since they might use names that only exist when the lines are assembled
+		if cond.outerActive {
+			cond.active = pp.evalCondition(line, tokens)
+		}
+		cond.taken = cond.active || !cond.outerActive
+		return append(conds, cond)
+
+	case ".ELSEIF":
+		if top == nil {
+			pp.diags = append(pp.diags, newError(CodeConditional, line.fileName, line.lineNumber, tokens[0].column, "Bad conditional: .elseif without a matching .if"))
+			return conds
+		}
+		if top.elseLine != 0 {
+			pp.diags = append(pp.diags, newError(CodeConditional, line.fileName, line.lineNumber, tokens[0].column, "Bad conditional: .elseif cannot come after the .else on line %d", top.elseLine).suggest("Move the .elseif before the .else"))
+			top.active = false
+			return conds
+		}
+		if top.taken {
+			top.active = false
+		} else {
+			top.active = pp.evalCondition(line, tokens)
+			top.taken = top.active
+		}
+
+	case ".ELSE":
+		if top == nil {
+			pp.diags = append(pp.diags, newError(CodeConditional, line.fileName, line.lineNumber, tokens[0].column, "Bad conditional: .else without a matching .if"))
+			return conds
+		}
+		if top.elseLine != 0 {
+			pp.diags = append(pp.diags, newError(CodeConditional, line.fileName, line.lineNumber, tokens[0].column, "Bad conditional: The %s on line %d already has a .else on line %d", top.directive, top.lineNumber, top.elseLine))
+			top.active = false
+			return conds
+		}
+		if len(tokens) > 1 {
+			pp.diags = append(pp.diags, newError(CodeOperandCount, line.fileName, line.lineNumber, tokens[1].column, "Invalid directive format: .else does not take any operands").suggest("Use .elseif to test another condition"))
+		}
+		top.active = !top.taken
+		top.taken = true
+		top.elseLine = line.lineNumber
+
+	case ".ENDIF":
+		if top == nil {
+			pp.diags = append(pp.diags, newError(CodeConditional, line.fileName, line.lineNumber, tokens[0].column, "Bad conditional: .endif without a matching .if"))
+			return conds
+		}
+		if len(tokens) > 1 {
+			pp.diags = append(pp.diags, newError(CodeOperandCount, line.fileName, line.lineNumber, tokens[1].column, "Invalid directive format: .endif does not take any operands"))
+		}
+		return conds[:len(conds)-1]
+	}
+	return conds
+}
+
+// Reports the conditional blocks that are still open at the end of a file or macro
+func (pp *preprocessor) unclosedConditionals(conds []*conditional) {
+	for _, cond := range conds {
+		pp.diags = append(pp.diags, newError(CodeConditional, cond.fileName, cond.lineNumber, cond.column, "Bad conditional: %s without a matching .endif", cond.directive).suggest("Add .endif after the last line of the block"))
+	}
+}
+
+// Works out if the condition of a .if, .ifdef, .ifndef, or .elseif line is true, where errors count as false
+func (pp *preprocessor) evalCondition(line sourceLine, tokens []token) bool {
+	name := strings.ToUpper(tokens[0].text)
+	ops, diag := splitOperands(tokens[1:], tokens[0], line.fileName, line.lineNumber)
+	if diag == nil && len(ops) != 1 {
+		diag = newError(CodeOperandCount, line.fileName, line.lineNumber, tokens[0].column, "Invalid directive format: Expected %s followed by a single condition but got %d operands", strings.ToLower(tokens[0].text), len(ops))
+	}
+	if diag != nil {
+		pp.diags = append(pp.diags, diag)
+		return false
+	}
+	op := ops[0]
+
+	if name == ".IFDEF" || name == ".IFNDEF" {
+		if len(op.tokens) != 1 || op.tokens[0].kind != tokenIdent {
+			pp.diags = append(pp.diags, newError(CodeSyntax, line.fileName, line.lineNumber, op.column, "Invalid directive format: Expected a name but got %s", op.text()))
+			return false
+		}
+		_, isConstant := pp.constants[op.tokens[0].text]
+		defined := isConstant || pp.unknowns[op.tokens[0].text]
+		return defined == (name == ".IFDEF")
+	}
+
+	// Labels do not have an address until the whole program is laid out, so only constants can be used
+	exprToks, diag := exprTokens(op, line.fileName, line.lineNumber)
+	if diag != nil {
+		pp.diags = append(pp.diags, diag)
+		return false
+	}
+	for _, tok := range exprToks {
+		if tok.kind == tokenIdent && pp.unknowns[tok.text] {
+			pp.diags = append(pp.diags, newError(CodeConditional, line.fileName, line.lineNumber, tok.column, "Bad condition: The value of %s is not known until the program is laid out", tok.text).suggest("Conditions can only use constants defined with -D or .equ before the condition"))
+			return false
+		}
+	}
+	val, diag := evalOperand(op, pp.constants, line.fileName, line.lineNumber)
+	if diag != nil {
+		if diag.Code == CodeUndefinedSymbol && diag.Suggestion == "" {
+			diag.suggest("Conditions can only use constants defined with -D or .equ before the condition")
+		}
+		pp.diags = append(pp.diags, diag)
+		return false
+	}
+	return val.Sign() != 0
+}
+
+// Records the constant or label defined by a line that is assembled so later conditions can use it
+func (pp *preprocessor) recordDefinition(line sourceLine) {
+	label, rest := splitLabel(line.tokens)
+	if len(label) > 0 {
+		pp.unknowns[label[0].text] = true
+	}
+	if len(rest) < 2 || !strings.EqualFold(rest[0].text, ".EQU") {
+		return
+	}
+
+	// Constants that cannot be worked out yet, such as ones that use labels, are still defined for .ifdef
+	ops, diag := splitOperands(rest[1:], rest[0], line.fileName, line.lineNumber)
+	if diag != nil || len(ops) != 2 || len(ops[0].tokens) != 1 || ops[0].tokens[0].kind != tokenIdent {
+		return
+	}
+	name := ops[0].tokens[0].text
+	if _, exists := pp.constants[name]; exists {
+		return
+	}
+	if val, diag := evalOperand(ops[1], pp.constants, line.fileName, line.lineNumber); diag == nil {
+		pp.constants[name] = Symbol{Value: uint64(val.Int64()), Line: line.lineNumber, File: line.fileName}
+	} else {
+		pp.unknowns[name] = true
+	}
+}
@@ -0,0 +1,200 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The severity of a problem found in a program
+type Severity int
+
+const (
+	SeverityError   Severity = iota // The program cannot be assembled
+	SeverityWarning                 // The program can be assembled but probably has a mistake
+)
+
+// The codes that identify each kind of diagnostic
+const (
+	CodeSyntax          = "syntax"           // The line could not be parsed
+	CodeBadOpcode       = "bad-opcode"       // The opcode or directive does not exist
+	CodeOperandCount    = "operand-count"    // The wrong number of operands was given
+	CodeBadRegister     = "bad-register"     // The register is not valid
+	CodeBadValue        = "bad-value"        // The value is malformed or does not fit in its field
+	CodeUndefinedSymbol = "undefined-symbol" // The label or constant is never defined
+	CodeDuplicateSymbol = "duplicate-symbol" // The label or constant is defined more than once
+	CodeAlignment       = "alignment"        // The instruction is not at a word aligned address
+	CodeProgramSize     = "program-size"     // The program does not fit in memory
+	CodeMacro           = "macro"            // The macro is defined or used incorrectly
+	CodeInclude         = "include"          // The included file cannot be found or read
+	CodeSection         = "section"          // The section cannot be used
+	CodeRelocation      = "relocation"       // The value depends on an address that is not known until linking in a way the linker cannot fill in
+	CodeConditional     = "conditional"      // The .if, .elseif, .else, or .endif lines do not match up or the condition cannot be worked out
+	CodeXzrWrite        = "xzr-write"        // The result of the instruction is written to XZR
+	CodeUnreachable     = "unreachable"      // The instruction can never be executed
+)
+
+// Struct for a problem found in a program
+type Diagnostic struct {
+	File       string   `json:"file"`                 // The file the problem is in
+	Line       int      `json:"line"`                 // The line the problem is on (1-based)
+	Column     int      `json:"column"`               // The column the problem starts in (1-based), or 0 for the whole line
+	Severity   Severity `json:"severity"`             // How serious the problem is
+	Code       string   `json:"code"`                 // The kind of problem
+	Message    string   `json:"message"`              // The description of the problem
+	Suggestion string   `json:"suggestion,omitempty"` // A possible fix for the problem
+}
+
+// A list of problems found in a program
+type Diagnostics []*Diagnostic
+
+// Gets the name of the severity
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// Creates an error diagnostic at the given location
+func newError(code string, fileName string, lineNumber int, column int, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		File:     fileName,
+		Line:     lineNumber,
+		Column:   column,
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Creates a warning diagnostic at the given location
+func newWarning(code string, fileName string, lineNumber int, column int, format string, args ...any) *Diagnostic {
+	diag := newError(code, fileName, lineNumber, column, format, args...)
+	diag.Severity = SeverityWarning
+	return diag
+}
+
+// Adds a suggested fix to the diagnostic
+func (diag *Diagnostic) suggest(format string, args ...any) *Diagnostic {
+	diag.Suggestion = fmt.Sprintf(format, args...)
+	return diag
+}
+
+// Gets the string representation of the diagnostic
+func (diag *Diagnostic) Error() string {
+	var str strings.Builder
+	str.WriteString(diag.Message)
+	if diag.Severity == SeverityWarning {
+		str.WriteString(" (warning)")
+	}
+	if diag.Suggestion != "" {
+		str.WriteString(fmt.Sprintf("; Suggestion: %s", diag.Suggestion))
+	}
+	str.WriteString(fmt.Sprintf("; File: %s", diag.File))
+	if diag.Line > 0 {
+		str.WriteString(fmt.Sprintf("; Line: %d", diag.Line))
+	}
+	if diag.Column > 0 {
+		str.WriteString(fmt.Sprintf("; Column: %d", diag.Column))
+	}
+	return str.String()
+}
+
+// Gets the string representation of all of the diagnostics, one per line
+func (diags Diagnostics) Error() string {
+	msgs := make([]string, len(diags))
+	for i, diag := range diags {
+		msgs[i] = diag.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Determines if any of the diagnostics are errors
+func (diags Diagnostics) HasErrors() bool {
+	for _, diag := range diags {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets only the diagnostics that are errors
+func (diags Diagnostics) Errors() Diagnostics {
+	errs := make(Diagnostics, 0)
+	for _, diag := range diags {
+		if diag.Severity == SeverityError {
+			errs = append(errs, diag)
+		}
+	}
+	return errs
+}
+
+// Sorts the diagnostics by their location in the program and removes any that are reported more than once
+func sortDiagnostics(diags Diagnostics) Diagnostics {
+	sort.SliceStable(diags, func(i int, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+
+	// Pseudo-instructions that expand to several instructions can have the same problem in each one
+	unique := make(Diagnostics, 0, len(diags))
+	for i, diag := range diags {
+		if i > 0 && *diag == *diags[i-1] {
+			continue
+		}
+		unique = append(unique, diag)
+	}
+	return unique
+}
+
+// Finds the option that is closest to the given name, if any are close enough to be a likely typo
+func closestMatch(name string, options []string) string {
+	best := ""
+	// Allow about 1 typo for every 3 characters
+	bestDist := len(name)/3 + 1
+	for _, option := range options {
+		dist := editDistance(strings.ToUpper(name), strings.ToUpper(option))
+		if dist < bestDist {
+			best = option
+			bestDist = dist
+		}
+	}
+	return best
+}
+
+// Computes the number of single character edits needed to turn one string into another
+func editDistance(str1 string, str2 string) int {
+	prev := make([]int, len(str2)+1)
+	cur := make([]int, len(str2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(str1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(str2); j++ {
+			cost := 1
+			if str1[i-1] == str2[j-1] {
+				cost = 0
+			}
+			// Pick the cheapest of deleting, inserting, or substituting a character
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(str2)]
+}
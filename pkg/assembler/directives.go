@@ -0,0 +1,221 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The number of bytes each data directive places per value
+var dataSizes = map[string]int{
+	".BYTE":  1,
+	".HWORD": 2,
+	".WORD":  4,
+	".DWORD": 8,
+}
+
+// Determines if an opcode is an assembler directive
+func isDirective(opcode string) bool {
+	return strings.HasPrefix(opcode, ".")
+}
+
+// Finds where a directive places its data and the address right after it, recording any constants it defines
+func layoutDirective(stmt statement, addr uint64, symbols map[string]Symbol, fileName string) (uint64, uint64, *Diagnostic) {
+	switch stmt.opcode {
+	case ".ORG":
+		if err := checkOperandCount(stmt, 1, fileName); err != nil {
+			return 0, 0, err
+		}
+		newAddr, err := getDirectiveValue(stmt.operands[0], 64, unsignedValue, "origin", symbols, fileName, stmt.lineNumber)
+		if err != nil {
+			return 0, 0, err
+		}
+		// Moving backwards would overwrite what was already placed
+		if newAddr < addr {
+			return 0, 0, newError(CodeBadValue, fileName, stmt.lineNumber, stmt.operands[0].column, "Bad origin value: Cannot move back to 0x%X from 0x%X", newAddr, addr)
+		}
+		return newAddr, newAddr, nil
+
+	case ".ALIGN":
+		if err := checkOperandCount(stmt, 1, fileName); err != nil {
+			return 0, 0, err
+		}
+		// Align to a 2^n byte boundary
+		power, err := getDirectiveValue(stmt.operands[0], 4, unsignedValue, "alignment", symbols, fileName, stmt.lineNumber)
+		if err != nil {
+			return 0, 0, err
+		}
+		alignment := uint64(1) << power
+		newAddr := (addr + alignment - 1) &^ (alignment - 1)
+		return newAddr, newAddr, nil
+
+	case ".BYTE", ".HWORD", ".WORD", ".DWORD":
+		if len(stmt.operands) == 0 {
+			return 0, 0, newError(CodeOperandCount, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid directive format: Expected at least 1 value")
+		}
+		return addr, addr + uint64(dataSizes[stmt.opcode]*len(stmt.operands)), nil
+
+	case ".ASCII", ".ASCIZ":
+		strs, err := getStrings(stmt, fileName)
+		if err != nil {
+			return 0, 0, err
+		}
+		size := 0
+		for _, str := range strs {
+			size += len(str)
+			// Null terminator
+			if stmt.opcode == ".ASCIZ" {
+				size++
+			}
+		}
+		return addr, addr + uint64(size), nil
+
+	case ".SPACE":
+		if len(stmt.operands) != 1 && len(stmt.operands) != 2 {
+			return 0, 0, newError(CodeOperandCount, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid directive format: Expected a size and an optional fill value but got %d operands", len(stmt.operands))
+		}
+		size, err := getDirectiveValue(stmt.operands[0], 32, unsignedValue, "space size", symbols, fileName, stmt.lineNumber)
+		if err != nil {
+			return 0, 0, err
+		}
+		return addr, addr + size, nil
+
+	case ".EQU":
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return 0, 0, err
+		}
+		nameOp := stmt.operands[0]
+		if len(nameOp.tokens) != 1 || nameOp.tokens[0].kind != tokenIdent {
+			return 0, 0, newError(CodeSyntax, fileName, stmt.lineNumber, nameOp.column, "Bad constant name: %s", nameOp.text())
+		}
+		val, err := getDirectiveValue(stmt.operands[1], 64, anyValue, "constant", symbols, fileName, stmt.lineNumber)
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := defineSymbol(symbols, nameOp.tokens[0].text, val, "", stmt.lineNumber, nameOp.column, fileName); err != nil {
+			return 0, 0, err
+		}
+		return addr, addr, nil
+
+	case ".TEXT", ".DATA", ".SECTION":
+		// The section is switched when the program is laid out
+		_, err := getSectionName(stmt, fileName)
+		return addr, addr, err
+
+	case ".GLOBAL", ".GLOBL":
+		_, err := getGlobalNames(stmt, fileName)
+		return addr, addr, err
+
+	default:
+		return 0, 0, newError(CodeBadOpcode, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid directive: %s", stmt.opcode)
+	}
+}
+
+// Defines the constants that could not be worked out during layout, returning the problems with any that still cannot be worked out
+func resolveConstants(pending []statement, symbols map[string]Symbol) Diagnostics {
+	diags := make(Diagnostics, 0)
+
+	// Constants can use each other, so keep going until no more can be defined
+	for progress := true; progress; {
+		progress = false
+		remaining := make([]statement, 0, len(pending))
+		for _, stmt := range pending {
+			_, _, diag := layoutDirective(stmt, stmt.addr, symbols, stmt.fileName)
+			switch {
+			case diag == nil:
+				progress = true
+			case diag.Code == CodeUndefinedSymbol:
+				remaining = append(remaining, stmt)
+			default:
+				diags = append(diags, diag)
+			}
+		}
+		pending = remaining
+	}
+
+	// Anything left uses a symbol that is never defined
+	for _, stmt := range pending {
+		_, _, diag := layoutDirective(stmt, stmt.addr, symbols, stmt.fileName)
+		diags = append(diags, diag)
+	}
+	return diags
+}
+
+// Writes the data for a directive into the program
+func emitDirective(program []uint8, stmt statement, symbols map[string]Symbol, fileName string) *Diagnostic {
+	switch stmt.opcode {
+	case ".BYTE", ".HWORD", ".WORD", ".DWORD":
+		size := dataSizes[stmt.opcode]
+		for i, op := range stmt.operands {
+			val, err := getDirectiveValue(op, size*8, anyValue, "data", symbols, fileName, stmt.lineNumber)
+			if err != nil {
+				return err
+			}
+			putValue(program, stmt.addr+uint64(i*size), val, size)
+		}
+
+	case ".ASCII", ".ASCIZ":
+		strs, err := getStrings(stmt, fileName)
+		if err != nil {
+			return err
+		}
+		addr := stmt.addr
+		for _, str := range strs {
+			copy(program[addr:], str)
+			addr += uint64(len(str))
+			// The null terminator is already in place since the program starts as all 0s
+			if stmt.opcode == ".ASCIZ" {
+				addr++
+			}
+		}
+
+	case ".SPACE":
+		if len(stmt.operands) == 2 {
+			size, err := getDirectiveValue(stmt.operands[0], 32, unsignedValue, "space size", symbols, fileName, stmt.lineNumber)
+			if err != nil {
+				return err
+			}
+			fill, err := getDirectiveValue(stmt.operands[1], 8, anyValue, "fill", symbols, fileName, stmt.lineNumber)
+			if err != nil {
+				return err
+			}
+			for i := uint64(0); i < size; i++ {
+				program[stmt.addr+i] = uint8(fill)
+			}
+		}
+	}
+
+	// .ORG, .ALIGN, .EQU, and the section and symbol directives do not place any data
+	return nil
+}
+
+// Parses an operand of a directive for a constant value, which may be written with or without a '#'
+func getDirectiveValue(op operand, maxSize int, kind valueKind, valName string, symbols map[string]Symbol, fileName string, lineNumber int) (uint64, *Diagnostic) {
+	if op.tokens[0].kind == tokenString {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad %s value: Expected a number or a symbol but got %s", valName, op.text())
+	}
+	val, err := evalOperand(op, symbols, fileName, lineNumber)
+	if err != nil {
+		return 0, err
+	}
+	return fitValue(val, maxSize, kind, valName, op, fileName, lineNumber)
+}
+
+// Gets the contents of the strings that are the operands of a directive
+func getStrings(stmt statement, fileName string) ([]string, *Diagnostic) {
+	if len(stmt.operands) == 0 {
+		return nil, newError(CodeOperandCount, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid directive format: Expected at least 1 string")
+	}
+
+	strs := make([]string, len(stmt.operands))
+	for i, op := range stmt.operands {
+		if len(op.tokens) != 1 || op.tokens[0].kind != tokenString {
+			return nil, newError(CodeBadValue, fileName, stmt.lineNumber, op.column, "Bad string value: Expected a quoted string but got %s", op.text())
+		}
+		str, err := strconv.Unquote(op.tokens[0].text)
+		if err != nil {
+			return nil, newError(CodeBadValue, fileName, stmt.lineNumber, op.column, "Bad string value: Invalid escape sequence in %s", op.tokens[0].text)
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
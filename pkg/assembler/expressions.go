@@ -0,0 +1,392 @@
+package assembler
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// How a value is checked against the number of bits in its field
+type valueKind int
+
+const (
+	unsignedValue valueKind = iota // The value must be between 0 and 2^n - 1
+	signedValue                    // The value must be between -2^(n-1) and 2^(n-1) - 1 and is stored in 2's complement
+	anyValue                       // The value can be between -2^(n-1) and 2^n - 1, where negative values are stored in 2's complement
+)
+
+// The largest amount a value can be shifted by in an expression
+const maxExprShift = 64
+
+// The amount the labels of a section are moved by to find out how an expression depends on where the section is placed
+var relocShift = new(big.Int).SetUint64(1<<40 + 1)
+
+// The binary operators from lowest to highest precedence
+var binaryOperators = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// Struct for evaluating a constant expression
+type exprParser struct {
+	tokens     []token           // The tokens of the expression
+	pos        int               // The index of the next token
+	symbols    map[string]Symbol // The symbols that can be used in the expression
+	fileName   string            // The file the expression is in
+	lineNumber int               // The line the expression is on
+	endColumn  int               // The column right after the expression, used for errors at the end
+	shiftBase  string            // The section or external symbol whose labels are moved by relocShift, if any
+	labels     []string          // The labels used in the expression
+}
+
+// Parses an operand that must be an immediate into a value that fits in maxSize bits
+func getValue(op operand, maxSize int, kind valueKind, valName string, symbols map[string]Symbol, fileName string, lineNumber int) (uint64, *Diagnostic) {
+	if op.tokens[0].kind != tokenImmediate {
+		return 0, newError(CodeBadValue, fileName, lineNumber, op.column, "Bad %s value: Expected an immediate but got %s", valName, op.text())
+	}
+	val, err := evalOperand(op, symbols, fileName, lineNumber)
+	if err != nil {
+		return 0, err
+	}
+	return fitValue(val, maxSize, kind, valName, op, fileName, lineNumber)
+}
+
+// Evaluates the constant expression in an operand, which may start with a '#'
+func evalOperand(op operand, symbols map[string]Symbol, fileName string, lineNumber int) (*big.Int, *Diagnostic) {
+	val, _, err := evalExpr(op, symbols, fileName, lineNumber, "")
+	return val, err
+}
+
+// Evaluates the expression in an operand with the labels of shiftBase moved by relocShift, returning the labels it uses
+func evalExpr(op operand, symbols map[string]Symbol, fileName string, lineNumber int, shiftBase string) (*big.Int, []string, *Diagnostic) {
+	tokens, diag := exprTokens(op, fileName, lineNumber)
+	if diag != nil {
+		return nil, nil, diag
+	}
+
+	last := op.tokens[len(op.tokens)-1]
+	parser := &exprParser{
+		tokens:     tokens,
+		symbols:    symbols,
+		fileName:   fileName,
+		lineNumber: lineNumber,
+		endColumn:  last.column + len(last.text),
+		shiftBase:  shiftBase,
+	}
+
+	val, err := parser.parseBinary(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if parser.pos < len(tokens) {
+		tok := tokens[parser.pos]
+		return nil, nil, newError(CodeSyntax, fileName, lineNumber, tok.column, "Bad expression: Unexpected %s", tok.text)
+	}
+	return val, parser.labels, nil
+}
+
+// Gets the tokens of the expression in an operand
+func exprTokens(op operand, fileName string, lineNumber int) ([]token, *Diagnostic) {
+	tokens := op.tokens
+
+	// The tokenizer keeps the start of the expression together with the '#', so split it back up
+	if first := tokens[0]; first.kind == tokenImmediate {
+		// Names the assembler made unique for macros and local labels cannot be tokenized, so they stay whole
+		if name := first.text[1:]; IsGeneratedName(name) {
+			return append([]token{{kind: tokenIdent, text: name, column: first.column + 1}}, tokens[1:]...), nil
+		}
+		lines, diags := tokenize(first.text[1:], fileName)
+		if len(diags) > 0 {
+			diags[0].Line = lineNumber
+			diags[0].Column += first.column
+			return nil, diags[0]
+		}
+		split := make([]token, 0, len(tokens)+1)
+		for _, tok := range lines[0].tokens {
+			tok.column += first.column
+			split = append(split, tok)
+		}
+		tokens = append(split, tokens[1:]...)
+	}
+	return tokens, nil
+}
+
+// Finds the label an expression adds a constant to when its value depends on where the linker places a section or on a symbol from another object
+func relocatableValue(op operand, symbols map[string]Symbol, fileName string, lineNumber int) (string, int64, bool, *Diagnostic) {
+	val, labels, err := evalExpr(op, symbols, fileName, lineNumber, "")
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	// Move the labels of each section one at a time to see how much the value moves with them
+	target := ""
+	tried := make(map[string]bool)
+	for _, label := range labels {
+		base := labelBase(label, symbols[label])
+		if tried[base] {
+			continue
+		}
+		tried[base] = true
+
+		// Moving the labels can also make the expression fail, such as when one is used as a shift amount
+		shifted, _, err := evalExpr(op, symbols, fileName, lineNumber, base)
+		var diff *big.Int
+		if err == nil {
+			diff = new(big.Int).Sub(shifted, val)
+		}
+		switch {
+		// Differences between labels in the same section do not depend on where it is placed
+		case diff != nil && diff.Sign() == 0:
+		case diff != nil && diff.Cmp(relocShift) == 0 && target == "":
+			target = label
+		default:
+			return "", 0, false, newError(CodeRelocation, fileName, lineNumber, op.column, "Bad value: %s cannot be filled in by the linker", op.text()).suggest("Only a single label plus or minus a constant can be used before the program is linked")
+		}
+	}
+
+	if target == "" {
+		return "", 0, false, nil
+	}
+	return target, val.Int64() - int64(symbols[target].Value), true, nil
+}
+
+// Gets the name of what decides the address of a label, which is either its section or the symbol itself if it is from another object
+func labelBase(name string, sym Symbol) string {
+	if sym.Section == "" {
+		return "symbol " + name
+	}
+	return "section " + sym.Section
+}
+
+// Makes sure a value fits in a field of maxSize bits and gets the bits to place in the field
+func fitValue(val *big.Int, maxSize int, kind valueKind, valName string, op operand, fileName string, lineNumber int) (uint64, *Diagnostic) {
+	fieldSize := new(big.Int).Lsh(big.NewInt(1), uint(maxSize))
+	maxValue := new(big.Int).Sub(fieldSize, big.NewInt(1))
+	minValue := new(big.Int)
+	switch kind {
+	case signedValue:
+		minValue.Neg(new(big.Int).Rsh(fieldSize, 1))
+		maxValue.Rsh(fieldSize, 1).Sub(maxValue, big.NewInt(1))
+	case anyValue:
+		minValue.Neg(new(big.Int).Rsh(fieldSize, 1))
+	}
+
+	if val.Cmp(minValue) < 0 || val.Cmp(maxValue) > 0 {
+		// Show the range in the same base the value was written in
+		base := 10
+		if strings.Contains(strings.ToLower(op.text()), "0x") {
+			base = 16
+		}
+		diag := newError(CodeBadValue, fileName, lineNumber, op.column, "Bad %s value: Value must be between %s and %s (%d bits) but got %s", valName, formatValue(minValue, base, maxSize), formatValue(maxValue, base, maxSize), maxSize, formatValue(val, base, 0))
+
+		// Signed fields used to take the 2's complement bits, so point out the negative value that has the same bits
+		if kind == signedValue && val.Sign() > 0 && val.Cmp(fieldSize) < 0 {
+			diag.suggest("Write %s to get the 2's complement value %s", formatValue(new(big.Int).Sub(val, fieldSize), base, 0), formatValue(val, base, 0))
+		}
+		return 0, diag
+	}
+
+	// Negative values are stored in 2's complement
+	if val.Sign() < 0 {
+		val = new(big.Int).Add(val, fieldSize)
+	}
+	return val.Uint64(), nil
+}
+
+// Gets the text of a value in base 10 or 16, padding hex values to the width of the field
+func formatValue(val *big.Int, base int, maxSize int) string {
+	if base == 10 {
+		return val.String()
+	}
+	sign := ""
+	if val.Sign() < 0 {
+		sign = "-"
+	}
+	digits := strings.ToUpper(new(big.Int).Abs(val).Text(16))
+	width := (maxSize + 3) / 4
+	if len(digits) < width {
+		digits = strings.Repeat("0", width-len(digits)) + digits
+	}
+	return sign + "0x" + digits
+}
+
+// Parses the binary operators at the given precedence level and above
+func (parser *exprParser) parseBinary(level int) (*big.Int, *Diagnostic) {
+	if level == len(binaryOperators) {
+		return parser.parseUnary()
+	}
+
+	left, err := parser.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.pos < len(parser.tokens) && parser.isOperator(parser.tokens[parser.pos], binaryOperators[level]...) {
+		opTok := parser.tokens[parser.pos]
+		parser.pos++
+
+		right, err := parser.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left, err = parser.apply(opTok, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return left, nil
+}
+
+// Computes the result of a binary operator
+func (parser *exprParser) apply(opTok token, left *big.Int, right *big.Int) (*big.Int, *Diagnostic) {
+	out := new(big.Int)
+	switch opTok.text {
+	case "+":
+		out.Add(left, right)
+	case "-":
+		out.Sub(left, right)
+	case "*":
+		out.Mul(left, right)
+	case "/", "%":
+		if right.Sign() == 0 {
+			return nil, newError(CodeBadValue, parser.fileName, parser.lineNumber, opTok.column, "Bad expression: Division by zero")
+		}
+		if opTok.text == "/" {
+			out.Quo(left, right)
+		} else {
+			out.Rem(left, right)
+		}
+	case "<<", ">>":
+		if right.Sign() < 0 || right.Cmp(big.NewInt(maxExprShift)) > 0 {
+			return nil, newError(CodeBadValue, parser.fileName, parser.lineNumber, opTok.column, "Bad expression: Shift amount must be between 0 and %d but got %s", maxExprShift, right.String())
+		}
+		if opTok.text == "<<" {
+			out.Lsh(left, uint(right.Uint64()))
+		} else {
+			out.Rsh(left, uint(right.Uint64()))
+		}
+	case "&":
+		out.And(left, right)
+	case "|":
+		out.Or(left, right)
+	case "^":
+		out.Xor(left, right)
+	}
+	return out, nil
+}
+
+// Parses a value with any unary operators in front of it
+func (parser *exprParser) parseUnary() (*big.Int, *Diagnostic) {
+	if parser.pos < len(parser.tokens) && parser.isOperator(parser.tokens[parser.pos], "-", "+", "~") {
+		opTok := parser.tokens[parser.pos]
+		parser.pos++
+
+		val, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opTok.text {
+		case "-":
+			return new(big.Int).Neg(val), nil
+		case "~":
+			return new(big.Int).Not(val), nil
+		}
+		return val, nil
+	}
+
+	return parser.parsePrimary()
+}
+
+// Parses a number, character, symbol, or expression in parentheses
+func (parser *exprParser) parsePrimary() (*big.Int, *Diagnostic) {
+	if parser.pos >= len(parser.tokens) {
+		return nil, newError(CodeSyntax, parser.fileName, parser.lineNumber, parser.endColumn, "Bad expression: Expected a value")
+	}
+
+	tok := parser.tokens[parser.pos]
+	parser.pos++
+
+	switch {
+	case parser.isOperator(tok, "("):
+		val, err := parser.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if parser.pos >= len(parser.tokens) || !parser.isOperator(parser.tokens[parser.pos], ")") {
+			return nil, newError(CodeSyntax, parser.fileName, parser.lineNumber, tok.column, "Bad expression: Missing ')'").suggest("Add a ')' to close the '(' at column %d", tok.column)
+		}
+		parser.pos++
+		return val, nil
+
+	case tok.kind == tokenNumber:
+		return parser.parseNumber(tok)
+
+	// Symbols use the value of the label or constant
+	case tok.kind == tokenIdent:
+		sym, exists := parser.symbols[tok.text]
+		if !exists {
+			return nil, undefinedSymbol(tok.text, "symbol", parser.symbols, parser.fileName, parser.lineNumber, tok.column)
+		}
+		// Symbols are 64 bits, so values that do not fit in a signed 64-bit number are treated as negative
+		val := big.NewInt(int64(sym.Value))
+		if sym.IsLabel {
+			parser.labels = append(parser.labels, tok.text)
+			if parser.shiftBase != "" && labelBase(tok.text, sym) == parser.shiftBase {
+				val.Add(val, relocShift)
+			}
+		}
+		return val, nil
+	}
+
+	return nil, newError(CodeSyntax, parser.fileName, parser.lineNumber, tok.column, "Bad expression: Expected a value but got %s", tok.text)
+}
+
+// Parses a decimal, hex, binary, or character literal
+func (parser *exprParser) parseNumber(tok token) (*big.Int, *Diagnostic) {
+	text := tok.text
+
+	if strings.HasPrefix(text, "'") {
+		char, _, tail, err := strconv.UnquoteChar(strings.TrimSuffix(text[1:], "'"), '\'')
+		if err != nil || tail != "" || len(text) < 3 || !strings.HasSuffix(text, "'") {
+			return nil, newError(CodeBadValue, parser.fileName, parser.lineNumber, tok.column, "Bad character value: %s must be a single character", text)
+		}
+		return big.NewInt(int64(char)), nil
+	}
+
+	base := 10
+	digits := text
+	switch {
+	case len(text) > 2 && strings.ToLower(text[:2]) == "0x":
+		base = 16
+		digits = text[2:]
+	case len(text) > 2 && strings.ToLower(text[:2]) == "0b":
+		base = 2
+		digits = text[2:]
+	}
+
+	val, ok := new(big.Int).SetString(digits, base)
+	if !ok || strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+		return nil, newError(CodeBadValue, parser.fileName, parser.lineNumber, tok.column, "Bad value: %s is not a number", text)
+	}
+	return val, nil
+}
+
+// Determines if a token is one of the given operators
+func (parser *exprParser) isOperator(tok token, operators ...string) bool {
+	if tok.kind != tokenOperator {
+		return false
+	}
+	for _, operator := range operators {
+		if tok.text == operator {
+			return true
+		}
+	}
+	return false
+}
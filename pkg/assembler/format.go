@@ -0,0 +1,183 @@
+package assembler
+
+import (
+	"strings"
+)
+
+// The indentation of instructions and directives in formatted programs
+const formatIndent = "    "
+
+// The column comments after code are lined up at in formatted programs, matching where the fields start in the listing
+const formatCommentColumn = listingSourceWidth
+
+// Formats a program the standard way: labels on their own line unless they are on a .org or .align line, instructions indented with upper case mnemonics and registers,
+// lower case directives, a single space after each comma, and comments after code lined up in a column.
+// Formatting a formatted program does not change it, and the formatted program assembles into the same bytes.
+// Lines that are part of a block comment are left as they are.
+func Format(src []byte) ([]byte, error) {
+	lines, diags := tokenize(string(src), "")
+	if diags.HasErrors() {
+		return nil, diags.Errors()
+	}
+	if _, diags := parseStatements(lines); diags.HasErrors() {
+		return nil, diags.Errors()
+	}
+	symbols := definedNames(lines)
+
+	out := make([]string, 0, len(lines))
+	inBlockComment := false
+	for _, line := range lines {
+		comment, touchesBlock, blockAfter := splitComment(line, inBlockComment)
+		inBlockComment = blockAfter
+		if touchesBlock {
+			out = append(out, strings.TrimRight(line.text, " \t"))
+			continue
+		}
+
+		tokens := line.tokens
+		if len(tokens) == 0 {
+			// Comments on their own line keep their place at the start of the line or are indented with the code
+			if comment == "" {
+				out = append(out, "")
+			} else if strings.TrimLeft(line.text, " \t") == line.text {
+				out = append(out, comment)
+			} else {
+				out = append(out, formatIndent+comment)
+			}
+			continue
+		}
+
+		// Labels go on their own line, except before a directive that moves the address since the label gets the new address
+		if len(tokens) >= 2 && tokens[1].kind == tokenColon {
+			if len(tokens) == 2 {
+				out = append(out, withComment(tokens[0].text+":", comment))
+				continue
+			}
+			if movesAddress(tokens[2].text) {
+				out = append(out, withComment(tokens[0].text+": "+formatInstruction(tokens[2:], symbols), comment))
+				continue
+			}
+			out = append(out, tokens[0].text+":")
+			tokens = tokens[2:]
+		}
+		out = append(out, withComment(formatIndent+formatInstruction(tokens, symbols), comment))
+	}
+
+	// Runs of blank lines become a single blank line, and there are none at the start or end
+	formatted := make([]string, 0, len(out))
+	for _, line := range out {
+		if line == "" && (len(formatted) == 0 || formatted[len(formatted)-1] == "") {
+			continue
+		}
+		formatted = append(formatted, line)
+	}
+	for len(formatted) > 0 && formatted[len(formatted)-1] == "" {
+		formatted = formatted[:len(formatted)-1]
+	}
+	if len(formatted) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(formatted, "\n") + "\n"), nil
+}
+
+// Determines if a directive starts at a later address than the statement before it ends at
+func movesAddress(opcode string) bool {
+	switch strings.ToUpper(opcode) {
+	case ".ORG", ".ALIGN":
+		return true
+	}
+	return false
+}
+
+// Gets the line comment at the end of a line, if the line is part of a block comment, and if a block comment is still open at the end of the line
+func splitComment(line sourceLine, inBlockComment bool) (string, bool, bool) {
+	text := line.text
+	touchesBlock := inBlockComment
+	tokIndex := 0
+	for i := 0; i < len(text); {
+		switch {
+		case inBlockComment:
+			end := strings.Index(text[i:], "*/")
+			if end == -1 {
+				i = len(text)
+			} else {
+				i += end + 2
+				inBlockComment = false
+			}
+
+		// Skip over the tokens so comment characters in strings are not seen
+		case tokIndex < len(line.tokens) && i == line.tokens[tokIndex].column-1:
+			i += len(line.tokens[tokIndex].text)
+			tokIndex++
+
+		case text[i] == ';' || strings.HasPrefix(text[i:], "//"):
+			return strings.TrimRight(text[i:], " \t"), touchesBlock, false
+
+		case strings.HasPrefix(text[i:], "/*"):
+			inBlockComment = true
+			touchesBlock = true
+			i += 2
+
+		default:
+			i++
+		}
+	}
+	return "", touchesBlock, inBlockComment
+}
+
+// Adds a comment to the end of a line of code, lining it up with the comments on the other lines
+func withComment(code string, comment string) string {
+	if comment == "" {
+		return code
+	}
+	if len(code) < formatCommentColumn {
+		return code + strings.Repeat(" ", formatCommentColumn-len(code)) + comment
+	}
+	return code + " " + comment
+}
+
+// Gets the formatted text of an instruction, directive, or macro call from its tokens
+func formatInstruction(tokens []token, symbols map[string]bool) string {
+	opcode := tokens[0].text
+	upper := strings.ToUpper(opcode)
+	if strings.HasPrefix(opcode, ".") {
+		opcode = strings.ToLower(opcode)
+	} else if isInstruction(upper) || isPseudoInstruction(upper) {
+		opcode = upper
+	}
+
+	// Parsing already made sure the operands are valid
+	operands, _ := splitOperands(tokens[1:], tokens[0], "", 0)
+	if len(operands) == 0 {
+		return opcode
+	}
+	texts := make([]string, len(operands))
+	for i, op := range operands {
+		formatted := operand{tokens: make([]token, len(op.tokens)), column: op.column}
+		for j, tok := range op.tokens {
+			// Registers and keywords are upper case unless they are really the name of a label or constant
+			if tok.kind == tokenIdent && !symbols[tok.text] && (isRegisterName(tok.text) || strings.EqualFold(tok.text, "LSL")) {
+				tok.text = strings.ToUpper(tok.text)
+			}
+			formatted.tokens[j] = tok
+		}
+		texts[i] = formatted.text()
+	}
+	return opcode + " " + strings.Join(texts, ", ")
+}
+
+// Gets the names of the labels and constants defined in the lines
+func definedNames(lines []sourceLine) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range lines {
+		tokens := line.tokens
+		if len(tokens) >= 2 && tokens[0].kind == tokenIdent && tokens[1].kind == tokenColon {
+			names[tokens[0].text] = true
+			tokens = tokens[2:]
+		}
+		if len(tokens) >= 2 && strings.EqualFold(tokens[0].text, ".EQU") && tokens[1].kind == tokenIdent {
+			names[tokens[1].text] = true
+		}
+	}
+	return names
+}
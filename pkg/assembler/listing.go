@@ -0,0 +1,185 @@
+package assembler
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
+)
+
+// Struct for a single line of the listing
+type ListingLine struct {
+	Addr     uint64 `json:"addr"`             // The address of the data placed by the line
+	Data     []byte `json:"data"`             // The bytes placed by the line
+	Fields   string `json:"fields,omitempty"` // The decoded fields of the instruction placed by the line, if any
+	Section  string `json:"section"`          // The section the line places its data in
+	File     string `json:"file"`             // The file the line is in
+	Line     int    `json:"line"`             // The line in the source
+	Source   string `json:"source"`           // The text of the source line, or the generated instruction for expansions
+	Expanded bool   `json:"expanded"`         // If the line is an instruction generated from a pseudo-instruction
+	Macro    string `json:"macro,omitempty"`  // The macro the line was expanded from, if any
+}
+
+// Struct for a symbol in the symbol table of the listing
+type ListingSymbol struct {
+	Name string `json:"name"` // The name of the symbol
+	Symbol
+}
+
+// Struct for the lines of a program side by side with the data they place in the image, followed by the symbol table
+type Listing struct {
+	Lines   []ListingLine   `json:"lines"`   // The lines of the program and the instructions generated for them
+	Symbols []ListingSymbol `json:"symbols"` // The labels and constants in order of value
+}
+
+// The column the decoded fields start in after the source in the text of the listing
+const listingSourceWidth = 40
+
+// Creates the listing for an assembled program
+func newListing(lines []sourceLine, statements []statement, symbols map[string]Symbol, images map[string][]uint8) *Listing {
+	listing := &Listing{Lines: make([]ListingLine, 0, len(lines)), Symbols: make([]ListingSymbol, 0, len(symbols))}
+	stmtIndex := 0
+	section := textSection
+
+	for lineIndex, line := range lines {
+		srcLine := ListingLine{File: line.fileName, Line: line.lineNumber, Source: line.text, Macro: line.macro, Section: section}
+
+		// Pseudo-instructions show the instructions they were replaced with under the source line
+		expansions := make([]ListingLine, 0)
+		for ; stmtIndex < len(statements) && statements[stmtIndex].lineIndex == lineIndex; stmtIndex++ {
+			stmt := statements[stmtIndex]
+			section = stmt.section
+			srcLine.Section = section
+			if stmt.size == 0 {
+				continue
+			}
+			image := images[stmt.section]
+			data := image[stmt.addr : stmt.addr+stmt.size]
+
+			// Data that only looks like an instruction does not get decoded
+			var instr disassembler.Instruction
+			fields := ""
+			if isInstruction(stmt.opcode) {
+				instr = disassembler.Decode(uint32(getValueAt(image, stmt.addr, 4)))
+				if stmt.opcode != "DATA" {
+					fields = instr.Fields()
+				}
+			}
+
+			if stmt.pseudo != "" {
+				expansions = append(expansions, ListingLine{
+					Addr:     stmt.addr,
+					Data:     data,
+					Fields:   fields,
+					Section:  section,
+					File:     line.fileName,
+					Line:     line.lineNumber,
+					Source:   instr.String(),
+					Expanded: true,
+					Macro:    line.macro,
+				})
+			} else {
+				srcLine.Addr = stmt.addr
+				srcLine.Data = data
+				srcLine.Fields = fields
+			}
+		}
+
+		listing.Lines = append(listing.Lines, srcLine)
+		listing.Lines = append(listing.Lines, expansions...)
+	}
+
+	for name, sym := range symbols {
+		listing.Symbols = append(listing.Symbols, ListingSymbol{Name: name, Symbol: sym})
+	}
+	sort.Slice(listing.Symbols, func(i, j int) bool {
+		if listing.Symbols[i].Value != listing.Symbols[j].Value {
+			return listing.Symbols[i].Value < listing.Symbols[j].Value
+		}
+		return listing.Symbols[i].Name < listing.Symbols[j].Name
+	})
+
+	return listing
+}
+
+// Gets the big-endian value of size bytes at the address
+func getValueAt(image []uint8, addr uint64, size uint64) uint64 {
+	val := uint64(0)
+	for _, b := range image[addr : addr+size] {
+		val = val<<8 | uint64(b)
+	}
+	return val
+}
+
+// Gets the text of the listing with the address, data, line number, source, and fields of each line, followed by the symbol table
+func (listing *Listing) String() string {
+	var str strings.Builder
+	fileName := ""
+	section := textSection
+	for i, line := range listing.Lines {
+		// Mark where the listing switches to another file, ignoring macros that were defined in other files
+		if line.Macro == "" && line.File != fileName {
+			if i > 0 {
+				str.WriteString(fmt.Sprintf("%37s; %s\n", "", line.File))
+			}
+			fileName = line.File
+		}
+
+		// Mark where the listing switches to another section, since the addresses start over in each section
+		if line.Section != section {
+			str.WriteString(fmt.Sprintf("%37s; section %s\n", "", line.Section))
+			section = line.Section
+		}
+
+		// Lines that do not place anything leave the address and data empty
+		addr := ""
+		if len(line.Data) > 0 {
+			addr = fmt.Sprintf("%08X", line.Addr)
+		}
+
+		// Only show the first 8 bytes of long data
+		data := fmt.Sprintf("%X", line.Data)
+		if len(line.Data) > 8 {
+			data = fmt.Sprintf("%X+", line.Data[:8])
+		}
+
+		// Lines that are not in the source are indented under the line they came from
+		var text string
+		if line.Expanded || line.Macro != "" {
+			text = fmt.Sprintf("%-8s  %-17s  %5s      %s", addr, data, "", line.Source)
+		} else {
+			text = fmt.Sprintf("%-8s  %-17s  %5d  %s", addr, data, line.Line, line.Source)
+		}
+
+		// The decoded fields line up to the right of the source
+		if line.Fields != "" {
+			text = fmt.Sprintf("%-*s  %s", 37+listingSourceWidth, text, line.Fields)
+		}
+		str.WriteString(strings.TrimRight(text, " "))
+		str.WriteString("\n")
+	}
+
+	if len(listing.Symbols) > 0 {
+		str.WriteString("\nSymbols:\n")
+		for _, sym := range listing.Symbols {
+			kind := "constant"
+			if sym.IsLabel {
+				kind = "label"
+			}
+			// Defines do not come from a line of the program
+			location := fmt.Sprintf("%s:%d", sym.File, sym.Line)
+			if sym.Line == 0 {
+				location = "-D"
+			}
+			str.WriteString(fmt.Sprintf("%016X  %-8s  %-8s  %-24s  %s\n", sym.Value, kind, sym.Section, sym.Name, location))
+		}
+	}
+	return str.String()
+}
+
+// Writes the text of the listing to a file
+func (listing *Listing) WriteFile(filePath string) error {
+	return os.WriteFile(filePath, []byte(listing.String()), 0644)
+}
@@ -0,0 +1,208 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The prefix of labels that can only be used between the label before them and the next label
+const scopedLabelPrefix = ".L"
+
+// Determines if a symbol name was made unique by the assembler for a local label or a label in a macro.
+// These names have an '@', which cannot be written in a program.
+func IsGeneratedName(name string) bool {
+	return strings.Contains(name, "@")
+}
+
+// Determines if a name is a numeric label, such as the 1 in 1:
+func isNumericLabel(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isDigit(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Determines if a name is a reference to a numeric label, such as 1b for the closest 1: before it or 1f for the closest one after it
+func isNumericReference(name string) bool {
+	if len(name) < 2 {
+		return false
+	}
+	last := name[len(name)-1]
+	return (last == 'b' || last == 'f') && isNumericLabel(name[:len(name)-1])
+}
+
+// Determines if a name is a label that is local to the label before it, such as .Lloop
+func isScopedLabel(name string) bool {
+	return len(name) > len(scopedLabelPrefix) && strings.HasPrefix(name, scopedLabelPrefix) && !IsGeneratedName(name)
+}
+
+// Determines if a name can only refer to a label in the same part of the program, so it can never come from another object
+func isLocalLabelName(name string) bool {
+	return isNumericReference(name) || isScopedLabel(name)
+}
+
+// Gets the name of the nth definition of a numeric label, which is unique to that definition
+func numericLabelName(name string, n int) string {
+	// '@' cannot be written in a program, so the name cannot clash with any other label
+	return fmt.Sprintf("%s@%d", name, n)
+}
+
+// Gets the name of a scoped label inside the given label, which is unique to that label
+func scopedLabelName(name string, scope string) string {
+	return name + "@" + scope
+}
+
+// Gets the label defined at the start of a line, if there is one
+func definedLabel(line sourceLine) (string, bool) {
+	if label, _ := splitLabel(line.tokens); len(label) > 0 {
+		return label[0].text, true
+	}
+	return "", false
+}
+
+// Gives numeric labels and scoped labels names that are unique to where they are defined and points the references to them at those names.
+// References that do not match a definition are left as they are so they are reported as undefined.
+// Also gets where each definition and reference outside of macros is written, so tools can find what a name refers to without renaming it themselves.
+func resolveLocalLabels(lines []sourceLine) ([]sourceLine, []Reference) {
+	// Find the label each line is under and where each local label is defined
+	scopes := make([]string, len(lines))
+	scopedDefs := make(map[string]map[string]bool)
+	numericDefs := make(map[string][]int)
+	scope := ""
+	for i, line := range lines {
+		if name, isLabel := definedLabel(line); isLabel {
+			switch {
+			case isNumericLabel(name):
+				numericDefs[name] = append(numericDefs[name], i)
+			case isScopedLabel(name):
+				if scopedDefs[name] == nil {
+					scopedDefs[name] = make(map[string]bool)
+				}
+				scopedDefs[name][scope] = true
+			// Labels inside macros are unique to each use, so they do not start a new scope
+			case line.macro == "" && !IsGeneratedName(name):
+				scope = name
+			}
+		}
+		scopes[i] = scope
+	}
+
+	out := make([]sourceLine, len(lines))
+	refs := make([]Reference, 0)
+	for i, line := range lines {
+		out[i] = line
+		if len(line.tokens) == 0 {
+			continue
+		}
+		tokens := make([]token, len(line.tokens))
+		copy(tokens, line.tokens)
+
+		// The opcode is never a label
+		opcodeIndex := 0
+		if _, isLabel := definedLabel(line); isLabel {
+			opcodeIndex = 2
+		}
+
+		for j := range tokens {
+			tok := &tokens[j]
+			if j == opcodeIndex {
+				continue
+			}
+			prefix, name := "", tok.text
+			switch tok.kind {
+			case tokenImmediate:
+				prefix, name = "#", tok.text[1:]
+			case tokenIdent, tokenNumber:
+			default:
+				continue
+			}
+
+			renamed := ""
+			switch {
+			// The definition of a numeric label
+			case j == 0 && opcodeIndex == 2 && isNumericLabel(name):
+				renamed = numericLabelName(name, indexOf(numericDefs[name], i))
+
+			case tok.kind != tokenIdent && isNumericReference(name):
+				renamed = name
+				label := name[:len(name)-1]
+				if def := closestDefinition(numericDefs[label], i, name[len(name)-1] == 'f'); def != -1 {
+					renamed = numericLabelName(label, indexOf(numericDefs[label], def))
+				}
+
+			case tok.kind != tokenNumber && scopedDefs[name][scopes[i]]:
+				renamed = scopedLabelName(name, scopes[i])
+
+			default:
+				continue
+			}
+
+			// The columns of lines from macros are in the macro, not where the macro is used
+			if line.macro == "" && renamed != name {
+				refs = append(refs, Reference{Name: name, Symbol: renamed, Line: line.lineNumber, Column: tok.column + len(prefix), File: line.fileName})
+			}
+			tok.text = prefix + renamed
+			if prefix == "" {
+				tok.kind = tokenIdent
+			}
+		}
+		out[i].tokens = tokens
+	}
+	return out, refs
+}
+
+// Finds the line of the closest definition before or on the given line, or after it when forward is set, returning -1 if there is none
+func closestDefinition(defs []int, lineIndex int, forward bool) int {
+	closest := -1
+	for _, def := range defs {
+		if forward && def > lineIndex {
+			return def
+		}
+		if !forward && def <= lineIndex {
+			closest = def
+		}
+	}
+	return closest
+}
+
+// Gets the position of a line in a list of definitions, counting from 1
+func indexOf(defs []int, lineIndex int) int {
+	for i, def := range defs {
+		if def == lineIndex {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Gets the suggestion for a local label that is not defined where it is used, or "" if the name is not a local label
+func localLabelHint(name string, symbols map[string]Symbol) string {
+	switch {
+	case isNumericReference(name) && name[len(name)-1] == 'b':
+		return fmt.Sprintf("%s refers to the closest %s: before it, but there is none", name, name[:len(name)-1])
+	case isNumericReference(name):
+		return fmt.Sprintf("%s refers to the closest %s: after it, but there is none", name, name[:len(name)-1])
+	case isScopedLabel(name):
+		scopes := make([]string, 0)
+		for symName := range symbols {
+			if scope := strings.TrimPrefix(symName, name+"@"); scope != symName {
+				scopes = append(scopes, scope)
+			}
+		}
+		if len(scopes) == 0 {
+			return ""
+		}
+		sort.Strings(scopes)
+		if scopes[0] == "" {
+			return fmt.Sprintf("%s is defined before the first label, so it can only be used before the first label", name)
+		}
+		return fmt.Sprintf("%s is local to %s, so it can only be used between %s and the next label", name, scopes[0], scopes[0])
+	}
+	return ""
+}
@@ -0,0 +1,463 @@
+package assembler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/joshuaseligman/GoVM/pkg/sourcemap"
+)
+
+// The section instructions and data go in when no other section is chosen
+const textSection = ".text"
+
+// The section the .data directive switches to
+const dataSection = ".data"
+
+// The smallest alignment of a section in bytes, which keeps the instructions in it word aligned
+const minSectionAlign = 4
+
+// Struct for keeping track of a section while laying out a program
+type section struct {
+	name  string // The name of the section
+	addr  uint64 // The address to continue at when switching back to the section
+	size  uint64 // The number of bytes in the section
+	align uint64 // The alignment the start of the section needs in bytes
+}
+
+// The kinds of values the linker fills in
+type RelocationType int
+
+const (
+	RelocBranch26 RelocationType = iota // The word offset to the symbol in a B or BL instruction
+	RelocBranch19                       // The word offset to the symbol in a CB instruction, including B.cond
+	RelocMovWide                        // The 16 bits of the address that the shift of a MOVZ or MOVK from MOVI picks out
+	RelocMov16                          // The address in the immediate of a MOVZ or MOVK, which must fit in 16 bits
+	RelocAbs32                          // A 32-bit address in data
+	RelocAbs64                          // A 64-bit address in data
+)
+
+// Struct for a value in a section that the linker fills in once it knows the address of a symbol
+type Relocation struct {
+	Section string         `json:"section"`         // The section the value is in
+	Offset  uint64         `json:"offset"`          // The address of the instruction or data in the section
+	Type    RelocationType `json:"type"`            // How the value is filled in
+	Symbol  string         `json:"symbol"`          // The symbol whose address the value is based on
+	Addend  int64          `json:"addend"`          // The constant added to the address of the symbol
+	Shift   uint64         `json:"shift,omitempty"` // The shift of a MOVZ or MOVK from MOVI
+	File    string         `json:"file"`            // The file the value is in
+	Line    int            `json:"line"`            // The line the value is on
+}
+
+// Struct for a symbol in the symbol table of an object
+type ObjectSymbol struct {
+	Name string `json:"name"` // The name of the symbol
+	Symbol
+	Global  bool `json:"global"`  // If other objects can use the symbol
+	Defined bool `json:"defined"` // If the symbol is defined in the object rather than in another one
+}
+
+// Struct for a section of an object
+type Section struct {
+	Name      string              `json:"name"`      // The name of the section
+	Align     uint64              `json:"align"`     // The alignment the start of the section needs in bytes
+	Data      []uint8             `json:"data"`      // The bytes in the section
+	SourceMap sourcemap.SourceMap `json:"sourceMap"` // The lines that placed each part of the section, with addresses relative to the start of the section
+}
+
+// Struct for a program that has been assembled but not given its final addresses
+type Object struct {
+	Name        string         `json:"name"`        // The name of the file the object was assembled from
+	Sections    []Section      `json:"sections"`    // The sections in the order they first appear in the program
+	Symbols     []ObjectSymbol `json:"symbols"`     // The symbols defined and used in the object in order of name
+	Relocations []Relocation   `json:"relocations"` // The values the linker needs to fill in
+}
+
+// Gets the name of the relocation type
+func (relocType RelocationType) String() string {
+	switch relocType {
+	case RelocBranch26:
+		return "branch26"
+	case RelocBranch19:
+		return "branch19"
+	case RelocMovWide:
+		return "mov-wide"
+	case RelocMov16:
+		return "mov16"
+	case RelocAbs32:
+		return "abs32"
+	default:
+		return "abs64"
+	}
+}
+
+// Function that creates a new empty section
+func newSection(name string) *section {
+	return &section{name: name, align: minSectionAlign}
+}
+
+// Finds the section with the given name, adding it to the end of the sections if it is new
+func findSection(sections *[]*section, name string) *section {
+	for _, sec := range *sections {
+		if sec.name == name {
+			return sec
+		}
+	}
+	sec := newSection(name)
+	*sections = append(*sections, sec)
+	return sec
+}
+
+// Determines if an opcode switches to another section
+func isSectionDirective(opcode string) bool {
+	return opcode == ".TEXT" || opcode == ".DATA" || opcode == ".SECTION"
+}
+
+// Gets the section a section directive switches to
+func getSectionName(stmt statement, fileName string) (string, *Diagnostic) {
+	switch stmt.opcode {
+	case ".TEXT", ".DATA":
+		if err := checkOperandCount(stmt, 0, fileName); err != nil {
+			return "", err
+		}
+		if stmt.opcode == ".TEXT" {
+			return textSection, nil
+		}
+		return dataSection, nil
+	default:
+		if err := checkOperandCount(stmt, 1, fileName); err != nil {
+			return "", err
+		}
+		nameOp := stmt.operands[0]
+		if len(nameOp.tokens) != 1 || nameOp.tokens[0].kind != tokenIdent {
+			return "", newError(CodeSyntax, fileName, stmt.lineNumber, nameOp.column, "Bad section name: %s", nameOp.text()).suggest("Section names are written like .rodata")
+		}
+		return nameOp.tokens[0].text, nil
+	}
+}
+
+// Gets the names of the symbols a .global directive makes available to other objects
+func getGlobalNames(stmt statement, fileName string) ([]string, *Diagnostic) {
+	if len(stmt.operands) == 0 {
+		return nil, newError(CodeOperandCount, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid directive format: Expected at least 1 symbol")
+	}
+	names := make([]string, len(stmt.operands))
+	for i, op := range stmt.operands {
+		if len(op.tokens) != 1 || op.tokens[0].kind != tokenIdent {
+			return nil, newError(CodeSyntax, fileName, stmt.lineNumber, op.column, "Bad symbol name: %s", op.text())
+		}
+		names[i] = op.tokens[0].text
+	}
+	return names, nil
+}
+
+// Assembles the laid out statements of a program into an object, leaving the values that depend on where the sections are placed for the linker
+func assembleObject(res *Result, lines []sourceLine, statements []statement, sections []*section, opts Options) (*Result, error) {
+	// Every section has to fit in memory on its own and together with the others
+	maxSize := maxProgramSize(opts)
+	totalSize := uint64(0)
+	for _, sec := range sections {
+		if sec.size > maxSize {
+			res.Diagnostics = append(res.Diagnostics, newError(CodeProgramSize, opts.FileName, 0, 0, "Section is too large: Section %s needs %d bytes but the limit is %d bytes", sec.name, sec.size, maxSize))
+			return res, res.Diagnostics.Errors()
+		}
+		totalSize += sec.size
+	}
+	if totalSize > maxSize {
+		res.Diagnostics = append(res.Diagnostics, newError(CodeProgramSize, opts.FileName, 0, 0, "Program is too large: Program needs %d bytes but the limit is %d bytes", totalSize, maxSize))
+		return res, res.Diagnostics.Errors()
+	}
+
+	images := make(map[string][]uint8, len(sections))
+	sourceMaps := make(map[string]sourcemap.SourceMap, len(sections))
+	for _, sec := range sections {
+		images[sec.name] = make([]uint8, sec.size)
+		sourceMaps[sec.name] = make(sourcemap.SourceMap, 0)
+	}
+
+	// Symbols that are used where the linker can fill them in but are never defined are expected to be in another object
+	linkSymbols := make(map[string]Symbol, len(res.Symbols))
+	for name, sym := range res.Symbols {
+		linkSymbols[name] = sym
+	}
+	externs := findExterns(statements, res.Symbols)
+	for _, name := range externs {
+		linkSymbols[name] = Symbol{IsLabel: true}
+	}
+
+	// Assemble the program statement by statement, leaving 0s where the linker fills in values
+	relocations := make([]Relocation, 0)
+	for _, stmt := range statements {
+		stmtRelocs, emitStmt, diag := findRelocations(stmt, linkSymbols)
+		if diag == nil {
+			diag = emitStatement(images[stmt.section], emitStmt, linkSymbols, stmt.fileName)
+		}
+		if diag != nil {
+			res.Diagnostics = append(res.Diagnostics, diag)
+			continue
+		}
+		relocations = append(relocations, stmtRelocs...)
+
+		if stmt.size > 0 {
+			sourceMaps[stmt.section] = append(sourceMaps[stmt.section], sourcemap.Entry{Addr: stmt.addr, Size: stmt.size, File: stmt.fileName, Line: stmt.lineNumber, Column: stmt.opcodeColumn})
+		}
+	}
+
+	res.Diagnostics = append(res.Diagnostics, findWarnings(statements)...)
+	res.Diagnostics = sortDiagnostics(res.Diagnostics)
+	if res.Diagnostics.HasErrors() {
+		return res, res.Diagnostics.Errors()
+	}
+
+	obj := &Object{
+		Name:        opts.FileName,
+		Sections:    make([]Section, 0, len(sections)),
+		Symbols:     make([]ObjectSymbol, 0, len(res.Symbols)+len(externs)),
+		Relocations: relocations,
+	}
+	for _, sec := range sections {
+		obj.Sections = append(obj.Sections, Section{Name: sec.name, Align: sec.align, Data: images[sec.name], SourceMap: sourceMaps[sec.name]})
+	}
+
+	globals := findGlobals(statements)
+	for name, sym := range res.Symbols {
+		obj.Symbols = append(obj.Symbols, ObjectSymbol{Name: name, Symbol: sym, Global: globals[name], Defined: true})
+	}
+	for _, name := range externs {
+		obj.Symbols = append(obj.Symbols, ObjectSymbol{Name: name, Symbol: Symbol{IsLabel: true}, Global: true})
+	}
+	sort.Slice(obj.Symbols, func(i, j int) bool {
+		return obj.Symbols[i].Name < obj.Symbols[j].Name
+	})
+
+	res.Object = obj
+	if opts.Listing {
+		res.Listing = newListing(lines, statements, res.Symbols, images)
+	}
+	return res, nil
+}
+
+// Gets the relocation type of each operand of a statement that the linker can fill in
+func relocationTypes(stmt statement) map[int]RelocationType {
+	types := make(map[int]RelocationType)
+	switch stmt.opcode {
+	case "B", "BL":
+		types[0] = RelocBranch26
+	case "CBZ", "CBNZ":
+		types[1] = RelocBranch19
+	case "B.EQ", "B.NE", "B.HS", "B.LO", "B.MI", "B.PL", "B.VS", "B.VC",
+		"B.HI", "B.LS", "B.GE", "B.LT", "B.GT", "B.LE":
+		types[0] = RelocBranch19
+	case "MOVZ", "MOVK":
+		if stmt.wideImm {
+			types[1] = RelocMovWide
+		} else {
+			types[1] = RelocMov16
+		}
+	case "DATA":
+		types[0] = RelocAbs32
+	case ".WORD", ".DWORD":
+		for i := range stmt.operands {
+			if stmt.opcode == ".WORD" {
+				types[i] = RelocAbs32
+			} else {
+				types[i] = RelocAbs64
+			}
+		}
+	}
+	return types
+}
+
+// Determines if an operand of a statement is a value rather than a register, name, string, or shift
+func isValueOperand(stmt statement, index int) bool {
+	op := stmt.operands[index]
+	switch stmt.opcode {
+	case ".ORG", ".ALIGN", ".SPACE", ".BYTE", ".HWORD", ".WORD", ".DWORD":
+		return op.tokens[0].kind != tokenString
+	case ".EQU":
+		return index == 1
+	}
+	return !isDirective(stmt.opcode) && op.tokens[0].kind == tokenImmediate
+}
+
+// Finds the names that are used where the linker can fill them in but are never defined, in the order they are first used
+func findExterns(statements []statement, symbols map[string]Symbol) []string {
+	externs := make([]string, 0)
+	found := make(map[string]bool)
+	for _, stmt := range statements {
+		for index := range relocationTypes(stmt) {
+			if index >= len(stmt.operands) {
+				continue
+			}
+			tokens, diag := exprTokens(stmt.operands[index], stmt.fileName, stmt.lineNumber)
+			if diag != nil {
+				continue
+			}
+			for _, tok := range tokens {
+				// Local labels always refer to a label in the same object
+				if _, defined := symbols[tok.text]; tok.kind == tokenIdent && !defined && !found[tok.text] && !isLocalLabelName(tok.text) {
+					found[tok.text] = true
+					externs = append(externs, tok.text)
+				}
+			}
+		}
+	}
+	return externs
+}
+
+// Finds the names of the symbols that the program makes available to other objects
+func findGlobals(statements []statement) map[string]bool {
+	globals := make(map[string]bool)
+	for _, stmt := range statements {
+		if stmt.opcode == ".GLOBAL" || stmt.opcode == ".GLOBL" {
+			names, _ := getGlobalNames(stmt, stmt.fileName)
+			for _, name := range names {
+				globals[name] = true
+			}
+		}
+	}
+	return globals
+}
+
+// Finds the values in a statement that the linker needs to fill in, returning the statement with 0 in their place
+func findRelocations(stmt statement, symbols map[string]Symbol) ([]Relocation, statement, *Diagnostic) {
+	relocs := make([]Relocation, 0)
+	types := relocationTypes(stmt)
+	operands := make([]operand, len(stmt.operands))
+	copy(operands, stmt.operands)
+
+	for i, op := range stmt.operands {
+		relocType, canRelocate := types[i]
+		reloc := Relocation{Section: stmt.section, Offset: stmt.addr, Type: relocType, File: stmt.fileName, Line: stmt.lineNumber}
+
+		if (relocType == RelocBranch26 || relocType == RelocBranch19) && canRelocate && op.tokens[0].kind == tokenIdent {
+			// Branches to labels in the same section do not depend on where the section is placed
+			target, exists := symbols[op.tokens[0].text]
+			if len(op.tokens) != 1 || !exists || !target.IsLabel || target.Section == stmt.section {
+				continue
+			}
+			reloc.Symbol = op.tokens[0].text
+		} else if isValueOperand(stmt, i) {
+			target, addend, isReloc, diag := relocatableValue(op, symbols, stmt.fileName, stmt.lineNumber)
+			if diag != nil {
+				// Values that cannot be worked out are reported when the statement is assembled
+				if diag.Code == CodeRelocation {
+					return nil, stmt, diag
+				}
+				continue
+			}
+			if !isReloc {
+				continue
+			}
+			if !canRelocate {
+				return nil, stmt, newError(CodeRelocation, stmt.fileName, stmt.lineNumber, op.column, "Bad value: The address of %s is not known until the program is linked", target).suggest("Load the address into a register with MOVI")
+			}
+			// Branch immediates are offsets rather than addresses, so only a label can be used to branch to another section
+			if relocType == RelocBranch26 || relocType == RelocBranch19 {
+				return nil, stmt, newError(CodeRelocation, stmt.fileName, stmt.lineNumber, op.column, "Bad branch address value: The address of %s is not known until the program is linked", target).suggest("Branch to %s without a '#'", target)
+			}
+			reloc.Symbol = target
+			reloc.Addend = addend
+		} else {
+			continue
+		}
+
+		switch relocType {
+		case RelocMovWide:
+			reloc.Shift, _ = getShift(stmt.operands[2], stmt.fileName, stmt.lineNumber)
+		case RelocAbs32:
+			reloc.Offset += uint64(i * 4)
+		case RelocAbs64:
+			reloc.Offset += uint64(i * 8)
+		}
+		relocs = append(relocs, reloc)
+		operands[i] = immOperand("#0", op.column)
+	}
+
+	stmt.operands = operands
+	return relocs, stmt, nil
+}
+
+// Writes the object to a file that can be given to the linker
+func (obj *Object) WriteFile(filePath string) error {
+	data, err := json.MarshalIndent(obj, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// Reads an object that was written with WriteFile
+func ReadObjectFile(filePath string) (*Object, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// The largest alignment a section can need, which is the most .align can ask for
+const maxSectionAlign = 1 << 15
+
+// Gets the number of bytes a relocation fills in, or 0 if the type is not known
+func (reloc Relocation) size() uint64 {
+	switch reloc.Type {
+	case RelocBranch26, RelocBranch19, RelocMovWide, RelocMov16, RelocAbs32:
+		return 4
+	case RelocAbs64:
+		return 8
+	}
+	return 0
+}
+
+// Makes sure everything in an object that was read from a file is inside its sections,
+// so a corrupt or edited object cannot make the linker write outside of the image
+func (obj *Object) Validate() error {
+	sections := make(map[string]Section, len(obj.Sections))
+	for _, sec := range obj.Sections {
+		if _, exists := sections[sec.Name]; exists {
+			return fmt.Errorf("Bad object %s: Section %s appears more than once", obj.Name, sec.Name)
+		}
+		if sec.Align > maxSectionAlign || sec.Align&(sec.Align-1) != 0 {
+			return fmt.Errorf("Bad object %s: Section %s has an alignment of %d, which is not a power of 2 up to %d", obj.Name, sec.Name, sec.Align, maxSectionAlign)
+		}
+		sections[sec.Name] = sec
+	}
+
+	for _, sym := range obj.Symbols {
+		if !sym.Defined || sym.Section == "" {
+			continue
+		}
+		sec, exists := sections[sym.Section]
+		if !exists {
+			return fmt.Errorf("Bad object %s: Symbol %s is in section %s, which is not in the object", obj.Name, sym.Name, sym.Section)
+		}
+		// A label can be right after the last byte of its section
+		if sym.Value > uint64(len(sec.Data)) {
+			return fmt.Errorf("Bad object %s: Symbol %s is at offset 0x%X, which is past the end of section %s", obj.Name, sym.Name, sym.Value, sym.Section)
+		}
+	}
+
+	for _, reloc := range obj.Relocations {
+		sec, exists := sections[reloc.Section]
+		if !exists {
+			return fmt.Errorf("Bad object %s: Relocation for %s is in section %s, which is not in the object", obj.Name, reloc.Symbol, reloc.Section)
+		}
+		size := reloc.size()
+		if size == 0 {
+			return fmt.Errorf("Bad object %s: Relocation for %s has unknown type %d", obj.Name, reloc.Symbol, reloc.Type)
+		}
+		if reloc.Offset > uint64(len(sec.Data)) || size > uint64(len(sec.Data))-reloc.Offset {
+			return fmt.Errorf("Bad object %s: Relocation for %s at offset 0x%X needs %d bytes past the end of section %s", obj.Name, reloc.Symbol, reloc.Offset, size, reloc.Section)
+		}
+	}
+	return nil
+}
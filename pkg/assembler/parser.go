@@ -0,0 +1,124 @@
+package assembler
+
+import "strings"
+
+// Struct for an operand of an instruction, which can be made up of multiple tokens
+type operand struct {
+	tokens []token // The tokens that make up the operand
+	column int     // The column the operand starts in
+}
+
+// Struct for a single parsed line of the program
+type statement struct {
+	label        string    // The label defined on the line, if any
+	labelColumn  int       // The column of the label
+	opcode       string    // The upper case opcode, if any
+	opcodeColumn int       // The column of the opcode
+	operands     []operand // The operands of the instruction
+	lineNumber   int       // The line the statement is on
+	fileName     string    // The file the statement is in
+	lineIndex    int       // The index of the line the statement came from
+	section      string    // The section the statement places its data in
+	addr         uint64    // The address of the statement in its section
+	size         uint64    // The number of bytes the statement places in the program
+	pseudo       string    // The pseudo-instruction the statement was expanded from, if any
+	wideImm      bool      // If the immediate of a move is a 64-bit value that the shift picks 16 bits from
+}
+
+// Gets the text of the operand, with a space between tokens that were not written right next to each other
+func (op operand) text() string {
+	var str strings.Builder
+	for i, tok := range op.tokens {
+		if i > 0 {
+			prev := op.tokens[i-1]
+			if tok.column != prev.column+len(prev.text) {
+				str.WriteString(" ")
+			}
+		}
+		str.WriteString(tok.text)
+	}
+	return str.String()
+}
+
+// Parses the tokenized lines into statements, skipping lines that are empty
+func parseStatements(lines []sourceLine) ([]statement, Diagnostics) {
+	statements := make([]statement, 0)
+	diags := make(Diagnostics, 0)
+
+	for lineIndex, line := range lines {
+		tokens := line.tokens
+		if len(tokens) == 0 {
+			continue
+		}
+
+		fileName := line.fileName
+		stmt := statement{lineNumber: line.lineNumber, fileName: fileName, lineIndex: lineIndex}
+
+		// Get the label if the line starts with one
+		if label, rest := splitLabel(tokens); len(label) > 0 {
+			stmt.label = tokens[0].text
+			stmt.labelColumn = tokens[0].column
+			tokens = rest
+		} else if tokens[0].kind == tokenColon || len(tokens) >= 2 && tokens[1].kind == tokenColon {
+			diags = append(diags, newError(CodeSyntax, fileName, line.lineNumber, tokens[0].column, "Bad label name: %s", tokens[0].text).suggest("Labels must start with a letter, '_', or '.', or be a number such as 1"))
+			continue
+		}
+
+		// Get the opcode if there is an instruction after the label
+		if len(tokens) > 0 {
+			if tokens[0].kind != tokenIdent {
+				diags = append(diags, newError(CodeSyntax, fileName, line.lineNumber, tokens[0].column, "Expected an opcode but got %s", tokens[0].text))
+			} else if operands, diag := splitOperands(tokens[1:], tokens[0], fileName, line.lineNumber); diag != nil {
+				diags = append(diags, diag)
+			} else {
+				stmt.opcode = strings.ToUpper(tokens[0].text)
+				stmt.opcodeColumn = tokens[0].column
+				stmt.operands = operands
+			}
+
+			// Keep the label of a bad line so it does not cause more errors later on
+			if stmt.opcode == "" && stmt.label == "" {
+				continue
+			}
+		}
+
+		statements = append(statements, stmt)
+	}
+
+	return statements, diags
+}
+
+// Splits the tokens after the opcode into comma-separated operands
+func splitOperands(tokens []token, opcodeTok token, fileName string, lineNumber int) ([]operand, *Diagnostic) {
+	operands := make([]operand, 0)
+	if len(tokens) == 0 {
+		return operands, nil
+	}
+
+	// Empty operands are reported at the comma that follows them
+	cur := operand{column: tokens[0].column}
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokenComma:
+			if len(cur.tokens) == 0 {
+				return nil, newError(CodeSyntax, fileName, lineNumber, tok.column, "Missing operand before ','")
+			}
+			operands = append(operands, cur)
+			cur = operand{column: tok.column + 1}
+		case tokenColon:
+			return nil, newError(CodeSyntax, fileName, lineNumber, tok.column, "Unexpected ':' in operands of %s", opcodeTok.text)
+		default:
+			if len(cur.tokens) == 0 {
+				cur.column = tok.column
+			}
+			cur.tokens = append(cur.tokens, tok)
+		}
+	}
+
+	if len(cur.tokens) == 0 {
+		return nil, newError(CodeSyntax, fileName, lineNumber, cur.column, "Missing operand after ','")
+	}
+	operands = append(operands, cur)
+
+	return operands, nil
+}
@@ -0,0 +1,395 @@
+package assembler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The deepest that macros and included files can be nested, which stops programs that include or expand themselves forever
+const maxNestingDepth = 64
+
+// The most lines that macro expansions can add to a program, which stops macros that expand themselves more than once from taking forever
+const maxExpandedLines = 100000
+
+// Struct for a macro defined in the program
+type macro struct {
+	name       string          // The name of the macro as it was written
+	params     []string        // The names of the parameters
+	body       []sourceLine    // The lines between .macro and .endm
+	labels     map[string]bool // The labels defined in the body, which are unique to each expansion
+	fileName   string          // The file the macro is defined in
+	lineNumber int             // The line the macro is defined on
+}
+
+// Struct for the state of the preprocessor
+type preprocessor struct {
+	opts          Options           // The options the program is being assembled with
+	macros        map[string]*macro // The macros defined so far by upper case name
+	includeStack  []string          // The paths of the files currently being included, used to find cycles
+	expansions    int               // The number of macros expanded so far, used to make local labels unique
+	expandedLines int               // The number of lines macro expansions have added so far
+	constants     map[string]Symbol // The defines and the constants defined so far, which conditions can use
+	unknowns      map[string]bool   // The labels and constants defined so far whose values are not known until the program is laid out
+	diags         Diagnostics       // The problems found so far
+}
+
+// Brings in included files, expands macros, and removes the lines conditions leave out, returning the lines that make up the whole program
+func preprocess(lines []sourceLine, opts Options, defines map[string]Symbol) ([]sourceLine, Diagnostics) {
+	pp := &preprocessor{
+		opts:         opts,
+		macros:       make(map[string]*macro),
+		includeStack: make([]string, 0),
+		constants:    make(map[string]Symbol),
+		unknowns:     make(map[string]bool),
+		diags:        make(Diagnostics, 0),
+	}
+	for name, sym := range defines {
+		pp.constants[name] = sym
+	}
+	if opts.FileName != "" {
+		if path, err := filepath.Abs(opts.FileName); err == nil {
+			pp.includeStack = append(pp.includeStack, path)
+		}
+	}
+
+	return pp.process(make([]sourceLine, 0, len(lines)), lines, 0), pp.diags
+}
+
+// Processes the lines of a file or macro expansion, appending the lines they make up to out
+func (pp *preprocessor) process(out []sourceLine, lines []sourceLine, depth int) []sourceLine {
+	conds := make([]*conditional, 0)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		label, rest := splitLabel(line.tokens)
+		active := len(conds) == 0 || conds[len(conds)-1].active
+
+		// Keep the label and the text of the line in place of the line that gets replaced
+		labelLine := line
+		labelLine.tokens = label
+
+		// Lines that conditions leave out stay in the listing but do not place anything
+		if len(rest) > 0 && rest[0].kind == tokenIdent && isConditionalDirective(strings.ToUpper(rest[0].text)) {
+			if active {
+				pp.recordDefinition(labelLine)
+			}
+			conds = pp.conditional(conds, line, rest)
+			if active {
+				out = append(out, labelLine)
+			} else {
+				out = append(out, skippedLine(line))
+			}
+			continue
+		}
+		if !active {
+			out = append(out, skippedLine(line))
+			continue
+		}
+
+		pp.recordDefinition(line)
+		if len(rest) == 0 || rest[0].kind != tokenIdent {
+			out = append(out, line)
+			continue
+		}
+
+		name := strings.ToUpper(rest[0].text)
+		switch {
+		case name == ".MACRO":
+			if len(label) > 0 {
+				pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, label[0].column, "Bad macro definition: A macro definition cannot have a label").suggest("Put the label on its own line before .macro"))
+			}
+			end := pp.defineMacro(lines, i, rest)
+			// The definition stays in the listing but does not place anything on its own
+			for ; i <= end; i++ {
+				out = append(out, skippedLine(lines[i]))
+			}
+			i = end
+
+		case name == ".ENDM":
+			pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, rest[0].column, "Bad macro definition: .endm without a matching .macro"))
+			out = append(out, labelLine)
+
+		case name == ".INCLUDE":
+			out = append(out, labelLine)
+			if depth >= maxNestingDepth {
+				pp.diags = append(pp.diags, newError(CodeInclude, line.fileName, line.lineNumber, rest[0].column, "Includes are nested too deeply: More than %d levels", maxNestingDepth))
+				continue
+			}
+			out = pp.include(out, line, rest, depth)
+
+		case pp.macros[name] != nil:
+			out = append(out, labelLine)
+			if depth >= maxNestingDepth {
+				pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, rest[0].column, "Macros are nested too deeply: More than %d levels", maxNestingDepth).suggest("Make sure %s does not expand itself", pp.macros[name].name))
+				continue
+			}
+			// Only the first expansion past the limit is reported so the error is not repeated for every use after it
+			if pp.expandedLines+len(pp.macros[name].body) > maxExpandedLines {
+				if pp.expandedLines <= maxExpandedLines {
+					pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, rest[0].column, "Macros expand into too many lines: More than %d lines", maxExpandedLines).suggest("Make sure %s does not expand itself more than once", pp.macros[name].name))
+				}
+				pp.expandedLines = maxExpandedLines + 1
+				continue
+			}
+			pp.expandedLines += len(pp.macros[name].body)
+			out = pp.expand(out, pp.macros[name], line, rest, depth)
+
+		default:
+			out = append(out, line)
+		}
+	}
+
+	pp.unclosedConditionals(conds)
+	return out
+}
+
+// Gets a line that stays in the listing without any tokens, so it does not place anything
+func skippedLine(line sourceLine) sourceLine {
+	return sourceLine{lineNumber: line.lineNumber, fileName: line.fileName, text: line.text, macro: line.macro}
+}
+
+// Records the macro defined by the .macro line at index start and returns the index of its .endm line
+func (pp *preprocessor) defineMacro(lines []sourceLine, start int, tokens []token) int {
+	line := lines[start]
+
+	// Find the end of the macro
+	end := -1
+	for i := start + 1; i < len(lines) && end == -1; i++ {
+		_, rest := splitLabel(lines[i].tokens)
+		if len(rest) == 0 {
+			continue
+		}
+		switch strings.ToUpper(rest[0].text) {
+		case ".ENDM":
+			end = i
+		case ".MACRO":
+			pp.diags = append(pp.diags, newError(CodeMacro, lines[i].fileName, lines[i].lineNumber, rest[0].column, "Bad macro definition: Macros cannot be defined inside other macros").suggest("Add .endm before this line"))
+		}
+	}
+	if end == -1 {
+		pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, tokens[0].column, "Bad macro definition: .macro without a matching .endm").suggest("Add .endm after the last line of the macro"))
+		return len(lines) - 1
+	}
+
+	if len(tokens) < 2 || tokens[1].kind != tokenIdent {
+		pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, tokens[0].column, "Bad macro definition: Expected the name of the macro"))
+		return end
+	}
+	nameTok := tokens[1]
+	name := strings.ToUpper(nameTok.text)
+
+	// Macros cannot hide instructions or other macros
+	if existing := pp.macros[name]; existing != nil {
+		pp.diags = append(pp.diags, newError(CodeDuplicateSymbol, line.fileName, line.lineNumber, nameTok.column, "Duplicate macro: %s was already defined on line %d of %s", nameTok.text, existing.lineNumber, existing.fileName).suggest("Rename one of the definitions of %s", nameTok.text))
+		return end
+	}
+	if isDirective(name) || isPseudoInstruction(name) || isInstruction(name) {
+		pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, nameTok.column, "Bad macro definition: %s is already an instruction or directive", nameTok.text))
+		return end
+	}
+
+	// Get the names of the parameters
+	paramOps, diag := splitOperands(tokens[2:], tokens[0], line.fileName, line.lineNumber)
+	if diag != nil {
+		pp.diags = append(pp.diags, diag)
+		return end
+	}
+	params := make([]string, len(paramOps))
+	for i, op := range paramOps {
+		if len(op.tokens) != 1 || op.tokens[0].kind != tokenIdent || !isWordStart(op.tokens[0].text[0]) {
+			pp.diags = append(pp.diags, newError(CodeMacro, line.fileName, line.lineNumber, op.column, "Bad macro parameter name: %s", op.text()))
+			return end
+		}
+		params[i] = op.tokens[0].text
+	}
+
+	// Labels defined in the body get a new name every time the macro is used
+	body := lines[start+1 : end]
+	labels := make(map[string]bool)
+	for _, bodyLine := range body {
+		// Numeric labels are found relative to where they are used, so they already work in every use of the macro
+		if label, _ := splitLabel(bodyLine.tokens); len(label) > 0 && label[0].kind == tokenIdent {
+			labels[label[0].text] = true
+		}
+	}
+
+	pp.macros[name] = &macro{
+		name:       nameTok.text,
+		params:     params,
+		body:       body,
+		labels:     labels,
+		fileName:   line.fileName,
+		lineNumber: line.lineNumber,
+	}
+	return end
+}
+
+// Expands a use of a macro into the lines of its body with the arguments in place of the parameters, appending them to out
+func (pp *preprocessor) expand(out []sourceLine, mac *macro, line sourceLine, tokens []token, depth int) []sourceLine {
+	args, diag := splitOperands(tokens[1:], tokens[0], line.fileName, line.lineNumber)
+	if diag != nil {
+		pp.diags = append(pp.diags, diag)
+		return out
+	}
+	if len(args) != len(mac.params) {
+		pp.diags = append(pp.diags, newError(CodeOperandCount, line.fileName, line.lineNumber, tokens[0].column, "Invalid macro arguments: %s expects %d arguments but got %d", mac.name, len(mac.params), len(args)))
+		return out
+	}
+
+	// Replace longer parameter names first so a parameter that starts with the name of another one is not broken up
+	argsByParam := make(map[string]operand)
+	for i, param := range mac.params {
+		argsByParam[param] = args[i]
+	}
+	params := append([]string{}, mac.params...)
+	sort.Slice(params, func(i int, j int) bool {
+		return len(params[i]) > len(params[j])
+	})
+
+	pp.expansions++
+	expanded := make([]sourceLine, len(mac.body))
+	for i, bodyLine := range mac.body {
+		newTokens := make([]token, 0, len(bodyLine.tokens))
+		for _, tok := range bodyLine.tokens {
+			// A parameter on its own becomes the tokens of the argument
+			if arg, isParam := argsByParam[strings.TrimPrefix(tok.text, "\\")]; isParam && strings.HasPrefix(tok.text, "\\") {
+				for _, argTok := range arg.tokens {
+					argTok.column = tok.column
+					newTokens = append(newTokens, argTok)
+				}
+				continue
+			}
+
+			// Parameters inside a token, such as an immediate, are replaced by the text of the argument
+			if tok.kind == tokenString {
+				newTokens = append(newTokens, tok)
+				continue
+			}
+			for _, param := range params {
+				tok.text = strings.ReplaceAll(tok.text, "\\"+param, argsByParam[param].text())
+			}
+			if strings.Contains(tok.text, "\\") {
+				pp.diags = append(pp.diags, newError(CodeMacro, bodyLine.fileName, bodyLine.lineNumber, tok.column, "Unknown macro parameter: %s", tok.text).suggest("The parameters of %s are %s", mac.name, strings.Join(mac.params, ", ")))
+			}
+
+			// Local labels and the references to them get a name that is unique to this expansion
+			switch {
+			case tok.kind == tokenIdent && mac.labels[tok.text]:
+				tok.text = pp.localLabel(tok.text)
+			case tok.kind == tokenImmediate && mac.labels[tok.text[1:]]:
+				tok.text = "#" + pp.localLabel(tok.text[1:])
+			}
+			newTokens = append(newTokens, tok)
+		}
+
+		expanded[i] = sourceLine{
+			tokens:     newTokens,
+			lineNumber: bodyLine.lineNumber,
+			fileName:   bodyLine.fileName,
+			text:       tokensText(newTokens),
+			macro:      mac.name,
+		}
+	}
+
+	// The body can use other macros and include files
+	return pp.process(out, expanded, depth+1)
+}
+
+// Gets the name of a local label for the current macro expansion
+func (pp *preprocessor) localLabel(name string) string {
+	// '@' cannot be written in a program, so the name cannot clash with any other label
+	return fmt.Sprintf("%s@%d", name, pp.expansions)
+}
+
+// Reads and processes the file named by a .include line, appending its lines to out
+func (pp *preprocessor) include(out []sourceLine, line sourceLine, tokens []token, depth int) []sourceLine {
+	if pp.opts.NoIncludes {
+		pp.diags = append(pp.diags, newError(CodeInclude, line.fileName, line.lineNumber, tokens[0].column, "Includes are not allowed for this program"))
+		return out
+	}
+	if len(tokens) != 2 || tokens[1].kind != tokenString {
+		pp.diags = append(pp.diags, newError(CodeInclude, line.fileName, line.lineNumber, tokens[0].column, "Invalid directive format: Expected .include followed by a quoted file name"))
+		return out
+	}
+	name, err := strconv.Unquote(tokens[1].text)
+	if err != nil {
+		pp.diags = append(pp.diags, newError(CodeBadValue, line.fileName, line.lineNumber, tokens[1].column, "Bad string value: Invalid escape sequence in %s", tokens[1].text))
+		return out
+	}
+
+	path := pp.findInclude(name, line.fileName)
+	if path == "" {
+		pp.diags = append(pp.diags, newError(CodeInclude, line.fileName, line.lineNumber, tokens[1].column, "Include file not found: %s", name).suggest("Add the directory that contains %s to the include paths", name))
+		return out
+	}
+
+	// Make sure the file is not already being included
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	for i, included := range pp.includeStack {
+		if included == absPath {
+			cycle := append(append([]string{}, pp.includeStack[i:]...), absPath)
+			pp.diags = append(pp.diags, newError(CodeInclude, line.fileName, line.lineNumber, tokens[1].column, "Include cycle: %s", strings.Join(cycle, " -> ")))
+			return out
+		}
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		pp.diags = append(pp.diags, newError(CodeInclude, line.fileName, line.lineNumber, tokens[1].column, "Cannot read include file %s: %s", name, err))
+		return out
+	}
+
+	lines, diags := tokenize(string(src), path)
+	pp.diags = append(pp.diags, diags...)
+
+	pp.includeStack = append(pp.includeStack, absPath)
+	out = pp.process(out, lines, depth+1)
+	pp.includeStack = pp.includeStack[:len(pp.includeStack)-1]
+	return out
+}
+
+// Finds an included file next to the file that includes it or in one of the include paths, returning "" if it does not exist
+func (pp *preprocessor) findInclude(name string, fromFile string) string {
+	if filepath.IsAbs(name) {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+		return ""
+	}
+
+	dirs := append([]string{filepath.Dir(fromFile)}, pp.opts.IncludePaths...)
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// Splits the label off of the start of a line
+func splitLabel(tokens []token) ([]token, []token) {
+	if len(tokens) >= 2 && (tokens[0].kind == tokenIdent || tokens[0].kind == tokenNumber && isNumericLabel(tokens[0].text)) && tokens[1].kind == tokenColon {
+		return tokens[:2], tokens[2:]
+	}
+	return tokens[:0], tokens
+}
+
+// Gets the text of a line from its tokens
+func tokensText(tokens []token) string {
+	var str strings.Builder
+	for i, tok := range tokens {
+		if i > 0 && tok.kind != tokenComma && tok.kind != tokenColon {
+			str.WriteString(" ")
+		}
+		str.WriteString(tok.text)
+	}
+	return str.String()
+}
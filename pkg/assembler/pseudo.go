@@ -0,0 +1,183 @@
+package assembler
+
+import "fmt"
+
+// The opcodes of the pseudo-instructions, which are expanded into real instructions
+var pseudoOpcodes = []string{"MOV", "MOVI", "CMP", "CMPI", "NEG", "NOP", "TST", "RET"}
+
+// Determines if an opcode is a pseudo-instruction
+func isPseudoInstruction(opcode string) bool {
+	for _, pseudo := range pseudoOpcodes {
+		if opcode == pseudo {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces a pseudo-instruction with the real instructions that do the same thing
+func expandPseudo(stmt statement, symbols map[string]Symbol, relocatable bool, fileName string) ([]statement, *Diagnostic) {
+	zr := regOperand("XZR", stmt.opcodeColumn)
+
+	switch stmt.opcode {
+	case "MOV":
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return nil, err
+		}
+		// Moving a constant is the same as MOVI
+		if stmt.operands[1].tokens[0].kind == tokenImmediate {
+			return expandMovi(stmt, symbols, relocatable, fileName)
+		}
+		// MOV Rd, Rm -> ADD Rd, Rm, XZR
+		return expandTo(stmt, "ADD", stmt.operands[0], stmt.operands[1], zr), nil
+
+	case "MOVI":
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return nil, err
+		}
+		return expandMovi(stmt, symbols, relocatable, fileName)
+
+	case "CMP":
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return nil, err
+		}
+		// CMP Rm, Imm -> SUBIS XZR, Rm, Imm
+		if stmt.operands[1].tokens[0].kind == tokenImmediate {
+			return expandTo(stmt, "SUBIS", zr, stmt.operands[0], stmt.operands[1]), nil
+		}
+		// CMP Rm, Rn -> SUBS XZR, Rm, Rn
+		return expandTo(stmt, "SUBS", zr, stmt.operands[0], stmt.operands[1]), nil
+
+	case "CMPI":
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return nil, err
+		}
+		// CMPI Rm, Imm -> SUBIS XZR, Rm, Imm
+		return expandTo(stmt, "SUBIS", zr, stmt.operands[0], stmt.operands[1]), nil
+
+	case "NEG":
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return nil, err
+		}
+		// NEG Rd, Rn -> SUB Rd, XZR, Rn
+		return expandTo(stmt, "SUB", stmt.operands[0], zr, stmt.operands[1]), nil
+
+	case "NOP":
+		if err := checkOperandCount(stmt, 0, fileName); err != nil {
+			return nil, err
+		}
+		// NOP -> ADD XZR, XZR, XZR
+		return expandTo(stmt, "ADD", zr, zr, zr), nil
+
+	case "TST":
+		// TST Rm -> ANDS XZR, Rm, Rm
+		if len(stmt.operands) == 1 {
+			return expandTo(stmt, "ANDS", zr, stmt.operands[0], stmt.operands[0]), nil
+		}
+		if err := checkOperandCount(stmt, 2, fileName); err != nil {
+			return nil, err
+		}
+		// TST Rm, Imm -> ANDIS XZR, Rm, Imm
+		if stmt.operands[1].tokens[0].kind == tokenImmediate {
+			return expandTo(stmt, "ANDIS", zr, stmt.operands[0], stmt.operands[1]), nil
+		}
+		// TST Rm, Rn -> ANDS XZR, Rm, Rn
+		return expandTo(stmt, "ANDS", zr, stmt.operands[0], stmt.operands[1]), nil
+
+	case "RET":
+		// RET -> BR LR
+		if len(stmt.operands) == 0 {
+			return expandTo(stmt, "BR", regOperand("LR", stmt.opcodeColumn)), nil
+		}
+		if err := checkOperandCount(stmt, 1, fileName); err != nil {
+			return nil, err
+		}
+		// RET Rn -> BR Rn
+		return expandTo(stmt, "BR", stmt.operands[0]), nil
+	}
+
+	return nil, newError(CodeBadOpcode, fileName, stmt.lineNumber, stmt.opcodeColumn, "Invalid opcode: %s", stmt.opcode)
+}
+
+// Expands MOVI Rd, Imm into a MOVZ followed by a MOVK for each other 16-bit piece of the constant that is not 0
+func expandMovi(stmt statement, symbols map[string]Symbol, relocatable bool, fileName string) ([]statement, *Diagnostic) {
+	destOp, valOp := stmt.operands[0], stmt.operands[1]
+	if valOp.tokens[0].kind != tokenImmediate {
+		return nil, newError(CodeBadValue, fileName, stmt.lineNumber, valOp.column, "Bad move immediate value: Expected an immediate but got %s", valOp.text())
+	}
+
+	// Labels that are defined later do not have an address yet and the linker decides the addresses of labels in relocatable objects, so all 4 pieces are needed for them
+	shifts := []uint64{0, 16, 32, 48}
+	bigVal, err := evalOperand(valOp, symbols, fileName, stmt.lineNumber)
+	isReloc := false
+	if err == nil && relocatable {
+		_, _, isReloc, err = relocatableValue(valOp, symbols, fileName, stmt.lineNumber)
+	}
+	if err != nil && err.Code != CodeUndefinedSymbol {
+		return nil, err
+	}
+	if err == nil && !isReloc {
+		val, err := fitValue(bigVal, 64, anyValue, "move immediate", valOp, fileName, stmt.lineNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip the pieces that are 0, keeping at least 1 instruction
+		shifts = make([]uint64, 0, 4)
+		for shift := uint64(0); shift < 64; shift += 16 {
+			if val>>shift&0xFFFF != 0 {
+				shifts = append(shifts, shift)
+			}
+		}
+		if len(shifts) == 0 {
+			shifts = append(shifts, 0)
+		}
+	}
+
+	expanded := make([]statement, len(shifts))
+	for i, shift := range shifts {
+		opcode := "MOVK"
+		if i == 0 {
+			opcode = "MOVZ"
+		}
+		shiftOp := operand{
+			tokens: []token{
+				{kind: tokenIdent, text: "LSL", column: valOp.column},
+				{kind: tokenNumber, text: fmt.Sprintf("%d", shift), column: valOp.column},
+			},
+			column: valOp.column,
+		}
+		expanded[i] = expandTo(stmt, opcode, destOp, valOp, shiftOp)[0]
+		expanded[i].wideImm = true
+		// Only the first instruction gets the label
+		if i > 0 {
+			expanded[i].label = ""
+		}
+	}
+	return expanded, nil
+}
+
+// Creates the single instruction a pseudo-instruction expands to
+func expandTo(stmt statement, opcode string, operands ...operand) []statement {
+	return []statement{{
+		label:        stmt.label,
+		labelColumn:  stmt.labelColumn,
+		opcode:       opcode,
+		opcodeColumn: stmt.opcodeColumn,
+		operands:     operands,
+		lineNumber:   stmt.lineNumber,
+		fileName:     stmt.fileName,
+		lineIndex:    stmt.lineIndex,
+		pseudo:       stmt.opcode,
+	}}
+}
+
+// Creates an operand for a register that was not written in the program
+func regOperand(name string, column int) operand {
+	return operand{tokens: []token{{kind: tokenIdent, text: name, column: column}}, column: column}
+}
+
+// Creates an operand for an immediate that was not written in the program
+func immOperand(text string, column int) operand {
+	return operand{tokens: []token{{kind: tokenImmediate, text: text, column: column}}, column: column}
+}
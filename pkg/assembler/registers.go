@@ -0,0 +1,105 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
+)
+
+// The number of the zero register, which is also the highest register number
+const zeroRegister = 0x1F
+
+// The register names that are worth suggesting for a misspelled register
+var suggestedRegisters = append([]string{"XZR", "WZR"}, disassembler.AliasNames()...)
+
+// Struct for a register name that was parsed
+type registerName struct {
+	num    int64  // The number of the register
+	is32   bool   // If the name is for the 32-bit view of the register, such as W1
+	valid  bool   // If the name is a register
+	reason string // Why the name is not a register
+	fix    string // How to fix the name, if there is an obvious fix
+}
+
+// Parses the name of a register, which is X0 - X30, XZR, W0 - W30, WZR, or an alias, in any case
+func parseRegisterName(name string) registerName {
+	upper := strings.ToUpper(name)
+	if reg, exists := disassembler.AliasRegister(upper); exists {
+		return registerName{num: int64(reg), valid: true}
+	}
+	if upper == "XZR" || upper == "WZR" {
+		return registerName{num: zeroRegister, is32: upper[0] == 'W', valid: true}
+	}
+
+	// Everything else is a prefix followed by the number of the register
+	if len(upper) < 2 || (upper[0] != 'X' && upper[0] != 'W') {
+		return registerName{reason: name + " is not a register"}
+	}
+	prefix, digits := upper[:1], upper[1:]
+	reg, err := strconv.ParseInt(digits, 10, 0)
+	switch {
+	case err != nil || strings.ContainsAny(digits, "+-"):
+		return registerName{reason: name + " is not a register"}
+	case reg > 30:
+		fix := "Use a register between " + prefix + "0 and " + prefix + "30"
+		if reg == zeroRegister {
+			fix = "Use " + prefix + "ZR for the zero register"
+		}
+		return registerName{reason: name + " is out of range: Register must be between 0 and 30 (inclusive)", fix: fix}
+	case digits != strconv.FormatInt(reg, 10):
+		return registerName{reason: name + " has a leading 0", fix: "Write " + prefix + strconv.FormatInt(reg, 10)}
+	}
+	return registerName{num: reg, is32: prefix == "W", valid: true}
+}
+
+// Determines if a name is a register, ignoring case
+func isRegisterName(name string) bool {
+	return parseRegisterName(name).valid
+}
+
+// Parses an operand for a 64-bit register value
+func getRegister(op operand, fileName string, lineNumber int) (int64, *Diagnostic) {
+	reg, diag := getAnyRegister(op, fileName, lineNumber)
+	if diag != nil {
+		return -1, diag
+	}
+	if reg.is32 {
+		name := "X" + strconv.FormatInt(reg.num, 10)
+		if reg.num == zeroRegister {
+			name = "XZR"
+		}
+		return -1, newError(CodeBadRegister, fileName, lineNumber, op.column, "Bad register value: %s is a 32-bit register, which can only be used to load or store a byte, halfword, or word", op.text()).suggest("Use %s", name)
+	}
+	return reg.num, nil
+}
+
+// Parses an operand for the register of a load or store that only uses part of the register, which can also be a 32-bit W register
+func getDataRegister(op operand, fileName string, lineNumber int) (int64, *Diagnostic) {
+	reg, diag := getAnyRegister(op, fileName, lineNumber)
+	if diag != nil {
+		return -1, diag
+	}
+	return reg.num, nil
+}
+
+// Parses an operand for a register of any size
+func getAnyRegister(op operand, fileName string, lineNumber int) (registerName, *Diagnostic) {
+	if len(op.tokens) != 1 || op.tokens[0].kind != tokenIdent {
+		return registerName{}, newError(CodeBadRegister, fileName, lineNumber, op.column, "Bad register value: Expected a register but got %s", op.text())
+	}
+	reg := parseRegisterName(op.tokens[0].text)
+	if reg.valid {
+		return reg, nil
+	}
+
+	diag := newError(CodeBadRegister, fileName, lineNumber, op.column, "Bad register value: %s", reg.reason)
+	if reg.fix != "" {
+		diag.suggest("%s", reg.fix)
+	} else if match := closestMatch(op.tokens[0].text, suggestedRegisters); match != "" {
+		diag.suggest("Did you mean %s?", match)
+	} else {
+		diag.suggest("Registers are X0 - X30, XZR, and the aliases IP0, IP1, SP, FP, and LR")
+	}
+	return registerName{}, diag
+}
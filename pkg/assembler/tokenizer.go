@@ -0,0 +1,181 @@
+package assembler
+
+import "strings"
+
+// The different kinds of tokens in a program
+type tokenType int
+
+const (
+	tokenIdent     tokenType = iota // Opcodes, registers, labels, and keywords
+	tokenNumber                     // Numbers without a '#' prefix
+	tokenImmediate                  // Constant values with a '#' prefix
+	tokenString                     // Quoted strings
+	tokenComma                      // Separator between operands
+	tokenColon                      // End of a label definition
+	tokenOperator                   // Operators and parentheses in constant expressions
+)
+
+// Struct for a single token in a line
+type token struct {
+	kind   tokenType // The kind of token
+	text   string    // The text of the token
+	column int       // The column the token starts in (1-based)
+}
+
+// Struct for the tokens on a single line of the program
+type sourceLine struct {
+	tokens     []token // The tokens on the line
+	lineNumber int     // The line number of the line (1-based)
+	fileName   string  // The file the line is in
+	text       string  // The text of the line
+	macro      string  // The macro the line was expanded from, if any
+}
+
+// Splits a program into tokens line by line, removing whitespace and comments
+func tokenize(src string, fileName string) ([]sourceLine, Diagnostics) {
+	lines := make([]sourceLine, 0)
+	diags := make(Diagnostics, 0)
+	inBlockComment := false
+
+	for lineIndex, line := range strings.Split(src, "\n") {
+		lineNumber := lineIndex + 1
+		tokens := make([]token, 0)
+
+		i := 0
+		for i < len(line) {
+			char := line[i]
+			column := i + 1
+
+			switch {
+			// Everything in a block comment is ignored until it is closed
+			case inBlockComment:
+				end := strings.Index(line[i:], "*/")
+				if end == -1 {
+					i = len(line)
+				} else {
+					i += end + 2
+					inBlockComment = false
+				}
+
+			case char == ' ' || char == '\t' || char == '\r':
+				i++
+
+			// Line comments take up the rest of the line
+			case char == ';' || strings.HasPrefix(line[i:], "//"):
+				i = len(line)
+
+			case strings.HasPrefix(line[i:], "/*"):
+				inBlockComment = true
+				i += 2
+
+			case char == ',':
+				tokens = append(tokens, token{kind: tokenComma, text: ",", column: column})
+				i++
+
+			case char == ':':
+				tokens = append(tokens, token{kind: tokenColon, text: ":", column: column})
+				i++
+
+			case char == '"':
+				end, diag := scanString(line, i, fileName, lineNumber)
+				if diag != nil {
+					diags = append(diags, diag)
+				}
+				tokens = append(tokens, token{kind: tokenString, text: line[i:end], column: column})
+				i = end
+
+			case char == '\'':
+				end, diag := scanChar(line, i, fileName, lineNumber)
+				if diag != nil {
+					diags = append(diags, diag)
+				}
+				tokens = append(tokens, token{kind: tokenNumber, text: line[i:end], column: column})
+				i = end
+
+			case strings.HasPrefix(line[i:], "<<") || strings.HasPrefix(line[i:], ">>"):
+				tokens = append(tokens, token{kind: tokenOperator, text: line[i : i+2], column: column})
+				i += 2
+
+			case strings.IndexByte("+-*/%&|^~()", char) != -1:
+				tokens = append(tokens, token{kind: tokenOperator, text: string(char), column: column})
+				i++
+
+			case char == '#':
+				end := scanWord(line, i+1)
+				tokens = append(tokens, token{kind: tokenImmediate, text: line[i:end], column: column})
+				i = end
+
+			case isDigit(char):
+				end := scanWord(line, i)
+				tokens = append(tokens, token{kind: tokenNumber, text: line[i:end], column: column})
+				i = end
+
+			// Words, including macro parameters that start with a backslash
+			case isWordStart(char) || char == '\\':
+				end := scanWord(line, i+1)
+				tokens = append(tokens, token{kind: tokenIdent, text: line[i:end], column: column})
+				i = end
+
+			default:
+				// Skip the character so the rest of the line can still be checked
+				diags = append(diags, newError(CodeSyntax, fileName, lineNumber, column, "Unexpected character '%c'", char))
+				i++
+			}
+		}
+
+		lines = append(lines, sourceLine{tokens: tokens, lineNumber: lineNumber, fileName: fileName, text: strings.TrimRight(line, "\r")})
+	}
+
+	return lines, diags
+}
+
+// Gets the index right after the word that starts at the given index
+func scanWord(line string, start int) int {
+	end := start
+	for end < len(line) && (isWordStart(line[end]) || isDigit(line[end]) || line[end] == '\\') {
+		end++
+	}
+	return end
+}
+
+// Gets the index right after the quoted string that starts at the given index, which is the end of the line if the string is not closed
+func scanString(line string, start int, fileName string, lineNumber int) (int, *Diagnostic) {
+	end := start + 1
+	for end < len(line) && line[end] != '"' {
+		// Skip over escaped characters
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(line) {
+		return len(line), newError(CodeSyntax, fileName, lineNumber, start+1, "Unterminated string").suggest("Add a closing '\"'")
+	}
+	return end + 1, nil
+}
+
+// Gets the index right after the character literal that starts at the given index, which is the end of the line if the literal is not closed
+func scanChar(line string, start int, fileName string, lineNumber int) (int, *Diagnostic) {
+	end := start + 1
+	for end < len(line) && line[end] != '\'' {
+		// Skip over escaped characters
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(line) {
+		return len(line), newError(CodeSyntax, fileName, lineNumber, start+1, "Unterminated character literal").suggest("Add a closing '")
+	}
+	return end + 1, nil
+}
+
+// Determines if a character can start a word
+func isWordStart(char byte) bool {
+	return char >= 'A' && char <= 'Z' || char >= 'a' && char <= 'z' || char == '_' || char == '.'
+}
+
+// Determines if a character is a decimal digit
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
@@ -0,0 +1,57 @@
+package assembler
+
+// The instructions that write their result to the first operand without setting the flags
+var destinationOpcodes = map[string]bool{
+	"MOVZ": true, "MOVK": true,
+	"ADD": true, "SUB": true, "ADDI": true, "SUBI": true,
+	"MUL": true, "SMULH": true, "UMULH": true, "SDIV": true, "UDIV": true,
+	"AND": true, "ORR": true, "EOR": true, "ANDI": true, "ORRI": true, "EORI": true,
+	"LSL": true, "LSR": true,
+	"LDUR": true, "LDURB": true, "LDURH": true, "LDURSW": true,
+}
+
+// Looks for likely mistakes in a program that can still be assembled
+func findWarnings(statements []statement) Diagnostics {
+	diags := make(Diagnostics, 0)
+
+	// If the previous instruction never lets the program continue to the next one
+	afterStop := false
+
+	for _, stmt := range statements {
+		fileName := stmt.fileName
+
+		// Anything with a label can be reached by a branch, and a new section can be placed anywhere by the linker
+		if stmt.label != "" || isSectionDirective(stmt.opcode) {
+			afterStop = false
+		}
+
+		// Data is never executed
+		if stmt.opcode == "" || isDirective(stmt.opcode) || stmt.opcode == "DATA" {
+			continue
+		}
+
+		if afterStop {
+			opcode := stmt.opcode
+			if stmt.pseudo != "" {
+				opcode = stmt.pseudo
+			}
+			diags = append(diags, newWarning(CodeUnreachable, fileName, stmt.lineNumber, stmt.opcodeColumn, "Unreachable code: %s can never be executed", opcode).suggest("Add a label if this instruction is the target of a branch"))
+			// Only report the first unreachable instruction in a block
+			afterStop = false
+		}
+
+		switch stmt.opcode {
+		case "HLT", "B", "BR":
+			afterStop = true
+		}
+
+		// Results written to XZR are thrown away, which is only useful for setting the flags or doing nothing on purpose
+		if destinationOpcodes[stmt.opcode] && stmt.pseudo != "NOP" && len(stmt.operands) > 0 {
+			if reg, diag := getDataRegister(stmt.operands[0], fileName, stmt.lineNumber); diag == nil && reg == 0x1F {
+				diags = append(diags, newWarning(CodeXzrWrite, fileName, stmt.lineNumber, stmt.operands[0].column, "Write to XZR: The result of %s will be discarded", stmt.opcode).suggest("Use a register between X0 and X30"))
+			}
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,353 @@
+package disassembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The different instruction formats
+type Format int
+
+const (
+	FormatR    Format = iota // Register instructions
+	FormatI                  // Immediate instructions
+	FormatD                  // Data transfer instructions
+	FormatB                  // Branch instructions
+	FormatCB                 // Conditional branch instructions
+	FormatIM                 // Move immediate instructions
+	FormatData               // Constant data that is not an instruction
+	FormatHLT                // The halt instruction
+)
+
+// Struct for the fields of a decoded instruction
+type Instruction struct {
+	Raw      uint32 `json:"raw"`      // The binary of the instruction
+	Format   Format `json:"format"`   // The format of the instruction
+	Mnemonic string `json:"mnemonic"` // The opcode of the instruction as written in a program
+	Opcode   uint32 `json:"opcode"`   // The bits of the opcode field, which has a different size in each format
+	Rd       uint32 `json:"rd"`       // The destination register, the register to store or test, or the condition of B.cond (bits 4-0)
+	Rn       uint32 `json:"rn"`       // The register in bits 9-5
+	Rm       uint32 `json:"rm"`       // The register in bits 20-16
+	Shamt    uint32 `json:"shamt"`    // The shift amount of R instructions
+	Imm      uint32 `json:"imm"`      // The immediate, address, or data field
+	Shift    uint32 `json:"shift"`    // The amount the immediate of a move is shifted left by
+}
+
+// Struct for an instruction at a location in memory
+type Line struct {
+	Addr  uint64      `json:"addr"`  // The address of the instruction
+	Instr Instruction `json:"instr"` // The decoded instruction
+	Text  string      `json:"text"`  // The assembly of the instruction
+}
+
+// The mnemonics of the R instructions by opcode
+var opcodesR = map[uint32]string{
+	0x458: "ADD",
+	0x558: "ADDS",
+	0x658: "SUB",
+	0x758: "SUBS",
+	0x450: "AND",
+	0x750: "ANDS",
+	0x550: "ORR",
+	0x650: "EOR",
+	0x69B: "LSL",
+	0x69A: "LSR",
+	0x6B0: "BR",
+}
+
+// The mnemonics of the multiply and divide instructions by the opcode followed by the 6 bits of the shift amount
+var opcodesMulDiv = map[uint32]string{
+	0x4D8<<6 | 0x1F: "MUL",
+	0x4DA<<6 | 0x1F: "SMULH",
+	0x4DE<<6 | 0x1F: "UMULH",
+	0x4D6<<6 | 0x02: "UDIV",
+	0x4D6<<6 | 0x03: "SDIV",
+}
+
+// The R instructions that shift by the shift amount instead of using Rm
+var shiftOpcodes = map[uint32]bool{
+	0x69B: true,
+	0x69A: true,
+}
+
+// The R instructions that only use Rn, which is the register with the address to branch to
+var branchRegOpcodes = map[uint32]bool{
+	0x6B0: true,
+}
+
+// The mnemonics of the I instructions by the 10-bit opcode
+var opcodesI = map[uint32]string{
+	0x244: "ADDI",
+	0x2C4: "ADDIS",
+	0x344: "SUBI",
+	0x3C4: "SUBIS",
+	0x248: "ANDI",
+	0x3C8: "ANDIS",
+	0x2C8: "ORRI",
+	0x348: "EORI",
+}
+
+// The mnemonics of the D instructions by opcode
+var opcodesD = map[uint32]string{
+	0x7C2: "LDUR",
+	0x1C2: "LDURB",
+	0x3C2: "LDURH",
+	0x5C4: "LDURSW",
+	0x7C0: "STUR",
+	0x1C0: "STURB",
+	0x3C0: "STURH",
+	0x5C0: "STURW",
+}
+
+// The mnemonics of the IM instructions by the 9-bit opcode
+var opcodesIM = map[uint32]string{
+	0x1A5: "MOVZ",
+	0x1E5: "MOVK",
+}
+
+// The mnemonics of the B instructions by the 6-bit opcode
+var opcodesB = map[uint32]string{
+	0b000101: "B",
+	0b100101: "BL",
+}
+
+// The mnemonics of the CB instructions by the 8-bit opcode
+var opcodesCB = map[uint32]string{
+	0xB4: "CBZ",
+	0xB5: "CBNZ",
+}
+
+// The names of the conditions of B.cond by the condition code in the Rt field
+var conditionNames = map[uint32]string{
+	0x0: "EQ",
+	0x1: "NE",
+	0x2: "HS",
+	0x3: "LO",
+	0x4: "MI",
+	0x5: "PL",
+	0x6: "VS",
+	0x7: "VC",
+	0x8: "HI",
+	0x9: "LS",
+	0xA: "GE",
+	0xB: "LT",
+	0xC: "GT",
+	0xD: "LE",
+}
+
+// Splits an instruction into its fields, treating anything the assembler cannot generate as data
+func Decode(instr uint32) Instruction {
+	decoded := Instruction{
+		Raw: instr,
+		Rd:  instr & 0x1F,
+		Rn:  instr & 0x3FF >> 5,
+		Rm:  instr & 0x1FFFFF >> 16,
+	}
+
+	opcode := instr >> 21
+	// Multiplies and divides are found by the opcode together with the shift amount
+	mulDiv := opcodesMulDiv[opcode<<6|instr>>10&0x3F]
+
+	switch {
+	case instr == 0:
+		decoded.Format = FormatHLT
+		decoded.Mnemonic = "HLT"
+
+	// B and BL use a 6-bit opcode
+	case opcodesB[instr>>26] != "":
+		decoded.Format = FormatB
+		decoded.Mnemonic = opcodesB[instr>>26]
+		decoded.Opcode = instr >> 26
+		decoded.Imm = instr & 0x3FFFFFF
+
+	case opcodesCB[instr>>24] != "":
+		decoded.Format = FormatCB
+		decoded.Mnemonic = opcodesCB[instr>>24]
+		decoded.Opcode = instr >> 24
+		decoded.Imm = instr & 0xFFFFFF >> 5
+
+	// B.cond is a CB instruction with the condition in place of the register
+	case instr>>24 == 0b01010100 && conditionNames[instr&0x1F] != "":
+		decoded.Format = FormatCB
+		decoded.Mnemonic = "B." + conditionNames[instr&0x1F]
+		decoded.Opcode = instr >> 24
+		decoded.Imm = instr & 0xFFFFFF >> 5
+
+	case opcodesIM[instr>>23] != "":
+		decoded.Format = FormatIM
+		decoded.Mnemonic = opcodesIM[instr>>23]
+		decoded.Opcode = instr >> 23
+		decoded.Imm = instr & 0x1FFFFF >> 5
+		decoded.Shift = (instr >> 21 & 0x3) * 16
+
+	case opcodesI[instr>>22] != "":
+		decoded.Format = FormatI
+		decoded.Mnemonic = opcodesI[instr>>22]
+		decoded.Opcode = instr >> 22
+		decoded.Imm = instr & 0x3FFFFF >> 10
+
+	// Multiplies and divides use the shift amount as part of the opcode
+	case mulDiv != "":
+		decoded.Format = FormatR
+		decoded.Mnemonic = mulDiv
+		decoded.Opcode = opcode
+		decoded.Shamt = instr >> 10 & 0x3F
+
+	// The assembler always leaves the shift amount empty, except for shifts, which leave Rm empty instead, and BR, which leaves everything but Rn empty
+	case opcodesR[opcode] != "" && !shiftOpcodes[opcode] && !branchRegOpcodes[opcode] && instr&0xFC00 == 0,
+		shiftOpcodes[opcode] && instr&0x1F0000 == 0,
+		branchRegOpcodes[opcode] && instr&0x1FFC1F == 0:
+		decoded.Format = FormatR
+		decoded.Mnemonic = opcodesR[opcode]
+		decoded.Opcode = opcode
+		decoded.Shamt = instr >> 10 & 0x3F
+
+	// The assembler always leaves the op field empty
+	case opcodesD[opcode] != "" && instr&0xC00 == 0:
+		decoded.Format = FormatD
+		decoded.Mnemonic = opcodesD[opcode]
+		decoded.Opcode = opcode
+		decoded.Imm = instr & 0x1FFFFF >> 12
+
+	default:
+		decoded.Format = FormatData
+		decoded.Mnemonic = "DATA"
+		decoded.Imm = instr
+	}
+
+	return decoded
+}
+
+// Gets the assembly of the instruction, which assembles back into the same binary
+func (instr Instruction) String() string {
+	switch instr.Format {
+	case FormatR:
+		if branchRegOpcodes[instr.Opcode] {
+			return fmt.Sprintf("%s %s", instr.Mnemonic, RegisterName(instr.Rn))
+		}
+		if shiftOpcodes[instr.Opcode] {
+			return fmt.Sprintf("%s %s, %s, #%d", instr.Mnemonic, RegisterName(instr.Rd), RegisterName(instr.Rn), instr.Shamt)
+		}
+		return fmt.Sprintf("%s %s, %s, %s", instr.Mnemonic, RegisterName(instr.Rd), RegisterName(instr.Rm), RegisterName(instr.Rn))
+	case FormatI:
+		return fmt.Sprintf("%s %s, %s, #0x%X", instr.Mnemonic, RegisterName(instr.Rd), RegisterName(instr.Rn), instr.Imm)
+	case FormatD:
+		return fmt.Sprintf("%s %s, %s, #%s", instr.Mnemonic, RegisterName(instr.Rd), RegisterName(instr.Rn), signedHex(instr.Imm, 9))
+	case FormatB:
+		return fmt.Sprintf("%s #%s", instr.Mnemonic, signedHex(instr.Imm, 26))
+	case FormatCB:
+		if instr.IsBCond() {
+			return fmt.Sprintf("%s #%s", instr.Mnemonic, signedHex(instr.Imm, 19))
+		}
+		return fmt.Sprintf("%s %s, #%s", instr.Mnemonic, RegisterName(instr.Rd), signedHex(instr.Imm, 19))
+	case FormatIM:
+		return fmt.Sprintf("%s %s, #0x%X, LSL %d", instr.Mnemonic, RegisterName(instr.Rd), instr.Imm, instr.Shift)
+	case FormatHLT:
+		return instr.Mnemonic
+	default:
+		return fmt.Sprintf("%s #0x%X", instr.Mnemonic, instr.Imm)
+	}
+}
+
+// Gets the value of each field of the instruction in the order they appear in the binary
+func (instr Instruction) Fields() string {
+	switch instr.Format {
+	case FormatR:
+		return fmt.Sprintf("R  opcode=0x%03X Rm=%d shamt=%d Rn=%d Rd=%d", instr.Opcode, instr.Rm, instr.Shamt, instr.Rn, instr.Rd)
+	case FormatI:
+		return fmt.Sprintf("I  opcode=0x%03X imm=0x%03X Rn=%d Rd=%d", instr.Opcode, instr.Imm, instr.Rn, instr.Rd)
+	case FormatD:
+		return fmt.Sprintf("D  opcode=0x%03X addr=%s op=0 Rn=%d Rt=%d", instr.Opcode, signedHex(instr.Imm, 9), instr.Rn, instr.Rd)
+	case FormatB:
+		return fmt.Sprintf("B  opcode=0x%02X addr=%s", instr.Opcode, signedHex(instr.Imm, 26))
+	case FormatCB:
+		if instr.IsBCond() {
+			return fmt.Sprintf("CB opcode=0x%02X addr=%s cond=0x%X", instr.Opcode, signedHex(instr.Imm, 19), instr.Rd)
+		}
+		return fmt.Sprintf("CB opcode=0x%02X addr=%s Rt=%d", instr.Opcode, signedHex(instr.Imm, 19), instr.Rd)
+	case FormatIM:
+		return fmt.Sprintf("IM opcode=0x%03X hw=%d imm=0x%04X Rd=%d", instr.Opcode, instr.Shift/16, instr.Imm, instr.Rd)
+	default:
+		// Data and HLT do not have any fields
+		return ""
+	}
+}
+
+// Determines if the instruction is a B.cond, which tests the flags instead of a register
+func (instr Instruction) IsBCond() bool {
+	return instr.Format == FormatCB && instr.Opcode == 0b01010100
+}
+
+// Gets the assembly of a single instruction
+func Disassemble(instr uint32) string {
+	return Decode(instr).String()
+}
+
+// Disassembles every word of a program image, which is stored in big-endian order
+func DisassembleImage(image []uint8) []Line {
+	lines := make([]Line, 0, len(image)/4)
+	for addr := 0; addr+4 <= len(image); addr += 4 {
+		instr := uint32(image[addr])<<24 | uint32(image[addr+1])<<16 | uint32(image[addr+2])<<8 | uint32(image[addr+3])
+		decoded := Decode(instr)
+		lines = append(lines, Line{
+			Addr:  uint64(addr),
+			Instr: decoded,
+			Text:  decoded.String(),
+		})
+	}
+	return lines
+}
+
+// Gets the hex text of a 2's complement field with the given number of bits, with a '-' for negative values
+func signedHex(val uint32, bits int) string {
+	if val>>(bits-1)&1 == 1 {
+		return fmt.Sprintf("-0x%X", uint32(1)<<bits-val)
+	}
+	return fmt.Sprintf("0x%X", val)
+}
+
+// The names of the registers that have a special use by convention, which the assembler also accepts.
+// This is the only list of the aliases, so the assembler, disassembler, and tools always agree on them.
+var RegisterAliases = map[uint32]string{
+	16: "IP0",
+	17: "IP1",
+	28: "SP",
+	29: "FP",
+	30: "LR",
+}
+
+// Gets the name of a register as it is written in a program, using the alias if it has one
+func RegisterName(reg uint32) string {
+	if reg == 0x1F {
+		return "XZR"
+	}
+	if alias, exists := RegisterAliases[reg]; exists {
+		return alias
+	}
+	return fmt.Sprintf("X%d", reg)
+}
+
+// Gets the register an alias is for, ignoring case
+func AliasRegister(name string) (uint32, bool) {
+	for reg, alias := range RegisterAliases {
+		if strings.EqualFold(name, alias) {
+			return reg, true
+		}
+	}
+	return 0, false
+}
+
+// Gets the aliases in the order of the registers they are for
+func AliasNames() []string {
+	regs := make([]int, 0, len(RegisterAliases))
+	for reg := range RegisterAliases {
+		regs = append(regs, int(reg))
+	}
+	sort.Ints(regs)
+	names := make([]string, len(regs))
+	for i, reg := range regs {
+		names[i] = RegisterAliases[uint32(reg)]
+	}
+	return names
+}
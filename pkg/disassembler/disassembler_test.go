@@ -0,0 +1,115 @@
+package disassembler_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
+)
+
+// An instruction of every form the assembler can generate, with the registers and immediates at the edges of their fields
+var roundTripInstructions = []string{
+	"ADD X1, X2, X3", "ADDS SP, FP, LR", "SUB XZR, X0, X30", "SUBS X9, IP0, IP1",
+	"AND X1, X2, X3", "ANDS XZR, X1, X2", "ORR X4, X5, X6", "EOR X7, X8, X9",
+	"MUL X1, X2, X3", "SMULH X4, X5, X6", "UMULH X7, X8, X9", "SDIV X10, X11, X12", "UDIV X13, X14, X15",
+	"LSL X1, X2, #0", "LSR X3, X4, #63",
+	"BR LR", "BR X5",
+	"ADDI X1, X2, #0", "ADDIS X3, X4, #0xFFF", "SUBI SP, SP, #16", "SUBIS XZR, X1, #1",
+	"ANDI X1, X2, #0xF0", "ANDIS XZR, X3, #5", "ORRI X4, X5, #0x800", "EORI X6, X7, #0x7FF",
+	"LDUR X1, X2, #0", "LDURB X3, SP, #255", "LDURH X4, FP, #-256", "LDURSW X5, X6, #-8",
+	"STUR X1, X2, #8", "STURB X3, X4, #-1", "STURH X5, X6, #2", "STURW XZR, X7, #4",
+	"B #0", "B #-1", "BL #0x1FFFFFF", "BL #-0x2000000",
+	"CBZ X1, #0x3FFFF", "CBNZ XZR, #-0x40000",
+	"B.EQ #1", "B.NE #-1", "B.HS #2", "B.LO #-2", "B.MI #3", "B.PL #-3", "B.VS #4", "B.VC #-4",
+	"B.HI #5", "B.LS #-5", "B.GE #6", "B.LT #-6", "B.GT #7", "B.LE #-7",
+	"MOVZ X1, #0, LSL 0", "MOVZ X2, #0xFFFF, LSL 16", "MOVK X3, #0x1234, LSL 32", "MOVK LR, #0x8000, LSL 48",
+	"DATA #0x12345678",
+	"HLT",
+}
+
+// Assembles a program into its image
+func assemble(t *testing.T, src string) []uint8 {
+	t.Helper()
+	image, err := assembler.AssembleProgramAPI(src)
+	if err != nil {
+		t.Fatalf("%q did not assemble: %v", src, err)
+	}
+	return image
+}
+
+// Gets the big-endian word at the start of an image
+func firstWord(image []uint8) uint32 {
+	return uint32(image[0])<<24 | uint32(image[1])<<16 | uint32(image[2])<<8 | uint32(image[3])
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, src := range roundTripInstructions {
+		t.Run(src, func(t *testing.T) {
+			word := firstWord(assemble(t, src))
+			decoded := disassembler.Decode(word)
+			if mnemonic := strings.Fields(src)[0]; decoded.Mnemonic != mnemonic {
+				t.Errorf("0x%08X decoded as %s, want %s", word, decoded.Mnemonic, mnemonic)
+			}
+			text := decoded.String()
+			if again := firstWord(assemble(t, text)); again != word {
+				t.Errorf("%q disassembled into %q, which assembles into 0x%08X, want 0x%08X", src, text, again, word)
+			}
+		})
+	}
+}
+
+func TestRoundTripImage(t *testing.T) {
+	image := assemble(t, strings.Join(roundTripInstructions, "\n"))
+	lines := disassembler.DisassembleImage(image)
+	if len(lines) != len(roundTripInstructions) {
+		t.Fatalf("Got %d lines, want %d", len(lines), len(roundTripInstructions))
+	}
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		if line.Addr != uint64(i*4) {
+			t.Errorf("Line %d is at 0x%X, want 0x%X", i, line.Addr, i*4)
+		}
+		texts[i] = line.Text
+	}
+	if again := assemble(t, strings.Join(texts, "\n")); !reflect.DeepEqual(again, image) {
+		t.Errorf("The disassembly assembled into %X, want %X", again, image)
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	// Words the assembler cannot generate are shown as data, which assembles back into the same word
+	for _, word := range []uint32{0xFFFFFFFF, 0x8B000401, 0xD61F0001, 0x5400001F, 0xF8400C41} {
+		decoded := disassembler.Decode(word)
+		if decoded.Format != disassembler.FormatData {
+			t.Errorf("0x%08X decoded as %s, want data", word, decoded)
+			continue
+		}
+		if again := firstWord(assemble(t, decoded.String())); again != word {
+			t.Errorf("0x%08X disassembled into %q, which assembles into 0x%08X", word, decoded, again)
+		}
+	}
+}
+
+func TestRegisterAliases(t *testing.T) {
+	names := disassembler.AliasNames()
+	if len(names) != len(disassembler.RegisterAliases) {
+		t.Fatalf("AliasNames = %v, want every alias in RegisterAliases", names)
+	}
+	for _, alias := range names {
+		reg, exists := disassembler.AliasRegister(strings.ToLower(alias))
+		if !exists || disassembler.RegisterAliases[reg] != alias {
+			t.Errorf("AliasRegister(%q) = %d, %t", strings.ToLower(alias), reg, exists)
+			continue
+		}
+
+		// The assembler reads the alias as the same register the disassembler writes it for
+		src := "ADD " + alias + ", X0, X0"
+		decoded := disassembler.Decode(firstWord(assemble(t, src)))
+		if decoded.Rd != reg || disassembler.RegisterName(decoded.Rd) != alias {
+			t.Errorf("%q has Rd=%d (%s), want %d (%s)", src, decoded.Rd, disassembler.RegisterName(decoded.Rd), reg, alias)
+		}
+	}
+}
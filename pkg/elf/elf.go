@@ -0,0 +1,411 @@
+package elf
+
+import (
+	"bytes"
+	delf "debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshuaseligman/GoVM/pkg/sourcemap"
+)
+
+// The machine type of GoVM executables, which is not one of the standard ELF machines
+const MachineGoVM delf.Machine = 0x4756
+
+// The alignment of the segments in the file and in memory
+const segmentAlign = 4
+
+// The name of the section that holds the source map
+const linesSection = ".govm.lines"
+
+// The most bytes that are read for all of the segments together or for any other section, and the highest address a segment can end at,
+// so bad sizes in a file cannot use up the memory of the host
+const maxReadSize = 0x10000000
+
+// Struct for an entry of the source map as it is stored in the file
+type lineEntry struct {
+	Addr   uint64 // The address of the first byte placed by the line
+	Size   uint64 // The number of bytes placed by the line
+	File   uint32 // The offset of the file name in the string table
+	Line   uint32 // The line in the source
+	Column uint32 // The column the instruction or directive starts in
+	_      uint32 // Padding to keep the entries 8-byte aligned
+}
+
+// Struct for a part of the program that is loaded into memory
+type Segment struct {
+	Name       string  `json:"name"`       // The name of the section the segment holds
+	Addr       uint64  `json:"addr"`       // The address the segment is loaded at
+	Data       []uint8 `json:"data"`       // The bytes of the segment
+	Executable bool    `json:"executable"` // If the segment holds instructions rather than data
+}
+
+// Struct for a symbol in the symbol table of an executable
+type Symbol struct {
+	Name    string `json:"name"`    // The name of the symbol
+	Value   uint64 `json:"value"`   // The address of a label or the value of a constant
+	Section string `json:"section"` // The section a label is in, or "" for constants
+	Global  bool   `json:"global"`  // If the symbol was available to every object when the program was linked
+}
+
+// Struct for a GoVM program stored as an ELF64 executable
+type File struct {
+	Entry     uint64              `json:"entry"`     // The address of the first instruction to run
+	Segments  []Segment           `json:"segments"`  // The parts of the program to load into memory
+	Symbols   []Symbol            `json:"symbols"`   // The labels and constants of the program
+	SourceMap sourcemap.SourceMap `json:"sourceMap"` // The lines that placed each part of the program
+}
+
+// Gets the bytes of the ELF file, which is big-endian to match the memory of the CPU
+func (file *File) Bytes() []byte {
+	// The section headers are the null section, one for each segment, and the symbol table, string table, source map, and section name table
+	symtabIndex := len(file.Segments) + 1
+	strtabIndex := symtabIndex + 1
+	linesIndex := strtabIndex + 1
+	shstrtabIndex := linesIndex + 1
+
+	shstrtab := newStringTable()
+	strtab := newStringTable()
+
+	// The data of each segment comes right after the program headers
+	offset := uint64(binary.Size(delf.Header64{}) + len(file.Segments)*binary.Size(delf.Prog64{}))
+	progs := make([]delf.Prog64, len(file.Segments))
+	sections := make([]delf.Section64, 1, shstrtabIndex+1)
+	sectionIndexes := make(map[string]int)
+	for i, seg := range file.Segments {
+		offset = alignUp(offset, segmentAlign)
+		flags, secFlags := delf.PF_R|delf.PF_W, delf.SHF_ALLOC|delf.SHF_WRITE
+		if seg.Executable {
+			flags, secFlags = delf.PF_R|delf.PF_X, delf.SHF_ALLOC|delf.SHF_EXECINSTR
+		}
+		progs[i] = delf.Prog64{
+			Type:   uint32(delf.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    offset,
+			Vaddr:  seg.Addr,
+			Paddr:  seg.Addr,
+			Filesz: uint64(len(seg.Data)),
+			Memsz:  uint64(len(seg.Data)),
+			Align:  segmentAlign,
+		}
+		sections = append(sections, delf.Section64{
+			Name:      shstrtab.add(seg.Name),
+			Type:      uint32(delf.SHT_PROGBITS),
+			Flags:     uint64(secFlags),
+			Addr:      seg.Addr,
+			Off:       offset,
+			Size:      uint64(len(seg.Data)),
+			Addralign: segmentAlign,
+		})
+		sectionIndexes[seg.Name] = i + 1
+		offset += uint64(len(seg.Data))
+	}
+
+	// Local symbols have to come before global ones
+	syms := []delf.Sym64{{}}
+	for _, global := range []bool{false, true} {
+		for _, sym := range file.Symbols {
+			if sym.Global != global {
+				continue
+			}
+			bind := delf.STB_LOCAL
+			if sym.Global {
+				bind = delf.STB_GLOBAL
+			}
+			// Constants do not belong to a section
+			sectionIndex := uint16(delf.SHN_ABS)
+			if index, exists := sectionIndexes[sym.Section]; exists {
+				sectionIndex = uint16(index)
+			}
+			syms = append(syms, delf.Sym64{
+				Name:  strtab.add(sym.Name),
+				Info:  delf.ST_INFO(bind, delf.STT_NOTYPE),
+				Shndx: sectionIndex,
+				Value: sym.Value,
+			})
+		}
+	}
+	firstGlobal := len(syms)
+	for i, sym := range syms {
+		if delf.ST_BIND(sym.Info) == delf.STB_GLOBAL {
+			firstGlobal = i
+			break
+		}
+	}
+
+	var symtab bytes.Buffer
+	binary.Write(&symtab, binary.BigEndian, syms)
+
+	// The file names of the source map share the string table with the symbols
+	lines := make([]lineEntry, len(file.SourceMap))
+	for i, entry := range file.SourceMap {
+		lines[i] = lineEntry{Addr: entry.Addr, Size: entry.Size, File: strtab.add(entry.File), Line: uint32(entry.Line), Column: uint32(entry.Column)}
+	}
+	var linesData bytes.Buffer
+	binary.Write(&linesData, binary.BigEndian, lines)
+
+	offset = alignUp(offset, 8)
+	sections = append(sections, delf.Section64{
+		Name:      shstrtab.add(".symtab"),
+		Type:      uint32(delf.SHT_SYMTAB),
+		Off:       offset,
+		Size:      uint64(symtab.Len()),
+		Link:      uint32(strtabIndex),
+		Info:      uint32(firstGlobal),
+		Addralign: 8,
+		Entsize:   uint64(binary.Size(delf.Sym64{})),
+	})
+	offset += uint64(symtab.Len())
+
+	sections = append(sections, delf.Section64{
+		Name:      shstrtab.add(".strtab"),
+		Type:      uint32(delf.SHT_STRTAB),
+		Off:       offset,
+		Size:      uint64(strtab.Len()),
+		Addralign: 1,
+	})
+	offset += uint64(strtab.Len())
+
+	offset = alignUp(offset, 8)
+	sections = append(sections, delf.Section64{
+		Name:      shstrtab.add(linesSection),
+		Type:      uint32(delf.SHT_PROGBITS),
+		Off:       offset,
+		Size:      uint64(linesData.Len()),
+		Link:      uint32(strtabIndex),
+		Addralign: 8,
+		Entsize:   uint64(binary.Size(lineEntry{})),
+	})
+	offset += uint64(linesData.Len())
+
+	shstrtabName := shstrtab.add(".shstrtab")
+	sections = append(sections, delf.Section64{
+		Name:      shstrtabName,
+		Type:      uint32(delf.SHT_STRTAB),
+		Off:       offset,
+		Size:      uint64(shstrtab.Len()),
+		Addralign: 1,
+	})
+	offset += uint64(shstrtab.Len())
+
+	// The section headers go at the end of the file
+	sectionOffset := alignUp(offset, 8)
+	header := delf.Header64{
+		Type:      uint16(delf.ET_EXEC),
+		Machine:   uint16(MachineGoVM),
+		Version:   uint32(delf.EV_CURRENT),
+		Entry:     file.Entry,
+		Phoff:     uint64(binary.Size(delf.Header64{})),
+		Shoff:     sectionOffset,
+		Ehsize:    uint16(binary.Size(delf.Header64{})),
+		Phentsize: uint16(binary.Size(delf.Prog64{})),
+		Phnum:     uint16(len(progs)),
+		Shentsize: uint16(binary.Size(delf.Section64{})),
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(shstrtabIndex),
+	}
+	copy(header.Ident[:], delf.ELFMAG)
+	header.Ident[delf.EI_CLASS] = byte(delf.ELFCLASS64)
+	header.Ident[delf.EI_DATA] = byte(delf.ELFDATA2MSB)
+	header.Ident[delf.EI_VERSION] = byte(delf.EV_CURRENT)
+	header.Ident[delf.EI_OSABI] = byte(delf.ELFOSABI_STANDALONE)
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, header)
+	binary.Write(&out, binary.BigEndian, progs)
+	for _, seg := range file.Segments {
+		pad(&out, segmentAlign)
+		out.Write(seg.Data)
+	}
+	pad(&out, 8)
+	out.Write(symtab.Bytes())
+	out.Write(strtab.Bytes())
+	pad(&out, 8)
+	out.Write(linesData.Bytes())
+	out.Write(shstrtab.Bytes())
+	pad(&out, 8)
+	binary.Write(&out, binary.BigEndian, sections)
+	return out.Bytes()
+}
+
+// Writes the executable to a file
+func (file *File) WriteFile(filePath string) error {
+	return os.WriteFile(filePath, file.Bytes(), 0644)
+}
+
+// Reads a GoVM executable from an ELF file
+func Read(r io.ReaderAt) (*File, error) {
+	f, err := delf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Make sure the file is meant for the CPU
+	switch {
+	case f.Class != delf.ELFCLASS64:
+		return nil, fmt.Errorf("Not a GoVM executable: Expected a 64-bit ELF file but got %s", f.Class)
+	case f.Data != delf.ELFDATA2MSB:
+		return nil, fmt.Errorf("Not a GoVM executable: Expected a big-endian ELF file but got %s", f.Data)
+	case f.Machine != MachineGoVM:
+		return nil, fmt.Errorf("Not a GoVM executable: Expected machine 0x%X but got %s", uint16(MachineGoVM), f.Machine)
+	case f.Type != delf.ET_EXEC:
+		return nil, fmt.Errorf("Not a GoVM executable: Expected an executable but got %s", f.Type)
+	case f.Entry%4 != 0:
+		return nil, fmt.Errorf("Bad entry point: 0x%X is not word aligned", f.Entry)
+	}
+
+	file := &File{Entry: f.Entry, Segments: make([]Segment, 0), Symbols: make([]Symbol, 0), SourceMap: make(sourcemap.SourceMap, 0)}
+	loadSize := uint64(0)
+	for _, prog := range f.Progs {
+		if prog.Type != delf.PT_LOAD {
+			continue
+		}
+		// The sizes come from the file, so they have to be checked before anything is made from them
+		if prog.Filesz > prog.Memsz {
+			return nil, fmt.Errorf("Bad segment: The segment at 0x%X has %d bytes in the file but only %d bytes in memory", prog.Vaddr, prog.Filesz, prog.Memsz)
+		}
+		if prog.Memsz > maxReadSize-loadSize {
+			return nil, fmt.Errorf("Bad segment: The segments need more than the limit of %d bytes", maxReadSize)
+		}
+		if prog.Vaddr > maxReadSize || prog.Memsz > maxReadSize-prog.Vaddr {
+			return nil, fmt.Errorf("Bad segment: The segment at 0x%X with %d bytes ends past the limit of 0x%X", prog.Vaddr, prog.Memsz, maxReadSize)
+		}
+		loadSize += prog.Memsz
+
+		// Anything past the data in the file is filled with 0s
+		data := make([]uint8, prog.Memsz)
+		if _, err := prog.ReadAt(data[:prog.Filesz], 0); err != nil && err != io.EOF {
+			return nil, err
+		}
+		seg := Segment{Addr: prog.Vaddr, Data: data, Executable: prog.Flags&delf.PF_X != 0}
+		for _, sec := range f.Sections {
+			if sec.Flags&delf.SHF_ALLOC != 0 && sec.Addr == prog.Vaddr {
+				seg.Name = sec.Name
+				break
+			}
+		}
+		file.Segments = append(file.Segments, seg)
+	}
+
+	if sec := f.SectionByType(delf.SHT_SYMTAB); sec != nil {
+		if err := checkTableSize(f, sec); err != nil {
+			return nil, err
+		}
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != delf.ErrNoSymbols {
+		return nil, err
+	}
+	for _, sym := range syms {
+		section := ""
+		if sym.Section != delf.SHN_ABS && int(sym.Section) < len(f.Sections) {
+			section = f.Sections[sym.Section].Name
+		}
+		file.Symbols = append(file.Symbols, Symbol{
+			Name:    sym.Name,
+			Value:   sym.Value,
+			Section: section,
+			Global:  delf.ST_BIND(sym.Info) == delf.STB_GLOBAL,
+		})
+	}
+
+	// Executables from other tools might not have a source map
+	if sec := f.Section(linesSection); sec != nil && int(sec.Link) < len(f.Sections) {
+		if err := checkTableSize(f, sec); err != nil {
+			return nil, err
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, err
+		}
+		strtab, err := f.Sections[sec.Link].Data()
+		if err != nil {
+			return nil, err
+		}
+		lines := make([]lineEntry, len(data)/binary.Size(lineEntry{}))
+		if err := binary.Read(bytes.NewReader(data), binary.BigEndian, lines); err != nil {
+			return nil, err
+		}
+		for _, entry := range lines {
+			file.SourceMap = append(file.SourceMap, sourcemap.Entry{Addr: entry.Addr, Size: entry.Size, File: getString(strtab, entry.File), Line: int(entry.Line), Column: int(entry.Column)})
+		}
+	}
+	return file, nil
+}
+
+// Makes sure a table and the string table it links to are small enough to read
+func checkTableSize(f *delf.File, sec *delf.Section) error {
+	tables := []*delf.Section{sec}
+	if int(sec.Link) < len(f.Sections) {
+		tables = append(tables, f.Sections[sec.Link])
+	}
+	for _, table := range tables {
+		if table.Size > maxReadSize {
+			return fmt.Errorf("Bad section: Section %s has %d bytes but the limit is %d bytes", table.Name, table.Size, maxReadSize)
+		}
+	}
+	return nil
+}
+
+// Reads a GoVM executable from the ELF file at the path
+func ReadFile(filePath string) (*File, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Struct for building a table of null-terminated strings
+type stringTable struct {
+	bytes.Buffer
+	offsets map[string]uint32 // The offset of each string that has been added
+}
+
+// Function that creates a string table, which always starts with the empty string
+func newStringTable() *stringTable {
+	table := &stringTable{offsets: make(map[string]uint32)}
+	table.WriteByte(0)
+	table.offsets[""] = 0
+	return table
+}
+
+// Adds a string to the table if it is not there yet and returns its offset
+func (table *stringTable) add(str string) uint32 {
+	if offset, exists := table.offsets[str]; exists {
+		return offset
+	}
+	offset := uint32(table.Len())
+	table.WriteString(str)
+	table.WriteByte(0)
+	table.offsets[str] = offset
+	return offset
+}
+
+// Gets the null-terminated string at the offset of a string table
+func getString(table []byte, offset uint32) string {
+	if int(offset) >= len(table) {
+		return ""
+	}
+	end := bytes.IndexByte(table[offset:], 0)
+	if end < 0 {
+		return string(table[offset:])
+	}
+	return string(table[offset : int(offset)+end])
+}
+
+// Pads the buffer with 0s until its length is a multiple of the alignment
+func pad(buf *bytes.Buffer, align int) {
+	for buf.Len()%align != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// Rounds a value up to the next multiple of the alignment
+func alignUp(val uint64, align uint64) uint64 {
+	return (val + align - 1) / align * align
+}
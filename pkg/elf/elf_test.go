@@ -0,0 +1,143 @@
+package elf
+
+import (
+	"bytes"
+	delf "debug/elf"
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/joshuaseligman/GoVM/pkg/sourcemap"
+)
+
+// Gets a small executable with 2 segments, symbols, and a source map
+func testFile() *File {
+	return &File{
+		Entry: 0x8,
+		Segments: []Segment{
+			{Name: ".text", Addr: 0x0, Data: []uint8{0x91, 0x00, 0x04, 0x21, 0x00, 0x00, 0x00, 0x00}, Executable: true},
+			{Name: ".data", Addr: 0x100, Data: []uint8{0x12, 0x34}},
+		},
+		Symbols: []Symbol{
+			{Name: "local", Value: 0x4, Section: ".text"},
+			{Name: "N", Value: 42},
+			{Name: "main", Value: 0x8, Section: ".text", Global: true},
+			{Name: "table", Value: 0x100, Section: ".data", Global: true},
+		},
+		SourceMap: sourcemap.SourceMap{
+			{Addr: 0x0, Size: 4, File: "main.s", Line: 3, Column: 5},
+			{Addr: 0x100, Size: 2, File: "data.s", Line: 1, Column: 1},
+		},
+	}
+}
+
+// Changes a 64-bit field of the bytes of an ELF file
+func putField(data []byte, offset uint64, val uint64) {
+	binary.BigEndian.PutUint64(data[offset:], val)
+}
+
+// Gets the offset of the header of the section with the index
+func sectionHeader(data []byte, index int) uint64 {
+	shoff := binary.BigEndian.Uint64(data[0x28:])
+	return shoff + uint64(index*binary.Size(delf.Section64{}))
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		file *File
+	}{
+		{"Full", testFile()},
+		{"Only text", &File{Entry: 0, Segments: []Segment{{Name: ".text", Addr: 0, Data: []uint8{0, 0, 0, 0}, Executable: true}}, Symbols: []Symbol{}, SourceMap: sourcemap.SourceMap{}}},
+		{"No segments", &File{Entry: 0x40, Segments: []Segment{}, Symbols: []Symbol{{Name: "only", Value: 1}}, SourceMap: sourcemap.SourceMap{}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(tc.file.Bytes()))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			// Local symbols are written before global ones, so the order can change
+			want := *tc.file
+			want.Symbols = append([]Symbol{}, want.Symbols...)
+			for _, syms := range [][]Symbol{want.Symbols, got.Symbols} {
+				sort.Slice(syms, func(i, j int) bool {
+					return syms[i].Name < syms[j].Name
+				})
+			}
+
+			if got.Entry != want.Entry {
+				t.Errorf("Entry = 0x%X, want 0x%X", got.Entry, want.Entry)
+			}
+			if !reflect.DeepEqual(got.Segments, want.Segments) {
+				t.Errorf("Segments = %+v, want %+v", got.Segments, want.Segments)
+			}
+			if !reflect.DeepEqual(got.Symbols, want.Symbols) {
+				t.Errorf("Symbols = %+v, want %+v", got.Symbols, want.Symbols)
+			}
+			if !reflect.DeepEqual(got.SourceMap, want.SourceMap) {
+				t.Errorf("SourceMap = %+v, want %+v", got.SourceMap, want.SourceMap)
+			}
+		})
+	}
+}
+
+func TestReadNotGoVM(t *testing.T) {
+	data := testFile().Bytes()
+	// The machine is the 2 bytes after the type
+	binary.BigEndian.PutUint16(data[0x12:], uint16(delf.EM_AARCH64))
+	if _, err := Read(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "Not a GoVM executable") {
+		t.Errorf("err = %v, want a machine error", err)
+	}
+}
+
+func TestReadBadSizes(t *testing.T) {
+	progHeader := uint64(binary.Size(delf.Header64{}))
+	symtabHeader := func(data []byte) uint64 {
+		return sectionHeader(data, len(testFile().Segments)+1)
+	}
+
+	tests := []struct {
+		name   string
+		change func(data []byte)
+		err    string
+	}{
+		{"More in the file than in memory", func(data []byte) {
+			putField(data, progHeader+32, 4) // Filesz
+			putField(data, progHeader+40, 1) // Memsz
+		}, "Bad segment"},
+		{"Huge segment", func(data []byte) {
+			putField(data, progHeader+40, 1<<62)
+		}, "Bad segment"},
+		{"Segments too large together", func(data []byte) {
+			putField(data, progHeader+40, maxReadSize)
+		}, "Bad segment"},
+		{"Segment past the address limit", func(data []byte) {
+			putField(data, progHeader+16, maxReadSize) // Vaddr
+		}, "Bad segment"},
+		{"Segment that wraps around", func(data []byte) {
+			putField(data, progHeader+16, ^uint64(0)-3)
+		}, "Bad segment"},
+		{"Entry point not word aligned", func(data []byte) {
+			putField(data, 0x18, 0x6) // Entry
+		}, "Bad entry point"},
+		{"Huge symbol table", func(data []byte) {
+			putField(data, symtabHeader(data)+32, 1<<62)
+		}, "Bad section"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := testFile().Bytes()
+			tc.change(data)
+			_, err := Read(bytes.NewReader(data))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ type Alu struct {
 	zeroFlag bool // Flag for a zero output
 	overflowFlag bool // Flag for an overflow
 	carryFlag bool // Flag for a carry
+	cycles int // The number of steps the last multiply or divide took, which is 1 for each bit it worked on
 }
 
 // Struct for managing the adder
@@ -35,16 +36,23 @@ func NewAlu() *Alu {
 
 // Function that adds 2 numbers
 func (alu *Alu) Add(num1 uint64, num2 uint64) uint64 {
+	return alu.addWithCarry(num1, num2, 0)
+}
+
+// Function that subtracts the second number from the first by adding its inverse with a carry in, so the carry flag is set when there is no borrow
+func (alu *Alu) Subtract(num1 uint64, num2 uint64) uint64 {
+	return alu.addWithCarry(num1, ^num2, 1)
+}
+
+// Function that adds 2 numbers and the carry in with a ripple-carry adder
+func (alu *Alu) addWithCarry(num1 uint64, num2 uint64, carryIn uint64) uint64 {
 	// Grab the initial signs for overflow check
 	num1Sign := num1 >> 63
 	num2Sign := num2 >> 63
 
 	// Initialize the sum and carry
 	sum := uint64(0)
-	carry := uint64(0)
-	if alu.carryFlag {
-		carry = 1
-	}
+	carry := carryIn
 
 	for i := 0; i < 64; i++ {
 		// Get the next bits to add
@@ -114,7 +122,7 @@ func (alu *Alu) halfAdder(bit1 uint64, bit2 uint64) adderOutput {
 }
 
 
-// Function for multiplying 2 numbers
+// Function for multiplying 2 unsigned numbers, which gives the top and bottom 64 bits of the 128-bit product
 func (alu *Alu) Multiply(multiplicand uint64, multiplier uint64) []uint64 {
 	alu.ClearFlags()
 
@@ -125,7 +133,11 @@ func (alu *Alu) Multiply(multiplicand uint64, multiplier uint64) []uint64 {
 
 	var wg sync.WaitGroup
 
-	for i := 0; i < 64; i++ {
+	// Stop early once there are no more 1s in the multiplier to add for
+	alu.cycles = 1
+	for i := 0; i < 64 && multiplier != 0; i++ {
+		alu.cycles = i + 1
+
 		lastMultiplierBit := multiplier & 0b1
 
 		// Make a copy to make sure current values are used
@@ -138,7 +150,7 @@ func (alu *Alu) Multiply(multiplicand uint64, multiplier uint64) []uint64 {
 		go func () {
 			defer wg.Done()
 			multiplier = multiplier >> 1
-			topMultiplicandBit := multiplicand >> 31
+			topMultiplicandBit := multiplicand >> 63
 			multiplicand = multiplicand << 1
 			multiplicandTop = multiplicandTop << 1 | topMultiplicandBit
 		}()
@@ -147,8 +159,13 @@ func (alu *Alu) Multiply(multiplicand uint64, multiplier uint64) []uint64 {
 		go func() {
 			defer wg.Done()
 			if lastMultiplierBit == 1 {
+				// The carry out of the bottom half goes into the top half
 				productBottom = alu.Add(mbCopy, productBottom)
-				productTop = alu.Add(mtCopy, productTop)
+				carry := uint64(0)
+				if alu.carryFlag {
+					carry = 1
+				}
+				productTop = alu.addWithCarry(mtCopy, productTop, carry)
 			}
 		}()
 
@@ -156,9 +173,139 @@ func (alu *Alu) Multiply(multiplicand uint64, multiplier uint64) []uint64 {
 
 	}
 
+	alu.ClearFlags()
 	return []uint64{productTop, productBottom}
 }
 
+// Function for multiplying 2 signed numbers, which gives the top and bottom 64 bits of the 128-bit product
+func (alu *Alu) MultiplySigned(multiplicand uint64, multiplier uint64) []uint64 {
+	product := alu.Multiply(multiplicand, multiplier)
+
+	// A negative number is 2^64 more as an unsigned number, which adds 2^64 times the other number to the top half
+	if multiplicand >> 63 == 1 {
+		product[0] = alu.Subtract(product[0], multiplier)
+	}
+	if multiplier >> 63 == 1 {
+		product[0] = alu.Subtract(product[0], multiplicand)
+	}
+
+	alu.ClearFlags()
+	return product
+}
+
+// Function for dividing 2 unsigned numbers with a restoring divider, which gives the quotient and remainder
+func (alu *Alu) Divide(dividend uint64, divisor uint64) []uint64 {
+	alu.ClearFlags()
+
+	// Dividing by 0 gives 0 instead of stopping the program
+	if divisor == 0 {
+		alu.cycles = 1
+		return []uint64{0, dividend}
+	}
+
+	quotient := uint64(0)
+	remainder := uint64(0)
+
+	// Each step finds 1 bit of the quotient, starting from the top
+	for i := 63; i >= 0; i-- {
+		// Bring down the next bit of the dividend, keeping the bit that gets shifted out of the remainder
+		topRemainderBit := remainder >> 63
+		remainder = remainder << 1 | dividend >> i & 0b1
+
+		// The divisor goes in if subtracting it does not borrow
+		difference := alu.Subtract(remainder, divisor)
+		if topRemainderBit == 1 || alu.carryFlag {
+			remainder = difference
+			quotient = quotient << 1 | 1
+		} else {
+			quotient = quotient << 1
+		}
+	}
+	alu.cycles = 64
+
+	alu.ClearFlags()
+	return []uint64{quotient, remainder}
+}
+
+// Function for dividing 2 signed numbers, which gives the quotient rounded toward 0 and the remainder with the sign of the dividend
+func (alu *Alu) DivideSigned(dividend uint64, divisor uint64) []uint64 {
+	dividendNegative := dividend >> 63 == 1
+	divisorNegative := divisor >> 63 == 1
+
+	// Divide the sizes of the numbers
+	if dividendNegative {
+		dividend = alu.Negate(dividend)
+	}
+	if divisorNegative {
+		divisor = alu.Negate(divisor)
+	}
+	result := alu.Divide(dividend, divisor)
+
+	// Put the signs back
+	if dividendNegative != divisorNegative {
+		result[0] = alu.Negate(result[0])
+	}
+	if dividendNegative {
+		result[1] = alu.Negate(result[1])
+	}
+	return result
+}
+
+// Function that ANDs the bits of 2 numbers
+func (alu *Alu) And(num1 uint64, num2 uint64) uint64 {
+	out := num1 & num2
+	alu.setLogicFlags(out)
+	return out
+}
+
+// Function that ORs the bits of 2 numbers
+func (alu *Alu) Or(num1 uint64, num2 uint64) uint64 {
+	out := num1 | num2
+	alu.setLogicFlags(out)
+	return out
+}
+
+// Function that XORs the bits of 2 numbers
+func (alu *Alu) Xor(num1 uint64, num2 uint64) uint64 {
+	out := num1 ^ num2
+	alu.setLogicFlags(out)
+	return out
+}
+
+// Updates the flags for the output of a logical operation, which can never carry or overflow
+func (alu *Alu) setLogicFlags(out uint64) {
+	alu.negativeFlag = ((out >> 63) == 1)
+	alu.zeroFlag = (out == 0)
+	alu.overflowFlag = false
+	alu.carryFlag = false
+}
+
+// Function that shifts a number left by the given amount, filling in 0s
+func (alu *Alu) ShiftLeft(num uint64, shiftAmt uint64) uint64 {
+	return alu.barrelShifter(num, shiftAmt, true)
+}
+
+// Function that shifts a number right by the given amount, filling in 0s
+func (alu *Alu) ShiftRight(num uint64, shiftAmt uint64) uint64 {
+	return alu.barrelShifter(num, shiftAmt, false)
+}
+
+// Function that represents a barrel shifter, which has a stage for each bit of the 6-bit shift amount
+func (alu *Alu) barrelShifter(num uint64, shiftAmt uint64, left bool) uint64 {
+	for stage := 0; stage < 6; stage++ {
+		// Each stage either passes the number through or shifts it by 2^stage
+		if shiftAmt >> stage & 0b1 == 0 {
+			continue
+		}
+		if left {
+			num = num << (1 << stage)
+		} else {
+			num = num >> (1 << stage)
+		}
+	}
+	return num
+}
+
 // Negates a number using 2's complement
 func (alu *Alu) Negate(num uint64) uint64 {
 	out := ^num + 1
@@ -184,4 +331,5 @@ func (alu *Alu) Reset() {
 	alu.zeroFlag = false
 	alu.overflowFlag = false
 	alu.carryFlag = false
+	alu.cycles = 0
 }
\ No newline at end of file
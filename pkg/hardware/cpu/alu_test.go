@@ -0,0 +1,263 @@
+package cpu
+
+import (
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+func TestAluLogic(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       func(alu *Alu, num1 uint64, num2 uint64) uint64
+		num1     uint64
+		num2     uint64
+		out      uint64
+		negative bool
+		zero     bool
+	}{
+		{"AND", (*Alu).And, 0xF0F0, 0xFF00, 0xF000, false, false},
+		{"AND zero", (*Alu).And, 0xF0F0, 0x0F0F, 0, false, true},
+		{"AND negative", (*Alu).And, 0x8000000000000001, 0xFFFFFFFFFFFFFFFF, 0x8000000000000001, true, false},
+		{"OR", (*Alu).Or, 0xF0F0, 0x0F0F, 0xFFFF, false, false},
+		{"OR zero", (*Alu).Or, 0, 0, 0, false, true},
+		{"OR negative", (*Alu).Or, 0x8000000000000000, 1, 0x8000000000000001, true, false},
+		{"XOR", (*Alu).Xor, 0xFF00, 0x0FF0, 0xF0F0, false, false},
+		{"XOR zero", (*Alu).Xor, 0x1234, 0x1234, 0, false, true},
+		{"XOR negative", (*Alu).Xor, 0x7FFFFFFFFFFFFFFF, 0xFFFFFFFFFFFFFFFF, 0x8000000000000000, true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alu := NewAlu()
+			// Logical operations can never carry or overflow, so old flags have to be cleared
+			alu.carryFlag = true
+			alu.overflowFlag = true
+
+			if out := tc.op(alu, tc.num1, tc.num2); out != tc.out {
+				t.Errorf("out = 0x%X, want 0x%X", out, tc.out)
+			}
+			if alu.negativeFlag != tc.negative || alu.zeroFlag != tc.zero || alu.carryFlag || alu.overflowFlag {
+				t.Errorf("NZCV = %t %t %t %t, want %t %t false false", alu.negativeFlag, alu.zeroFlag, alu.carryFlag, alu.overflowFlag, tc.negative, tc.zero)
+			}
+		})
+	}
+}
+
+func TestAluShift(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       func(alu *Alu, num uint64, shiftAmt uint64) uint64
+		num      uint64
+		shiftAmt uint64
+		out      uint64
+	}{
+		{"LSL 0", (*Alu).ShiftLeft, 0x1234, 0, 0x1234},
+		{"LSL 1", (*Alu).ShiftLeft, 0x1234, 1, 0x2468},
+		{"LSL 12", (*Alu).ShiftLeft, 0xABC, 12, 0xABC000},
+		{"LSL 63", (*Alu).ShiftLeft, 0x3, 63, 0x8000000000000000},
+		{"LSL out of the top", (*Alu).ShiftLeft, 0xFF00000000000000, 8, 0},
+		{"LSR 0", (*Alu).ShiftRight, 0x1234, 0, 0x1234},
+		{"LSR 4", (*Alu).ShiftRight, 0x1234, 4, 0x123},
+		{"LSR fills with 0", (*Alu).ShiftRight, 0x8000000000000000, 1, 0x4000000000000000},
+		{"LSR 63", (*Alu).ShiftRight, 0xFFFFFFFFFFFFFFFF, 63, 1},
+		{"LSR 37", (*Alu).ShiftRight, 0xFFFFFFFFFFFFFFFF, 37, 0x7FFFFFF},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alu := NewAlu()
+			alu.zeroFlag = true
+
+			if out := tc.op(alu, tc.num, tc.shiftAmt); out != tc.out {
+				t.Errorf("out = 0x%X, want 0x%X", out, tc.out)
+			}
+			// The shifter does not change the flags
+			if !alu.zeroFlag || alu.negativeFlag || alu.carryFlag || alu.overflowFlag {
+				t.Errorf("NZCV = %t %t %t %t, want false true false false", alu.negativeFlag, alu.zeroFlag, alu.carryFlag, alu.overflowFlag)
+			}
+		})
+	}
+}
+
+func TestAluSubtract(t *testing.T) {
+	tests := []struct {
+		name string
+		num1 uint64
+		num2 uint64
+		out  uint64
+		nzcv Nzcv
+	}{
+		{"Positive", 5, 3, 2, Nzcv{C: true}},
+		{"Equal", 7, 7, 0, Nzcv{Z: true, C: true}},
+		{"Borrow", 3, 5, 0xFFFFFFFFFFFFFFFE, Nzcv{N: true}},
+		{"Subtract 0", 0xFFFFFFFFFFFFFFFF, 0, 0xFFFFFFFFFFFFFFFF, Nzcv{N: true, C: true}},
+		{"0 minus 0", 0, 0, 0, Nzcv{Z: true, C: true}},
+		{"Overflow", 0x8000000000000000, 1, 0x7FFFFFFFFFFFFFFF, Nzcv{C: true, V: true}},
+		{"Overflow on the minimum", 0, 0x8000000000000000, 0x8000000000000000, Nzcv{N: true, V: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alu := NewAlu()
+			// A carry left over from an earlier operation must not change the result
+			alu.carryFlag = true
+
+			if out := alu.Subtract(tc.num1, tc.num2); out != tc.out {
+				t.Errorf("out = 0x%X, want 0x%X", out, tc.out)
+			}
+			if nzcv := nzcvFromAlu(alu); nzcv != tc.nzcv {
+				t.Errorf("NZCV = %s, want %s", nzcv, tc.nzcv)
+			}
+		})
+	}
+}
+
+func TestAluAddIgnoresCarryFlag(t *testing.T) {
+	alu := NewAlu()
+	alu.carryFlag = true
+	if out := alu.Add(1, 2); out != 3 {
+		t.Errorf("out = %d, want 3", out)
+	}
+}
+
+// Gets the top and bottom halves of the 128-bit signed product of 2 numbers
+func signedProduct(num1 uint64, num2 uint64) (uint64, uint64) {
+	top, bottom := bits.Mul64(num1, num2)
+	if int64(num1) < 0 {
+		top -= num2
+	}
+	if int64(num2) < 0 {
+		top -= num1
+	}
+	return top, bottom
+}
+
+// Gets the signed quotient and remainder of 2 numbers the way SDIV does, with 0 for dividing by 0
+func signedQuotient(num1 uint64, num2 uint64) (uint64, uint64) {
+	if num2 == 0 {
+		return 0, num1
+	}
+	if int64(num1) == -1<<63 && int64(num2) == -1 {
+		return num1, 0
+	}
+	return uint64(int64(num1) / int64(num2)), uint64(int64(num1) % int64(num2))
+}
+
+func TestAluMultiply(t *testing.T) {
+	tests := []struct {
+		name   string
+		num1   uint64
+		num2   uint64
+		cycles int
+	}{
+		{"0", 0x1234, 0, 1},
+		{"1", 0x1234, 1, 1},
+		{"Small", 6, 7, 3},
+		{"Carry into the top half", 0xFFFFFFFFFFFFFFFF, 0xFFFFFFFFFFFFFFFF, 64},
+		{"Top bit of the multiplicand", 0x8000000000000000, 2, 2},
+		{"Top bit of the multiplier", 3, 0x8000000000000000, 64},
+		{"Negative times positive", 0xFFFFFFFFFFFFFFFD, 5, 3},
+		{"Minimum squared", 0x8000000000000000, 0x8000000000000000, 64},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alu := NewAlu()
+			wantTop, wantBottom := bits.Mul64(tc.num1, tc.num2)
+			if out := alu.Multiply(tc.num1, tc.num2); out[0] != wantTop || out[1] != wantBottom {
+				t.Errorf("Multiply = 0x%X 0x%X, want 0x%X 0x%X", out[0], out[1], wantTop, wantBottom)
+			}
+			if alu.cycles != tc.cycles {
+				t.Errorf("cycles = %d, want %d", alu.cycles, tc.cycles)
+			}
+
+			wantTop, wantBottom = signedProduct(tc.num1, tc.num2)
+			if out := alu.MultiplySigned(tc.num1, tc.num2); out[0] != wantTop || out[1] != wantBottom {
+				t.Errorf("MultiplySigned = 0x%X 0x%X, want 0x%X 0x%X", out[0], out[1], wantTop, wantBottom)
+			}
+			// Multiplying does not set the flags
+			if nzcv := nzcvFromAlu(alu); nzcv != (Nzcv{}) {
+				t.Errorf("NZCV = %s, want nzcv", nzcv)
+			}
+		})
+	}
+}
+
+func TestAluDivide(t *testing.T) {
+	tests := []struct {
+		name string
+		num1 uint64
+		num2 uint64
+	}{
+		{"Exact", 42, 7},
+		{"Remainder", 43, 7},
+		{"Smaller dividend", 3, 7},
+		{"Divide by 1", 0xFFFFFFFFFFFFFFFF, 1},
+		{"Divide by 0", 0x1234, 0},
+		{"Divide 0 by 0", 0, 0},
+		{"Largest divisor", 0xFFFFFFFFFFFFFFFE, 0xFFFFFFFFFFFFFFFF},
+		{"Top bit of the divisor", 0xFFFFFFFFFFFFFFFF, 0x8000000000000001},
+		{"Negative dividend", 0xFFFFFFFFFFFFFFF9, 2},
+		{"Negative divisor", 7, 0xFFFFFFFFFFFFFFFE},
+		{"Both negative", 0xFFFFFFFFFFFFFFF9, 0xFFFFFFFFFFFFFFFE},
+		{"Minimum by -1", 0x8000000000000000, 0xFFFFFFFFFFFFFFFF},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alu := NewAlu()
+			wantQuotient, wantRemainder := uint64(0), tc.num1
+			wantCycles := 1
+			if tc.num2 != 0 {
+				wantQuotient, wantRemainder = tc.num1/tc.num2, tc.num1%tc.num2
+				wantCycles = 64
+			}
+			if out := alu.Divide(tc.num1, tc.num2); out[0] != wantQuotient || out[1] != wantRemainder {
+				t.Errorf("Divide = 0x%X 0x%X, want 0x%X 0x%X", out[0], out[1], wantQuotient, wantRemainder)
+			}
+			if alu.cycles != wantCycles {
+				t.Errorf("cycles = %d, want %d", alu.cycles, wantCycles)
+			}
+
+			wantQuotient, wantRemainder = signedQuotient(tc.num1, tc.num2)
+			if out := alu.DivideSigned(tc.num1, tc.num2); out[0] != wantQuotient || out[1] != wantRemainder {
+				t.Errorf("DivideSigned = 0x%X 0x%X, want 0x%X 0x%X", out[0], out[1], wantQuotient, wantRemainder)
+			}
+			// Dividing does not set the flags
+			if nzcv := nzcvFromAlu(alu); nzcv != (Nzcv{}) {
+				t.Errorf("NZCV = %s, want nzcv", nzcv)
+			}
+		})
+	}
+}
+
+func TestAluMultiplyDivideRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	alu := NewAlu()
+	for i := 0; i < 2000; i++ {
+		// Use small numbers some of the time so the early stop and small quotients are covered
+		num1, num2 := rng.Uint64(), rng.Uint64()
+		if i%2 == 0 {
+			num2 >>= rng.Intn(64)
+		}
+
+		top, bottom := bits.Mul64(num1, num2)
+		if out := alu.Multiply(num1, num2); out[0] != top || out[1] != bottom {
+			t.Fatalf("Multiply(0x%X, 0x%X) = 0x%X 0x%X, want 0x%X 0x%X", num1, num2, out[0], out[1], top, bottom)
+		}
+		top, bottom = signedProduct(num1, num2)
+		if out := alu.MultiplySigned(num1, num2); out[0] != top || out[1] != bottom {
+			t.Fatalf("MultiplySigned(0x%X, 0x%X) = 0x%X 0x%X, want 0x%X 0x%X", num1, num2, out[0], out[1], top, bottom)
+		}
+		if num2 != 0 {
+			if out := alu.Divide(num1, num2); out[0] != num1/num2 || out[1] != num1%num2 {
+				t.Fatalf("Divide(0x%X, 0x%X) = 0x%X 0x%X, want 0x%X 0x%X", num1, num2, out[0], out[1], num1/num2, num1%num2)
+			}
+		}
+		quotient, remainder := signedQuotient(num1, num2)
+		if out := alu.DivideSigned(num1, num2); out[0] != quotient || out[1] != remainder {
+			t.Fatalf("DivideSigned(0x%X, 0x%X) = 0x%X 0x%X, want 0x%X 0x%X", num1, num2, out[0], out[1], quotient, remainder)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package cpu
 import (
 	"fmt"
 
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
 	"github.com/joshuaseligman/GoVM/pkg/hardware"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/clock"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/memory"
@@ -14,6 +15,7 @@ type Cpu struct {
 	hw *hardware.Hardware // The hardware struct
 	reg []uint64 // Other registers
 	programCounter uint64 // The address of the current instruction being fetched
+	mem *memory.Memory // The memory the program is loaded in
 	fetchUnit *FetchUnit // The fetch unit
 	decodeUnit *DecodeUnit // The decode unit
 	executeUnit *ExecuteUnit // The execute unit
@@ -24,18 +26,32 @@ type Cpu struct {
 	exmemReg *EXMEMReg // The register between the execute and memory data units
 	memwbReg *MEMWBReg // The register between the memory data and writeback units
 	regLocks *util.Queue // Manages locks for reading and writing to registers
+	nzcv Nzcv // The condition flags that B.cond tests
 }
 
 // Struct for the CPU to be used with the API
 type CpuAPI struct {
 	Reg [32]uint64 `json:"registers"`// Other registers
 	ProgramCounter uint64 `json:"programCounter"` // The address of the current instruction being fetched
+	Nzcv Nzcv `json:"nzcv"` // The condition flags that B.cond tests
 	IfidReg *IFIDReg `json:"ifidReg"`// The register between the fetch and decode units
 	IdexReg *IDEXReg `json:"idexReg"` // The register between the decode and execute units
 	ExmemReg *EXMEMReg `json:"exmemReg"` // The register between the execute and memory data units
 	MemwbReg *MEMWBReg `json:"memwbReg"` // The register between the memory data and writeback units
+	IfidAssembly string `json:"ifidAssembly"` // The assembly of the instruction in the IFID register
+	IdexAssembly string `json:"idexAssembly"` // The assembly of the instruction in the IDEX register
+	ExmemAssembly string `json:"exmemAssembly"` // The assembly of the instruction in the EXMEM register
+	MemwbAssembly string `json:"memwbAssembly"` // The assembly of the instruction in the MEMWB register
+	ProgramCounterSource string `json:"programCounterSource"` // The source location of the instruction being fetched
+	IfidSource string `json:"ifidSource"` // The source location of the instruction in the IFID register
+	IdexSource string `json:"idexSource"` // The source location of the instruction in the IDEX register
+	ExmemSource string `json:"exmemSource"` // The source location of the instruction in the EXMEM register
+	MemwbSource string `json:"memwbSource"` // The source location of the instruction in the MEMWB register
 }
 
+// The register BL writes the return address to
+const linkRegister uint32 = 30
+
 var (
 	ifidChan chan *IFIDReg = make(chan *IFIDReg, 1) // The channel to manage async communication between fetch and decode units
 	idexChan chan *IDEXReg = make(chan *IDEXReg, 1) // The channel to manage async communication between decode and execute units
@@ -54,7 +70,8 @@ func NewCpu(mem *memory.Memory, clk *clock.Clock) *Cpu {
 	cpu := Cpu {
 		hw: hardware.NewHardware("CPU", 0),
 		reg: make([]uint64, 32),
-		programCounter: 0,
+		programCounter: mem.GetEntryPoint(),
+		mem: mem,
 		fetchUnit: NewFetchUnit(mem),
 		memDataUnit: NewMemDataUnit(mem),
 		regLocks: util.NewQueue(),
@@ -79,17 +96,22 @@ func (cpu *Cpu) Pulse() any {
 	// Clear the mem data unit and writeback next instruction if available
 	if len(endInstrChan) == 0 && len(memwbChan) == 1 && !writebackRunning {
 		cpu.memwbReg = <- memwbChan
-		cpu.Log(fmt.Sprintf("Starting writeback: %d", cpu.memwbReg.IncrementedPC - 4))
+		cpu.Log(fmt.Sprintf("Starting writeback: %d %s%s", cpu.memwbReg.IncrementedPC - 4, disassembler.Disassemble(cpu.memwbReg.Instr), cpu.locationSuffix(cpu.memwbReg.IncrementedPC - 4)))
 		go cpu.writebackUnit.HandleWriteback(endInstrChan, cpu.memwbReg)
 		writebackRunning = true
 		memRunning = false
 	}
 
+	// Multiply and divide results wait in the execute unit until all of their cycles are done
+	if len(exmemChan) == 1 && cpu.executeUnit.cyclesLeft > 0 {
+		cpu.executeUnit.cyclesLeft--
+	}
+
 	// Clear the execute unit and handle memory if available
-	if len(memwbChan) == 0 && len(exmemChan) == 1 && !memRunning {
+	if len(memwbChan) == 0 && len(exmemChan) == 1 && !memRunning && cpu.executeUnit.cyclesLeft == 0 {
 		cpu.exmemReg = <- exmemChan
 		executeRunning = false
-		cpu.Log(fmt.Sprintf("Starting mem data access: %d", cpu.exmemReg.IncrementedPC - 4))
+		cpu.Log(fmt.Sprintf("Starting mem data access: %d %s%s", cpu.exmemReg.IncrementedPC - 4, disassembler.Disassemble(cpu.exmemReg.Instr), cpu.locationSuffix(cpu.exmemReg.IncrementedPC - 4)))
 		go cpu.memDataUnit.HandleMemoryAccess(memwbChan, cpu.exmemReg)
 		memRunning = true
 	}
@@ -98,7 +120,7 @@ func (cpu *Cpu) Pulse() any {
 	if len(exmemChan) == 0 && len(idexChan) == 1 && !executeRunning && !cpu.executeUnit.flushing {
 		cpu.idexReg = <- idexChan
 		decodeRunning = false
-		cpu.Log(fmt.Sprintf("Starting execute: %d", cpu.idexReg.IncrementedPC - 4))
+		cpu.Log(fmt.Sprintf("Starting execute: %d %s%s", cpu.idexReg.IncrementedPC - 4, disassembler.Disassemble(cpu.idexReg.Instr), cpu.locationSuffix(cpu.idexReg.IncrementedPC - 4)))
 		go cpu.executeUnit.ExecuteInstruction(exmemChan, cpu.idexReg, &memRunning, &writebackRunning)
 		executeRunning = true
 	}
@@ -107,14 +129,14 @@ func (cpu *Cpu) Pulse() any {
 	if len(idexChan) == 0 && len(ifidChan) == 1 && !decodeRunning {
 		cpu.ifidReg = <- ifidChan
 		fetchRunning = false
-		cpu.Log(fmt.Sprintf("Starting decode: %d", cpu.ifidReg.IncrementedPC - 4))
+		cpu.Log(fmt.Sprintf("Starting decode: %d %s%s", cpu.ifidReg.IncrementedPC - 4, disassembler.Disassemble(cpu.ifidReg.Instr), cpu.locationSuffix(cpu.ifidReg.IncrementedPC - 4)))
 		go cpu.decodeUnit.DecodeInstruction(idexChan, cpu.ifidReg)
 		decodeRunning = true
 	}
 
 	// Fetch if available
 	if len(ifidChan) == 0 && !fetchRunning {
-		cpu.Log(fmt.Sprintf("Starting fetch: %d", cpu.programCounter))
+		cpu.Log(fmt.Sprintf("Starting fetch: %d%s", cpu.programCounter, cpu.locationSuffix(cpu.programCounter)))
 		go cpu.fetchUnit.FetchInstruction(ifidChan, &cpu.programCounter)
 		fetchRunning = true
 	}
@@ -153,6 +175,19 @@ func (cpu *Cpu) Log(msg string) {
 	cpu.hw.Log(msg)
 }
 
+// Gets the file, line, and column of the instruction at the address, or "" if the source of the program is not known
+func (cpu *Cpu) GetSourceLocation(addr uint64) string {
+	return cpu.mem.GetSourceMap().Locate(addr)
+}
+
+// Gets the source location of the address to add to the end of a log message
+func (cpu *Cpu) locationSuffix(addr uint64) string {
+	if location := cpu.GetSourceLocation(addr); location != "" {
+		return fmt.Sprintf(" (%s)", location)
+	}
+	return ""
+}
+
 // Gets the program counter
 func (cpu *Cpu) GetProgramCounter() uint64 {
 	return cpu.programCounter
@@ -183,6 +218,11 @@ func (cpu *Cpu) GetMEMWBReg() *MEMWBReg {
 	return cpu.memwbReg
 }
 
+// Gets the condition flags
+func (cpu *Cpu) GetNzcv() Nzcv {
+	return cpu.nzcv
+}
+
 // Gets the register locks queue
 func (cpu *Cpu) GetRegisterLocks() *util.Queue {
 	return cpu.regLocks
@@ -190,11 +230,13 @@ func (cpu *Cpu) GetRegisterLocks() *util.Queue {
 
 // Resets the CPU for future use
 func (cpu *Cpu) ResetCpu() {
-	// All registers go back to 0
+	// All registers and flags go back to 0
 	for i := 0; i < len(cpu.reg); i++ {
 		cpu.reg[i] = 0x0
 	}
-	cpu.programCounter = 0x0
+	cpu.nzcv = Nzcv{}
+	// The program starts over from its entry point
+	cpu.programCounter = cpu.mem.GetEntryPoint()
 
 	// Reset the units that have data in them
 	cpu.fetchUnit.Reset()
@@ -243,12 +285,34 @@ func (cpu *Cpu) ConvertAPI() *CpuAPI {
 	newReg := [32]uint64{}
 	copy(newReg[:], cpu.reg)
 
-	return & CpuAPI {
+	cpuAPI := & CpuAPI {
 		Reg: newReg,
 		ProgramCounter: cpu.programCounter,
+		Nzcv: cpu.nzcv,
 		IfidReg: cpu.ifidReg,
 		IdexReg: cpu.idexReg,
 		ExmemReg: cpu.exmemReg,
 		MemwbReg: cpu.memwbReg,
+		ProgramCounterSource: cpu.GetSourceLocation(cpu.programCounter),
+	}
+
+	// Show the instructions in each stage of the pipeline as assembly along with where they are in the source
+	if cpu.ifidReg != nil {
+		cpuAPI.IfidAssembly = disassembler.Disassemble(cpu.ifidReg.Instr)
+		cpuAPI.IfidSource = cpu.GetSourceLocation(cpu.ifidReg.IncrementedPC - 4)
 	}
+	if cpu.idexReg != nil {
+		cpuAPI.IdexAssembly = disassembler.Disassemble(cpu.idexReg.Instr)
+		cpuAPI.IdexSource = cpu.GetSourceLocation(cpu.idexReg.IncrementedPC - 4)
+	}
+	if cpu.exmemReg != nil {
+		cpuAPI.ExmemAssembly = disassembler.Disassemble(cpu.exmemReg.Instr)
+		cpuAPI.ExmemSource = cpu.GetSourceLocation(cpu.exmemReg.IncrementedPC - 4)
+	}
+	if cpu.memwbReg != nil {
+		cpuAPI.MemwbAssembly = disassembler.Disassemble(cpu.memwbReg.Instr)
+		cpuAPI.MemwbSource = cpu.GetSourceLocation(cpu.memwbReg.IncrementedPC - 4)
+	}
+
+	return cpuAPI
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
 	"github.com/joshuaseligman/GoVM/pkg/hardware"
 	"github.com/joshuaseligman/GoVM/pkg/util"
 )
@@ -26,7 +27,7 @@ func NewDecodeUnit(parentCpu *Cpu) *DecodeUnit {
 // Function that decodes an instruction into its operands
 func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 	opcode := ifidReg.Instr >> 21
-	idu.Log(fmt.Sprintf("%X", opcode))
+	idu.Log(disassembler.Disassemble(ifidReg.Instr))
 
 	// Branch instructions
 	if opcode >= 0x0A0 && opcode <= 0x0BF { // B
@@ -41,6 +42,35 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 		return
 	}
 
+	// Branch and link, which writes the return address to the link register
+	if opcode >= 0x4A0 && opcode <= 0x4BF { // BL
+		branchAddr := ifidReg.Instr & 0x3FFFFFF
+		signExtendBranchAddr := util.SignExtend(branchAddr, 26)
+
+		// Lock LR so a RET or anything else reading it waits for the return address to be written
+		idu.cpu.GetRegisterLocks().Enqueue(linkRegister)
+		out <- &IDEXReg{
+			Instr:         ifidReg.Instr,
+			IncrementedPC: ifidReg.IncrementedPC,
+			SignExtendImm: signExtendBranchAddr,
+			addedLock:     true,
+		}
+		return
+	}
+
+	// Conditional branch on the flags, which are read when it is executed
+	if opcode >= 0x2A0 && opcode <= 0x2A7 { // B.cond
+		branchAddr := ifidReg.Instr & 0xFFFFFF >> 5
+		signExtendBranchAddr := util.SignExtend(branchAddr, 19)
+
+		out <- &IDEXReg{
+			Instr:         ifidReg.Instr,
+			IncrementedPC: ifidReg.IncrementedPC,
+			SignExtendImm: signExtendBranchAddr,
+		}
+		return
+	}
+
 	// Conditional branch instructions
 	if opcode >= 0x5A0 && opcode <= 0x5A7 || // CBZ
 		opcode >= 0x5A8 && opcode <= 0x5AF { // CBNZ
@@ -66,9 +96,6 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 	case 0x694, 0x695, 0x696, 0x697: // MOVZ
 		// Register to write to
 		regWrite := ifidReg.Instr & 0x1F
-		if regWrite == 0x1F {
-			log.Fatalf("Bad regsiter write; cannot write to register XZR; PC: %d", ifidReg.IncrementedPC-4)
-		}
 
 		// Immediate to write
 		immediate := ifidReg.Instr & 0x1FFFFF >> 5
@@ -86,9 +113,6 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 	case 0x794, 0x795, 0x796, 0x797: // MOVK
 		// Register to write to
 		regWrite := ifidReg.Instr & 0x1F
-		if regWrite == 0x1F {
-			log.Fatalf("Bad regsiter write; cannot write to register XZR; PC: %d", ifidReg.IncrementedPC-4)
-		}
 
 		// Wait until the updated value is written
 		for idu.cpu.GetRegisterLocks().Contains(regWrite) {
@@ -109,7 +133,9 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 			addedLock:     true,
 		}
 
-	case 0x458, 0x558, 0x658, 0x758: // ADD, ADDS, SUB
+	case 0x458, 0x558, 0x658, 0x758, // ADD, ADDS, SUB, SUBS
+		0x450, 0x750, 0x550, 0x650, // AND, ANDS, ORR, EOR
+		0x4D8, 0x4DA, 0x4DE, 0x4D6: // MUL, SMULH, UMULH, SDIV/UDIV
 		// Registers to read from
 		reg1 := ifidReg.Instr & 0x1FFFFF >> 16
 		reg2 := ifidReg.Instr & 0x3FF >> 5
@@ -124,9 +150,6 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 
 		// Add the write register to the queue
 		regWrite := ifidReg.Instr & 0x1F
-		if regWrite == 0x1F {
-			log.Fatalf("Bad regsiter write; cannot write to register XZR; PC: %d", ifidReg.IncrementedPC-4)
-		}
 
 		idu.cpu.GetRegisterLocks().Enqueue(regWrite)
 		out <- &IDEXReg{
@@ -138,10 +161,38 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 			addedLock:     true,
 		}
 
+	case 0x69B, 0x69A: // LSL, LSR
+		// Get the shift amount
+		shiftAmt := ifidReg.Instr & 0xFFFF >> 10
+
+		// Get the most updated value to shift
+		regRead := ifidReg.Instr & 0x3FF >> 5
+		for idu.cpu.GetRegisterLocks().Contains(regRead) {
+			continue
+		}
+		regData1 := idu.cpu.GetRegisters()[regRead]
+
+		// Add the destination register to the queue
+		regWrite := ifidReg.Instr & 0x1F
+
+		idu.cpu.GetRegisterLocks().Enqueue(regWrite)
+		out <- &IDEXReg{
+			Instr:         ifidReg.Instr,
+			IncrementedPC: ifidReg.IncrementedPC,
+			RegReadData1:  regData1,
+			RegReadData2:  0,
+			SignExtendImm: uint64(shiftAmt),
+			addedLock:     true,
+		}
+
 	case 0x488, 0x489, // ADDI
 		0x588, 0x589, // ADDIS
 		0x688, 0x689, // SUBI
-		0x788, 0x789: // SUBIS
+		0x788, 0x789, // SUBIS
+		0x490, 0x491, // ANDI
+		0x790, 0x791, // ANDIS
+		0x590, 0x591, // ORRI
+		0x690, 0x691: // EORI
 		// Get the immediate value
 		immediate := ifidReg.Instr & 0x3FFFFF >> 10
 		signExtendImm := util.SignExtend(immediate, 32)
@@ -155,9 +206,6 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 
 		// Add the destination register to the queue
 		regWrite := ifidReg.Instr & 0x1F
-		if regWrite == 0x1F {
-			log.Fatalf("Bad regsiter write; cannot write to register XZR; PC: %d", ifidReg.IncrementedPC-4)
-		}
 
 		idu.cpu.GetRegisterLocks().Enqueue(regWrite)
 		out <- &IDEXReg{
@@ -184,9 +232,6 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 
 		// Add the destination register to the queue
 		regWrite := ifidReg.Instr & 0x1F
-		if regWrite == 0x1F {
-			log.Fatalf("Bad regsiter write; cannot write to register XZR; PC: %d", ifidReg.IncrementedPC-4)
-		}
 
 		idu.cpu.GetRegisterLocks().Enqueue(regWrite)
 		out <- &IDEXReg{
@@ -220,11 +265,31 @@ func (idu *DecodeUnit) DecodeInstruction(out chan *IDEXReg, ifidReg *IFIDReg) {
 			RegReadData2:  regData2,
 			SignExtendImm: signExtendImm,
 		}
+
+	case 0x6B0: // BR
+		// Get the most updated address to branch to
+		regRead := ifidReg.Instr & 0x3FF >> 5
+		for idu.cpu.GetRegisterLocks().Contains(regRead) {
+			continue
+		}
+		regData1 := idu.cpu.GetRegisters()[regRead]
+
+		out <- &IDEXReg{
+			Instr:         ifidReg.Instr,
+			IncrementedPC: ifidReg.IncrementedPC,
+			RegReadData1:  regData1,
+			RegReadData2:  0,
+			SignExtendImm: 0,
+		}
+
 	case 0x000: // HLT
 		out <- &IDEXReg{}
 
 	default: // Bad opcode
 		errMsg := fmt.Sprintf("Decoded an invalid instruction; PC: %s", util.ConvertToHexUint64(ifidReg.IncrementedPC-4))
+		if location := idu.cpu.GetSourceLocation(ifidReg.IncrementedPC - 4); location != "" {
+			errMsg += fmt.Sprintf("; Source: %s", location)
+		}
 		log.Fatal(errMsg)
 	}
 }
@@ -0,0 +1,311 @@
+package cpu
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
+	"github.com/joshuaseligman/GoVM/pkg/hardware/clock"
+	"github.com/joshuaseligman/GoVM/pkg/hardware/memory"
+)
+
+// Struct for an instruction and the operands the decode unit should pass to the execute unit
+type decodeCase struct {
+	name  string // The name of the case
+	src   string // The assembly of the instruction
+	read1 int    // The register that should be in RegReadData1, or -1 if it should be 0
+	read2 int    // The register that should be in RegReadData2, or -1 if it should be 0
+	lock  int    // The register that should be locked for writing, or -1 if none should be
+	imm   int64  // The value that should be in SignExtendImm
+	shift uint32 // The amount the immediate of a move should be shifted by
+	real  string // The instruction src is replaced with if it is a pseudo-instruction
+}
+
+// Gets the value a register holds during the tests, which is different for every register so a read of the wrong register is caught
+func regValue(reg int) uint64 {
+	if reg == 0x1F {
+		return 0
+	}
+	return 0x1000 + uint64(reg)
+}
+
+// Assembles a single instruction into its binary
+func assembleWord(t *testing.T, src string) uint32 {
+	t.Helper()
+	image, err := assembler.AssembleProgramAPI(src)
+	if err != nil {
+		t.Fatalf("%q did not assemble: %v", src, err)
+	}
+	if len(image) < 4 {
+		t.Fatalf("%q assembled into %d bytes", src, len(image))
+	}
+	return uint32(image[0])<<24 | uint32(image[1])<<16 | uint32(image[2])<<8 | uint32(image[3])
+}
+
+// Runs an instruction through the decode unit of a new CPU, getting what it passes on and the registers it locked
+func decodeWord(t *testing.T, instr uint32) (*IDEXReg, []int) {
+	t.Helper()
+	clk := clock.NewClock()
+	c := NewCpu(memory.NewEmptyMemory(0x100, clk), clk)
+	for reg := range c.reg {
+		c.reg[reg] = regValue(reg)
+	}
+
+	out := make(chan *IDEXReg, 1)
+	c.decodeUnit.DecodeInstruction(out, &IFIDReg{Instr: instr, IncrementedPC: 0x104})
+	idexReg := <-out
+
+	locks := make([]int, 0)
+	for reg := 0; reg < 32; reg++ {
+		if c.regLocks.Contains(uint32(reg)) {
+			locks = append(locks, reg)
+		}
+	}
+	return idexReg, locks
+}
+
+// Assembles and decodes an instruction, checking that every operand made it through both
+func checkDecode(t *testing.T, tc decodeCase) {
+	t.Helper()
+	instr := assembleWord(t, tc.src)
+	idexReg, locks := decodeWord(t, instr)
+
+	if idexReg.Instr != instr {
+		t.Errorf("%s: Instr = 0x%08X, want 0x%08X", tc.src, idexReg.Instr, instr)
+	}
+	if idexReg.IncrementedPC != 0x104 {
+		t.Errorf("%s: IncrementedPC = 0x%X, want 0x104", tc.src, idexReg.IncrementedPC)
+	}
+
+	for _, check := range []struct {
+		name string
+		reg  int
+		got  uint64
+	}{
+		{"RegReadData1", tc.read1, idexReg.RegReadData1},
+		{"RegReadData2", tc.read2, idexReg.RegReadData2},
+	} {
+		want := uint64(0)
+		if check.reg != -1 {
+			want = regValue(check.reg)
+		}
+		if check.got != want {
+			t.Errorf("%s: %s = 0x%X, want 0x%X", tc.src, check.name, check.got, want)
+		}
+	}
+
+	if idexReg.SignExtendImm != uint64(tc.imm) {
+		t.Errorf("%s: SignExtendImm = 0x%X, want 0x%X", tc.src, idexReg.SignExtendImm, uint64(tc.imm))
+	}
+	if shift := instr >> 21 & 0x3 * 16; disassembler.Decode(instr).Format == disassembler.FormatIM && shift != tc.shift {
+		t.Errorf("%s: shift = %d, want %d", tc.src, shift, tc.shift)
+	}
+
+	wantLocks := []int{}
+	if tc.lock != -1 {
+		wantLocks = []int{tc.lock}
+	}
+	if fmt.Sprint(locks) != fmt.Sprint(wantLocks) {
+		t.Errorf("%s: locked registers = %v, want %v", tc.src, locks, wantLocks)
+	}
+	if idexReg.addedLock != (tc.lock != -1) {
+		t.Errorf("%s: addedLock = %t, want %t", tc.src, idexReg.addedLock, tc.lock != -1)
+	}
+
+	// The disassembler has to know the instruction, since data always gives back the same binary
+	wantMnemonic := strings.ToUpper(strings.Fields(tc.src)[0])
+	if tc.real != "" {
+		wantMnemonic = tc.real
+	}
+	if mnemonic := disassembler.Decode(instr).Mnemonic; mnemonic != wantMnemonic {
+		t.Errorf("%s: disassembled as %s, want %s", tc.src, mnemonic, wantMnemonic)
+	}
+
+	// The disassembly has to give back the same binary
+	if text := disassembler.Disassemble(instr); assembleWord(t, text) != instr {
+		t.Errorf("%s: disassembled into %q, which does not assemble into 0x%08X", tc.src, text, instr)
+	}
+}
+
+func TestDecodeInstruction(t *testing.T) {
+	tests := []decodeCase{
+		{name: "ADD", src: "ADD X1, X2, X3", read1: 2, read2: 3, lock: 1},
+		{name: "ADDS zero register", src: "ADDS XZR, XZR, X30", read1: 31, read2: 30, lock: 31},
+		{name: "SUB aliases", src: "SUB SP, FP, LR", read1: 29, read2: 30, lock: 28},
+		{name: "SUBS same register", src: "SUBS X7, X7, X7", read1: 7, read2: 7, lock: 7},
+		{name: "MUL", src: "MUL X1, X2, X3", read1: 2, read2: 3, lock: 1},
+		{name: "SMULH", src: "SMULH X4, XZR, LR", read1: 31, read2: 30, lock: 4},
+		{name: "UMULH", src: "UMULH X5, X5, X6", read1: 5, read2: 6, lock: 5},
+		{name: "SDIV", src: "SDIV X7, X8, X9", read1: 8, read2: 9, lock: 7},
+		{name: "UDIV zero register", src: "UDIV XZR, X10, XZR", read1: 10, read2: 31, lock: 31},
+		{name: "ADDI max", src: "ADDI X1, X2, #4095", read1: 2, read2: -1, lock: 1, imm: 4095},
+		{name: "ADDIS zero", src: "ADDIS X0, X0, #0", read1: 0, read2: -1, lock: 0},
+		{name: "SUBI alias", src: "SUBI IP0, IP1, #0x800", read1: 17, read2: -1, lock: 16, imm: 0x800},
+		{name: "SUBIS", src: "SUBIS X30, XZR, #1", read1: 31, read2: -1, lock: 30, imm: 1},
+		{name: "AND", src: "AND X4, X5, X6", read1: 5, read2: 6, lock: 4},
+		{name: "ANDS", src: "ANDS XZR, X1, X2", read1: 1, read2: 2, lock: 31},
+		{name: "ORR", src: "ORR X30, SP, X0", read1: 28, read2: 0, lock: 30},
+		{name: "EOR", src: "EOR X9, X9, XZR", read1: 9, read2: 31, lock: 9},
+		{name: "ANDI", src: "ANDI X1, X2, #0xFFF", read1: 2, read2: -1, lock: 1, imm: 0xFFF},
+		{name: "ANDIS", src: "ANDIS XZR, X3, #1", read1: 3, read2: -1, lock: 31, imm: 1},
+		{name: "ORRI", src: "ORRI X5, XZR, #0x800", read1: 31, read2: -1, lock: 5, imm: 0x800},
+		{name: "EORI", src: "EORI LR, LR, #0", read1: 30, read2: -1, lock: 30},
+		{name: "TST", src: "TST X7", read1: 7, read2: 7, lock: 31, real: "ANDS"},
+		{name: "TST immediate", src: "TST X7, #4", read1: 7, read2: -1, lock: 31, imm: 4, real: "ANDIS"},
+		{name: "LSL", src: "LSL X1, X2, #4", read1: 2, read2: -1, lock: 1, imm: 4},
+		{name: "LSL max", src: "LSL XZR, LR, #63", read1: 30, read2: -1, lock: 31, imm: 63},
+		{name: "LSR", src: "LSR X3, X3, #0", read1: 3, read2: -1, lock: 3},
+		{name: "LDUR max", src: "LDUR X1, X2, #255", read1: 2, read2: -1, lock: 1, imm: 255},
+		{name: "LDURB min", src: "LDURB W3, X4, #-256", read1: 4, read2: -1, lock: 3, imm: -256},
+		{name: "LDURH", src: "LDURH W30, SP, #-1", read1: 28, read2: -1, lock: 30, imm: -1},
+		{name: "LDURSW", src: "LDURSW X5, X6, #8", read1: 6, read2: -1, lock: 5, imm: 8},
+		{name: "STUR", src: "STUR X1, X2, #-8", read1: 2, read2: 1, lock: -1, imm: -8},
+		{name: "STURB", src: "STURB W3, X4, #255", read1: 4, read2: 3, lock: -1, imm: 255},
+		{name: "STURH zero register", src: "STURH WZR, X9, #2", read1: 9, read2: 31, lock: -1, imm: 2},
+		{name: "STURW", src: "STURW W10, FP, #-256", read1: 29, read2: 10, lock: -1, imm: -256},
+		{name: "MOVZ", src: "MOVZ X1, #0xFFFF, LSL 0", read1: -1, read2: -1, lock: 1, imm: 0xFFFF},
+		{name: "MOVZ shifted", src: "MOVZ X2, #0x1234, LSL 48", read1: -1, read2: -1, lock: 2, imm: 0x1234, shift: 48},
+		{name: "MOVK", src: "MOVK LR, #0x8000, LSL 16", read1: 30, read2: -1, lock: 30, imm: 0x8000, shift: 16},
+		{name: "B max", src: "B #0x1FFFFFF", read1: -1, read2: -1, lock: -1, imm: 1<<25 - 1},
+		{name: "B min", src: "B #-0x2000000", read1: -1, read2: -1, lock: -1, imm: -1 << 25},
+		{name: "BL max", src: "BL #0x1FFFFFF", read1: -1, read2: -1, lock: 30, imm: 1<<25 - 1},
+		{name: "BL min", src: "BL #-0x2000000", read1: -1, read2: -1, lock: 30, imm: -1 << 25},
+		{name: "BR", src: "BR X9", read1: 9, read2: -1, lock: -1},
+		{name: "BR zero register", src: "BR XZR", read1: 31, read2: -1, lock: -1},
+		{name: "RET", src: "RET", read1: 30, read2: -1, lock: -1, real: "BR"},
+		{name: "RET register", src: "RET IP0", read1: 16, read2: -1, lock: -1, real: "BR"},
+		{name: "CBZ max", src: "CBZ X3, #0x3FFFF", read1: 3, read2: -1, lock: -1, imm: 1<<18 - 1},
+		{name: "B.EQ", src: "B.EQ #3", read1: -1, read2: -1, lock: -1, imm: 3},
+		{name: "B.LE min", src: "B.LE #-0x40000", read1: -1, read2: -1, lock: -1, imm: -1 << 18},
+		{name: "B.HS lower case", src: "b.hs #0x3FFFF", read1: -1, read2: -1, lock: -1, imm: 1<<18 - 1},
+		{name: "CBNZ min", src: "CBNZ XZR, #-0x40000", read1: 31, read2: -1, lock: -1, imm: -1 << 18},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checkDecode(t, tc)
+		})
+	}
+}
+
+// The kinds of instructions makeCase can generate
+var caseKinds = []string{
+	"ADD", "ADDS", "SUB", "SUBS",
+	"MUL", "SMULH", "UMULH", "SDIV", "UDIV",
+	"ADDI", "ADDIS", "SUBI", "SUBIS",
+	"AND", "ANDS", "ORR", "EOR",
+	"ANDI", "ANDIS", "ORRI", "EORI",
+	"LSL", "LSR",
+	"LDUR", "LDURB", "LDURH", "LDURSW",
+	"STUR", "STURB", "STURH", "STURW",
+	"MOVZ", "MOVK", "B", "BL", "BR", "RET", "CBZ", "CBNZ",
+	"B.EQ", "B.NE", "B.HS", "B.LO", "B.MI", "B.PL", "B.VS", "B.VC",
+	"B.HI", "B.LS", "B.GE", "B.LT", "B.GT", "B.LE",
+}
+
+// Builds a valid instruction out of any values, bringing each one into the range its field allows
+func makeCase(kind uint8, a uint8, b uint8, c uint8, imm int64) decodeCase {
+	mnemonic := caseKinds[int(kind)%len(caseKinds)]
+	rd, rn, rm := int(a%32), int(b%32), int(c%32)
+	x := func(reg int) string {
+		return disassembler.RegisterName(uint32(reg))
+	}
+	w := func(reg int) string {
+		if reg == 0x1F {
+			return "WZR"
+		}
+		return fmt.Sprintf("W%d", reg)
+	}
+	// Brings the immediate into a signed field with the given number of bits
+	signed := func(bits uint) int64 {
+		return imm << (64 - bits) >> (64 - bits)
+	}
+	tc := decodeCase{name: mnemonic, read1: -1, read2: -1, lock: -1}
+
+	switch mnemonic {
+	case "ADD", "ADDS", "SUB", "SUBS", "MUL", "SMULH", "UMULH", "SDIV", "UDIV", "AND", "ANDS", "ORR", "EOR":
+		tc.src = fmt.Sprintf("%s %s, %s, %s", mnemonic, x(rd), x(rm), x(rn))
+		tc.read1, tc.read2, tc.lock = rm, rn, rd
+
+	case "ADDI", "ADDIS", "SUBI", "SUBIS", "ANDI", "ANDIS", "ORRI", "EORI":
+		tc.imm = imm & 0xFFF
+		tc.src = fmt.Sprintf("%s %s, %s, #%d", mnemonic, x(rd), x(rn), tc.imm)
+		tc.read1, tc.lock = rn, rd
+
+	case "LSL", "LSR":
+		tc.imm = imm & 0x3F
+		tc.src = fmt.Sprintf("%s %s, %s, #%d", mnemonic, x(rd), x(rn), tc.imm)
+		tc.read1, tc.lock = rn, rd
+
+	case "LDUR", "LDURB", "LDURH", "LDURSW", "STUR", "STURB", "STURH", "STURW":
+		tc.imm = signed(9)
+		rt := x(rd)
+		if mnemonic == "LDURB" || mnemonic == "LDURH" || mnemonic[:4] == "STUR" && len(mnemonic) == 5 {
+			rt = w(rd)
+		}
+		tc.src = fmt.Sprintf("%s %s, %s, #%d", mnemonic, rt, x(rn), tc.imm)
+		tc.read1 = rn
+		if mnemonic[0] == 'S' {
+			tc.read2 = rd
+		} else {
+			tc.lock = rd
+		}
+
+	case "MOVZ", "MOVK":
+		tc.imm = imm & 0xFFFF
+		tc.shift = uint32(c%4) * 16
+		tc.src = fmt.Sprintf("%s %s, #%d, LSL %d", mnemonic, x(rd), tc.imm, tc.shift)
+		tc.lock = rd
+		if mnemonic == "MOVK" {
+			tc.read1 = rd
+		}
+
+	case "B", "BL":
+		tc.imm = signed(26)
+		tc.src = fmt.Sprintf("%s #%d", mnemonic, tc.imm)
+		if mnemonic == "BL" {
+			tc.lock = 30
+		}
+
+	case "BR", "RET":
+		tc.src = fmt.Sprintf("%s %s", mnemonic, x(rn))
+		tc.read1 = rn
+		if mnemonic == "RET" {
+			tc.real = "BR"
+		}
+
+	case "CBZ", "CBNZ":
+		tc.imm = signed(19)
+		tc.src = fmt.Sprintf("%s %s, #%d", mnemonic, x(rd), tc.imm)
+		tc.read1 = rd
+
+	default: // B.cond
+		tc.imm = signed(19)
+		tc.src = fmt.Sprintf("%s #%d", mnemonic, tc.imm)
+	}
+	return tc
+}
+
+func TestDecodeInstructionRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		tc := makeCase(uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), rng.Int63()-rng.Int63())
+		checkDecode(t, tc)
+		if t.Failed() {
+			t.Fatalf("Failed on %s", tc.src)
+		}
+	}
+}
+
+func FuzzDecodeInstruction(f *testing.F) {
+	for kind := range caseKinds {
+		f.Add(uint8(kind), uint8(1), uint8(2), uint8(3), int64(-1))
+		f.Add(uint8(kind), uint8(31), uint8(30), uint8(29), int64(0))
+	}
+	f.Fuzz(func(t *testing.T, kind uint8, a uint8, b uint8, c uint8, imm int64) {
+		checkDecode(t, makeCase(kind, a, b, c, imm))
+	})
+}
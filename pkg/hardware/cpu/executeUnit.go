@@ -10,11 +10,12 @@ import (
 
 // Struct for the execute unit
 type ExecuteUnit struct {
-	hw       *hardware.Hardware // The hardware component
-	cpu      *Cpu               // The CPU
-	alu      *Alu               // The ALU
-	flushing bool               // Variable to determine if the next instruction can be taken in
-	clk      *clock.Clock       // The clock being used
+	hw         *hardware.Hardware // The hardware component
+	cpu        *Cpu               // The CPU
+	alu        *Alu               // The ALU
+	flushing   bool               // Variable to determine if the next instruction can be taken in
+	clk        *clock.Clock       // The clock being used
+	cyclesLeft int                // The number of extra clock cycles a multiply or divide holds the execute unit for
 }
 
 // Function that creates the execute unit
@@ -75,6 +76,8 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 		// Clear flags if ADD
 		if opcode == 0x458 {
 			exu.alu.ClearFlags()
+		} else {
+			exu.setFlags()
 		}
 
 		exu.Log(fmt.Sprintf("Sum: %s", util.ConvertToHexUint64(output)))
@@ -92,6 +95,8 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 		// Clear flags if ADDI
 		if opcode == 0x488 || opcode == 0x489 {
 			exu.alu.ClearFlags()
+		} else {
+			exu.setFlags()
 		}
 
 		exu.Log(fmt.Sprintf("Sum: %s", util.ConvertToHexUint64(output)))
@@ -103,11 +108,13 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 		}
 
 	case 0x658, 0x758: // SUB, SUBS
-		output := exu.alu.Add(idexReg.RegReadData1, exu.alu.Negate(idexReg.RegReadData2))
+		output := exu.alu.Subtract(idexReg.RegReadData1, idexReg.RegReadData2)
 
 		// Clear the flags if it is SUB
 		if opcode == 0x658 {
 			exu.alu.ClearFlags()
+		} else {
+			exu.setFlags()
 		}
 
 		fmt.Println(exu.alu)
@@ -122,11 +129,13 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 
 	case 0x688, 0x689, // SUBI
 		0x788, 0x789: // SUBIS
-		output := exu.alu.Add(idexReg.RegReadData1, exu.alu.Negate(idexReg.SignExtendImm))
+		output := exu.alu.Subtract(idexReg.RegReadData1, idexReg.SignExtendImm)
 
 		// Clear flags if SUBI
-		if opcode == 688 || opcode == 689 {
+		if opcode == 0x688 || opcode == 0x689 {
 			exu.alu.ClearFlags()
+		} else {
+			exu.setFlags()
 		}
 
 		exu.Log(fmt.Sprintf("Difference: %s", util.ConvertToHexUint64(output)))
@@ -137,6 +146,135 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 			WriteVal:      output,
 		}
 
+	case 0x450, 0x750: // AND, ANDS
+		output := exu.alu.And(idexReg.RegReadData1, idexReg.RegReadData2)
+
+		// Clear flags if AND
+		if opcode == 0x450 {
+			exu.alu.ClearFlags()
+		} else {
+			exu.setFlags()
+		}
+
+		exu.Log(fmt.Sprintf("AND: %s", util.ConvertToHexUint64(output)))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
+	case 0x490, 0x491, // ANDI
+		0x790, 0x791: // ANDIS
+		output := exu.alu.And(idexReg.RegReadData1, idexReg.SignExtendImm)
+
+		// Clear flags if ANDI
+		if opcode == 0x490 || opcode == 0x491 {
+			exu.alu.ClearFlags()
+		} else {
+			exu.setFlags()
+		}
+
+		exu.Log(fmt.Sprintf("AND: %s", util.ConvertToHexUint64(output)))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
+	case 0x550, // ORR
+		0x590, 0x591: // ORRI
+		// ORRI uses the immediate in place of the second register
+		operand := idexReg.RegReadData2
+		if opcode != 0x550 {
+			operand = idexReg.SignExtendImm
+		}
+		output := exu.alu.Or(idexReg.RegReadData1, operand)
+		exu.alu.ClearFlags()
+
+		exu.Log(fmt.Sprintf("OR: %s", util.ConvertToHexUint64(output)))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
+	case 0x650, // EOR
+		0x690, 0x691: // EORI
+		// EORI uses the immediate in place of the second register
+		operand := idexReg.RegReadData2
+		if opcode != 0x650 {
+			operand = idexReg.SignExtendImm
+		}
+		output := exu.alu.Xor(idexReg.RegReadData1, operand)
+		exu.alu.ClearFlags()
+
+		exu.Log(fmt.Sprintf("XOR: %s", util.ConvertToHexUint64(output)))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
+	case 0x69B, 0x69A: // LSL, LSR
+		// The shifter does not change the flags
+		var output uint64
+		if opcode == 0x69B {
+			output = exu.alu.ShiftLeft(idexReg.RegReadData1, idexReg.SignExtendImm)
+		} else {
+			output = exu.alu.ShiftRight(idexReg.RegReadData1, idexReg.SignExtendImm)
+		}
+
+		exu.Log(fmt.Sprintf("Shifted: %s", util.ConvertToHexUint64(output)))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
+	case 0x4D8, 0x4DA, 0x4DE: // MUL, SMULH, UMULH
+		// The multiplier works on 1 bit of Rn each cycle and does not change the flags
+		var output uint64
+		switch opcode {
+		case 0x4D8:
+			output = exu.alu.Multiply(idexReg.RegReadData1, idexReg.RegReadData2)[1]
+		case 0x4DA:
+			output = exu.alu.MultiplySigned(idexReg.RegReadData1, idexReg.RegReadData2)[0]
+		case 0x4DE:
+			output = exu.alu.Multiply(idexReg.RegReadData1, idexReg.RegReadData2)[0]
+		}
+		exu.cyclesLeft = exu.alu.cycles - 1
+
+		exu.Log(fmt.Sprintf("Product: %s in %d cycles", util.ConvertToHexUint64(output), exu.alu.cycles))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
+	case 0x4D6: // SDIV, UDIV
+		// The divider works on 1 bit of the quotient each cycle and does not change the flags
+		var output uint64
+		if idexReg.Instr>>10&0x3F == 0b000011 {
+			output = exu.alu.DivideSigned(idexReg.RegReadData1, idexReg.RegReadData2)[0]
+		} else {
+			output = exu.alu.Divide(idexReg.RegReadData1, idexReg.RegReadData2)[0]
+		}
+		exu.cyclesLeft = exu.alu.cycles - 1
+
+		exu.Log(fmt.Sprintf("Quotient: %s in %d cycles", util.ConvertToHexUint64(output), exu.alu.cycles))
+
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      output,
+		}
+
 	case 0x7C2, 0x1C2, // LDUR, LDURB
 		0x3C2, 0x5C4: // LDURH, LDURSW
 		// Get the address to load from
@@ -187,6 +325,57 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 		}
 	}
 
+	if opcode >= 0x4A0 && opcode <= 0x4BF { // BL
+		// Get the new program counter
+		offset := idexReg.SignExtendImm << 2
+		newPC := exu.alu.Add(idexReg.IncrementedPC, offset)
+		exu.alu.ClearFlags()
+		exu.Log(util.ConvertToHexUint64(newPC))
+		// Flush the pipeline
+		exu.flushing = true
+		go exu.cpu.FlushPipeline(newPC)
+
+		// The instruction after the BL is where the subroutine returns to
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+			WriteVal:      idexReg.IncrementedPC,
+		}
+	}
+
+	if opcode == 0x6B0 { // BR
+		// The register holds the address to go to
+		newPC := idexReg.RegReadData1
+		exu.Log(util.ConvertToHexUint64(newPC))
+		// Flush the pipeline
+		exu.flushing = true
+		go exu.cpu.FlushPipeline(newPC)
+
+		// Continue execution of the branch instruction
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+		}
+	}
+
+	if opcode >= 0x2A0 && opcode <= 0x2A7 { // B.cond
+		// The condition is in place of Rt and tests the flags saved by the last instruction that set them
+		cond := idexReg.Instr & 0x1F
+		exu.Log(fmt.Sprintf("Flags: %s", exu.cpu.GetNzcv()))
+		if exu.cpu.GetNzcv().ConditionHolds(cond) {
+			offset := idexReg.SignExtendImm << 2
+			newPC := exu.alu.Add(idexReg.IncrementedPC, offset)
+			exu.alu.ClearFlags()
+			exu.flushing = true
+			go exu.cpu.FlushPipeline(newPC)
+		}
+		// Continue execution of the branch instruction
+		out <- &EXMEMReg{
+			Instr:         idexReg.Instr,
+			IncrementedPC: idexReg.IncrementedPC,
+		}
+	}
+
 	if opcode >= 0x5A0 && opcode <= 0x5A7 || // CBZ
 		opcode >= 0x5A8 && opcode <= 0x5AF { // CBNZ
 		exu.alu.ClearFlags()
@@ -208,6 +397,11 @@ func (exu *ExecuteUnit) ExecuteInstruction(out chan *EXMEMReg, idexReg *IDEXReg,
 	}
 }
 
+// Saves the flags of the last operation of the ALU in the NZCV register of the CPU
+func (exu *ExecuteUnit) setFlags() {
+	exu.cpu.nzcv = nzcvFromAlu(exu.alu)
+}
+
 // Logs a message
 func (exu *ExecuteUnit) Log(msg string) {
 	exu.hw.Log(msg)
@@ -229,4 +423,5 @@ func movkBitAndAmountUtil(actShiftAmt uint64) uint64 {
 func (exu *ExecuteUnit) Reset() {
 	exu.alu.Reset()
 	exu.flushing = false
+	exu.cyclesLeft = 0
 }
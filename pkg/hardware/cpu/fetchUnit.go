@@ -1,6 +1,9 @@
 package cpu
 
 import (
+	"fmt"
+
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
 	"github.com/joshuaseligman/GoVM/pkg/hardware"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/memory"
 	"github.com/joshuaseligman/GoVM/pkg/util"
@@ -25,11 +28,12 @@ func NewFetchUnit(mem *memory.Memory) *FetchUnit {
 func (ifu *FetchUnit) FetchInstruction(out chan *IFIDReg, addr *uint64) {
 	ifu.mmu.SetMar(*addr)
 	ifu.mmu.CallRead()
-	ifu.Log(util.ConvertToHexUint32(uint32(ifu.mmu.GetMdr() >> 32)))
+	instr := uint32(ifu.mmu.GetMdr() >> 32)
+	ifu.Log(fmt.Sprintf("%s %s", util.ConvertToHexUint32(instr), disassembler.Disassemble(instr)))
 	*addr += 4
 
 	out <- &IFIDReg{
-		Instr:         uint32(ifu.mmu.GetMdr() >> 32),
+		Instr:         instr,
 		IncrementedPC: *addr,
 	}
 }
@@ -0,0 +1,65 @@
+package cpu
+
+// Struct for the condition flags, which only change when an instruction that sets the flags finishes executing
+type Nzcv struct {
+	N bool `json:"n"` // If the result was negative
+	Z bool `json:"z"` // If the result was 0
+	C bool `json:"c"` // If the result carried out of the top bit, or did not borrow for a subtraction
+	V bool `json:"v"` // If the result overflowed as a signed number
+}
+
+// Gets the flags from the last operation of the ALU
+func nzcvFromAlu(alu *Alu) Nzcv {
+	return Nzcv{
+		N: alu.negativeFlag,
+		Z: alu.zeroFlag,
+		C: alu.carryFlag,
+		V: alu.overflowFlag,
+	}
+}
+
+// Determines if the condition in the Rt field of a B.cond holds for the flags
+func (nzcv Nzcv) ConditionHolds(cond uint32) bool {
+	switch cond {
+	case 0x0: // EQ
+		return nzcv.Z
+	case 0x1: // NE
+		return !nzcv.Z
+	case 0x2: // HS
+		return nzcv.C
+	case 0x3: // LO
+		return !nzcv.C
+	case 0x4: // MI
+		return nzcv.N
+	case 0x5: // PL
+		return !nzcv.N
+	case 0x6: // VS
+		return nzcv.V
+	case 0x7: // VC
+		return !nzcv.V
+	case 0x8: // HI
+		return nzcv.C && !nzcv.Z
+	case 0x9: // LS
+		return !nzcv.C || nzcv.Z
+	case 0xA: // GE
+		return nzcv.N == nzcv.V
+	case 0xB: // LT
+		return nzcv.N != nzcv.V
+	case 0xC: // GT
+		return !nzcv.Z && nzcv.N == nzcv.V
+	case 0xD: // LE
+		return nzcv.Z || nzcv.N != nzcv.V
+	}
+	return false
+}
+
+// Gets the flags as text, with an upper case letter for each flag that is set
+func (nzcv Nzcv) String() string {
+	flags := []byte("nzcv")
+	for i, set := range []bool{nzcv.N, nzcv.Z, nzcv.C, nzcv.V} {
+		if set {
+			flags[i] -= 'a' - 'A'
+		}
+	}
+	return string(flags)
+}
@@ -0,0 +1,76 @@
+package cpu
+
+import "testing"
+
+func TestConditionHolds(t *testing.T) {
+	// The flags after comparing each pair of numbers, as SUBS XZR, a, b would set them
+	flags := map[string]Nzcv{
+		"1 cmp 1":    {Z: true, C: true},
+		"2 cmp 1":    {C: true},
+		"1 cmp 2":    {N: true},
+		"-1 cmp 1":   {N: true, C: true},
+		"1 cmp -1":   {},
+		"min cmp 1":  {C: true, V: true},
+		"max cmp -1": {N: true, V: true},
+	}
+
+	tests := []struct {
+		cond  uint32
+		name  string
+		holds []string
+	}{
+		{0x0, "EQ", []string{"1 cmp 1"}},
+		{0x1, "NE", []string{"2 cmp 1", "1 cmp 2", "-1 cmp 1", "1 cmp -1", "min cmp 1", "max cmp -1"}},
+		{0x2, "HS", []string{"1 cmp 1", "2 cmp 1", "-1 cmp 1", "min cmp 1"}},
+		{0x3, "LO", []string{"1 cmp 2", "1 cmp -1", "max cmp -1"}},
+		{0x4, "MI", []string{"1 cmp 2", "-1 cmp 1", "max cmp -1"}},
+		{0x5, "PL", []string{"1 cmp 1", "2 cmp 1", "1 cmp -1", "min cmp 1"}},
+		{0x6, "VS", []string{"min cmp 1", "max cmp -1"}},
+		{0x7, "VC", []string{"1 cmp 1", "2 cmp 1", "1 cmp 2", "-1 cmp 1", "1 cmp -1"}},
+		{0x8, "HI", []string{"2 cmp 1", "-1 cmp 1", "min cmp 1"}},
+		{0x9, "LS", []string{"1 cmp 1", "1 cmp 2", "1 cmp -1", "max cmp -1"}},
+		{0xA, "GE", []string{"1 cmp 1", "2 cmp 1", "1 cmp -1", "max cmp -1"}},
+		{0xB, "LT", []string{"1 cmp 2", "-1 cmp 1", "min cmp 1"}},
+		{0xC, "GT", []string{"2 cmp 1", "1 cmp -1", "max cmp -1"}},
+		{0xD, "LE", []string{"1 cmp 1", "1 cmp 2", "-1 cmp 1", "min cmp 1"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			holds := make(map[string]bool)
+			for _, name := range tc.holds {
+				holds[name] = true
+			}
+			for name, nzcv := range flags {
+				if got := nzcv.ConditionHolds(tc.cond); got != holds[name] {
+					t.Errorf("%s with %s (%s) = %t, want %t", tc.name, name, nzcv, got, holds[name])
+				}
+			}
+		})
+	}
+}
+
+func TestConditionHoldsAfterSubtract(t *testing.T) {
+	// Each condition has to agree with comparing the numbers in Go
+	nums := []uint64{0, 1, 2, 0x7FFFFFFFFFFFFFFF, 0x8000000000000000, 0xFFFFFFFFFFFFFFFF}
+	for _, a := range nums {
+		for _, b := range nums {
+			alu := NewAlu()
+			alu.Subtract(a, b)
+			nzcv := nzcvFromAlu(alu)
+
+			want := []bool{
+				a == b, a != b, a >= b, a < b,
+				int64(a-b) < 0, int64(a-b) >= 0,
+				(int64(a) < int64(b)) != (int64(a-b) < 0), (int64(a) < int64(b)) == (int64(a-b) < 0),
+				a > b, a <= b,
+				int64(a) >= int64(b), int64(a) < int64(b), int64(a) > int64(b), int64(a) <= int64(b),
+			}
+			for cond, holds := range want {
+				if nzcv.ConditionHolds(uint32(cond)) != holds {
+					t.Errorf("Condition 0x%X after 0x%X - 0x%X (%s) = %t, want %t", cond, a, b, nzcv, !holds, holds)
+				}
+			}
+		}
+	}
+}
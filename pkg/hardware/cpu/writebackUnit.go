@@ -26,6 +26,8 @@ func (wbu *WritebackUnit) HandleWriteback(out chan bool, memwbReg *MEMWBReg) {
 	opcode := memwbReg.Instr >> 21
 
 	if opcode >= 0x0A0 && opcode <= 0x0BF || // B
+		opcode == 0x6B0 || // BR
+		opcode >= 0x2A0 && opcode <= 0x2A7 || // B.cond
 		opcode >= 0x5A0 && opcode <= 0x5A7 || // CBZ
 		opcode >= 0x5A8 && opcode <= 0x5AF { // CBNZ
 		out <- true
@@ -37,7 +39,10 @@ func (wbu *WritebackUnit) HandleWriteback(out chan bool, memwbReg *MEMWBReg) {
 		break
 	default:
 		reg := wbu.cpu.GetRegisterLocks().Dequeue()
-		wbu.cpu.GetRegisters()[reg] = memwbReg.WriteVal
+		// Writes to XZR are thrown away so it always reads as 0
+		if reg != 0x1F {
+			wbu.cpu.GetRegisters()[reg] = memwbReg.WriteVal
+		}
 		wbu.Log(fmt.Sprintf("Unlocked %d", reg))
 		wbu.Log(wbu.cpu.GetRegisterLocks().ToString())
 	}
@@ -3,8 +3,10 @@ package memory
 import (
 	"fmt"
 
+	"github.com/joshuaseligman/GoVM/pkg/elf"
 	"github.com/joshuaseligman/GoVM/pkg/hardware"
 	"github.com/joshuaseligman/GoVM/pkg/hardware/clock"
+	"github.com/joshuaseligman/GoVM/pkg/sourcemap"
 	"github.com/joshuaseligman/GoVM/pkg/util"
 )
 
@@ -13,22 +15,18 @@ type Memory struct {
 	hw *hardware.Hardware // The hardware struct
 	ram []uint8 // The RAM
 	clk *clock.Clock // The clock for stopping the program to prevent runtime errors
+	entryPoint uint64 // The address of the first instruction of the loaded program
+	sourceMap sourcemap.SourceMap // The lines of the source that placed each part of the loaded program
 }
 
 // Creates a memory struct with a loaded program
-func NewFlashedMemory(program []uint32, clock *clock.Clock) *Memory {
+func NewFlashedMemory(program []uint8, clock *clock.Clock) *Memory {
 	mem := Memory {
 		hw: hardware.NewHardware("RAM", 0), 
-		ram: make([]uint8, len(program) * 4),
+		ram: make([]uint8, len(program)),
 		clk: clock,
 	}
-	for i := 0; i < len(program); i++ {
-		instr := program[i]
-		for j := 0; j < 4; j++ {
-			byteInstr := uint8(instr >> (8 * (3 - j)) & 0xFF)
-			mem.ram[i * 4 + j] = byteInstr
-		}
-	}
+	copy(mem.ram, program)
 	return &mem
 }
 
@@ -42,15 +40,57 @@ func NewEmptyMemory(size int, clock *clock.Clock) *Memory {
 	return &mem
 }
 
+// Creates a memory struct of the given size with an ELF executable loaded into it
+func NewELFMemory(exe *elf.File, size int, clock *clock.Clock) (*Memory, error) {
+	mem := NewEmptyMemory(size, clock)
+	if err := mem.LoadELF(exe); err != nil {
+		return nil, err
+	}
+	return mem, nil
+}
+
 // Flashes a program to the beginning of the memory array
-func (mem *Memory) FlashProgram(program []uint32) {
-	for i := 0; i < len(program); i++ {
-		instr := program[i]
-		for j := 0; j < 4; j++ {
-			byteInstr := uint8(instr >> (8 * (3 - j)) & 0xFF)
-			mem.ram[i * 4 + j] = byteInstr
+func (mem *Memory) FlashProgram(program []uint8) {
+	copy(mem.ram, program)
+	mem.entryPoint = 0
+	mem.sourceMap = nil
+}
+
+// Loads each segment of an ELF executable at its address and uses its entry point
+func (mem *Memory) LoadELF(exe *elf.File) error {
+	// Make sure everything fits before changing the memory
+	size := uint64(len(mem.ram))
+	for _, seg := range exe.Segments {
+		// Written so a segment near the end of the address space cannot wrap around
+		if seg.Addr > size || uint64(len(seg.Data)) > size - seg.Addr {
+			return fmt.Errorf("Program does not fit in memory: Segment %s ends at 0x%X but the memory only has 0x%X bytes", seg.Name, seg.Addr + uint64(len(seg.Data)), len(mem.ram))
 		}
 	}
+	if exe.Entry >= size {
+		return fmt.Errorf("Program does not fit in memory: The entry point 0x%X is past the end of the memory", exe.Entry)
+	}
+
+	for _, seg := range exe.Segments {
+		copy(mem.ram[seg.Addr:], seg.Data)
+	}
+	mem.entryPoint = exe.Entry
+	mem.sourceMap = exe.SourceMap
+	return nil
+}
+
+// Sets the source map of the loaded program so addresses can be traced back to the source
+func (mem *Memory) SetSourceMap(sourceMap sourcemap.SourceMap) {
+	mem.sourceMap = sourceMap
+}
+
+// Gets the source map of the loaded program, which is empty if the source is not known
+func (mem *Memory) GetSourceMap() sourcemap.SourceMap {
+	return mem.sourceMap
+}
+
+// Gets the address the CPU starts running the program at
+func (mem *Memory) GetEntryPoint() uint64 {
+	return mem.entryPoint
 }
 
 // Resets the memory to 0x0 for all memory locations
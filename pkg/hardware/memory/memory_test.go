@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/joshuaseligman/GoVM/pkg/elf"
+	"github.com/joshuaseligman/GoVM/pkg/hardware/clock"
+)
+
+func TestLoadELF(t *testing.T) {
+	tests := []struct {
+		name string
+		exe  *elf.File
+		ok   bool
+	}{
+		{"Fits", &elf.File{Entry: 0x4, Segments: []elf.Segment{{Name: ".text", Addr: 0x0, Data: make([]uint8, 0x10)}, {Name: ".data", Addr: 0xF0, Data: make([]uint8, 0x10)}}}, true},
+		{"Ends past the memory", &elf.File{Segments: []elf.Segment{{Name: ".data", Addr: 0xF8, Data: make([]uint8, 0x10)}}}, false},
+		{"Starts past the memory", &elf.File{Segments: []elf.Segment{{Name: ".data", Addr: 0x1000}}}, false},
+		{"Wraps around", &elf.File{Segments: []elf.Segment{{Name: ".data", Addr: ^uint64(0) - 3, Data: make([]uint8, 0x10)}}}, false},
+		{"Entry point past the memory", &elf.File{Entry: 0x100}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mem := NewEmptyMemory(0x100, clock.NewClock())
+			err := mem.LoadELF(tc.exe)
+			if tc.ok && err != nil {
+				t.Errorf("LoadELF failed: %v", err)
+			} else if !tc.ok && err == nil {
+				t.Errorf("LoadELF succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestNewELFMemoryCrafted(t *testing.T) {
+	// A segment at the very end of the address space has to be rejected before it gets to the memory
+	exe := &elf.File{Segments: []elf.Segment{{Name: ".text", Addr: ^uint64(0) - 3, Data: []uint8{0, 0, 0, 0}, Executable: true}}}
+	read, err := elf.Read(bytes.NewReader(exe.Bytes()))
+	if err == nil {
+		t.Errorf("Read accepted a segment at 0x%X", exe.Segments[0].Addr)
+		if _, err := NewELFMemory(read, 0x100, clock.NewClock()); err == nil {
+			t.Errorf("A segment at 0x%X was loaded", exe.Segments[0].Addr)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package linker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+)
+
+// Struct for a collection of objects that are only linked in when a program uses one of their symbols
+type Library struct {
+	Name    string              `json:"name"`    // The name of the library
+	Objects []*assembler.Object `json:"objects"` // The objects in the library
+}
+
+// Function that creates a new library from objects
+func NewLibrary(name string, objects ...*assembler.Object) *Library {
+	return &Library{Name: name, Objects: objects}
+}
+
+// Writes the library to a file that can be given to the linker
+func (lib *Library) WriteFile(filePath string) error {
+	data, err := json.MarshalIndent(lib, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// Reads a library that was written with WriteFile
+func ReadLibraryFile(filePath string) (*Library, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	lib := &Library{}
+	if err := json.Unmarshal(data, lib); err != nil {
+		return nil, err
+	}
+	for i, obj := range lib.Objects {
+		if obj == nil {
+			return nil, fmt.Errorf("Bad library %s: Object %d is empty", lib.Name, i)
+		}
+		if err := obj.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return lib, nil
+}
@@ -0,0 +1,371 @@
+package linker
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+	"github.com/joshuaseligman/GoVM/pkg/elf"
+	"github.com/joshuaseligman/GoVM/pkg/sourcemap"
+)
+
+// Options for linking a program
+type Options struct {
+	BaseAddr uint64 // The address the first section is placed at
+	MaxSize  int    // The size of the memory image in bytes, or 0 to make the image just big enough for the program
+	Entry    string // The global symbol the program starts at, or "" to start at the beginning of the first section
+}
+
+// Struct for the output of the linker
+type Result struct {
+	Image       []uint8               `json:"image"`       // The memory image of the program, or nil if there were errors
+	Entry       uint64                `json:"entry"`       // The address of the first instruction to run
+	Symbols     map[string]uint64     `json:"symbols"`     // The final values of the global symbols
+	SourceMap   sourcemap.SourceMap   `json:"sourceMap"`   // The lines that placed each part of the image
+	Map         *Map                  `json:"map"`         // Where every section and symbol was placed
+	Diagnostics assembler.Diagnostics `json:"diagnostics"` // The problems found while linking
+}
+
+// Struct for an object that is being linked
+type input struct {
+	obj     *assembler.Object                 // The object
+	bases   map[string]uint64                 // The address each section of the object was placed at
+	symbols map[string]assembler.ObjectSymbol // The symbol table of the object by name
+}
+
+// Function that creates a new input for an object
+func newInput(obj *assembler.Object) *input {
+	in := &input{obj: obj, bases: make(map[string]uint64), symbols: make(map[string]assembler.ObjectSymbol)}
+	for _, sym := range obj.Symbols {
+		in.symbols[sym.Name] = sym
+	}
+	return in
+}
+
+// Gets the final value of a symbol defined in the object
+func (in *input) value(sym assembler.ObjectSymbol) uint64 {
+	// Constants do not move with their section
+	if sym.Section == "" {
+		return sym.Value
+	}
+	return in.bases[sym.Section] + sym.Value
+}
+
+// Combines objects into a single memory image, bringing in the objects from the libraries that define symbols the program uses
+func Link(objects []*assembler.Object, libraries []*Library, opts Options) (*Result, error) {
+	res := &Result{Diagnostics: make(assembler.Diagnostics, 0)}
+	inputs := selectObjects(objects, libraries)
+
+	// Find the object that defines each global symbol
+	globals := make(map[string]*input)
+	for _, in := range inputs {
+		for _, sym := range in.obj.Symbols {
+			if !sym.Global || !sym.Defined {
+				continue
+			}
+			if other, exists := globals[sym.Name]; exists {
+				res.Diagnostics = append(res.Diagnostics, newError(assembler.CodeDuplicateSymbol, sym.File, sym.Line, "Duplicate symbol: %s is defined in both %s and %s", sym.Name, other.obj.Name, in.obj.Name))
+				continue
+			}
+			globals[sym.Name] = in
+		}
+	}
+
+	res.Map = &Map{Sections: make([]MapSection, 0), Symbols: make([]MapSymbol, 0)}
+	end := placeSections(inputs, opts.BaseAddr, res.Map)
+
+	maxSize := uint64(opts.MaxSize)
+	if opts.MaxSize <= 0 {
+		maxSize = end
+	}
+	if end > maxSize {
+		res.Diagnostics = append(res.Diagnostics, newError(assembler.CodeProgramSize, "", 0, "Program is too large: Program needs %d bytes but the limit is %d bytes", end, maxSize))
+		return res, res.Diagnostics.Errors()
+	}
+
+	// Copy each section into the image and fill in the values that depend on where things were placed
+	image := make([]uint8, maxSize)
+	res.Symbols = make(map[string]uint64)
+	res.SourceMap = make(sourcemap.SourceMap, 0)
+	for _, in := range inputs {
+		for _, sec := range in.obj.Sections {
+			base := in.bases[sec.Name]
+			copy(image[base:], sec.Data)
+			for _, entry := range sec.SourceMap {
+				entry.Addr += base
+				res.SourceMap = append(res.SourceMap, entry)
+			}
+		}
+
+		for _, reloc := range in.obj.Relocations {
+			if diag := applyRelocation(image, in, reloc, globals); diag != nil {
+				res.Diagnostics = append(res.Diagnostics, diag)
+			}
+		}
+
+		for _, sym := range in.obj.Symbols {
+			if !sym.Defined {
+				continue
+			}
+			val := in.value(sym)
+			if sym.Global {
+				res.Symbols[sym.Name] = val
+			}
+			res.Map.Symbols = append(res.Map.Symbols, MapSymbol{Name: sym.Name, Value: val, Section: sym.Section, Object: in.obj.Name, Global: sym.Global})
+		}
+	}
+
+	res.Entry = opts.BaseAddr
+	if len(res.Map.Sections) > 0 {
+		res.Entry = res.Map.Sections[0].Addr
+	}
+	if opts.Entry != "" {
+		if val, exists := res.Symbols[opts.Entry]; exists {
+			res.Entry = val
+		} else {
+			diag := newError(assembler.CodeUndefinedSymbol, "", 0, "Undefined entry point: %s is not a global symbol", opts.Entry)
+			diag.Suggestion = fmt.Sprintf("Define %s and make sure it uses .global %s", opts.Entry, opts.Entry)
+			res.Diagnostics = append(res.Diagnostics, diag)
+		}
+	}
+
+	sort.Slice(res.SourceMap, func(i, j int) bool {
+		return res.SourceMap[i].Addr < res.SourceMap[j].Addr
+	})
+	sort.SliceStable(res.Map.Symbols, func(i, j int) bool {
+		if res.Map.Symbols[i].Value != res.Map.Symbols[j].Value {
+			return res.Map.Symbols[i].Value < res.Map.Symbols[j].Value
+		}
+		return res.Map.Symbols[i].Name < res.Map.Symbols[j].Name
+	})
+
+	if res.Diagnostics.HasErrors() {
+		return res, res.Diagnostics.Errors()
+	}
+	res.Image = image
+	return res, nil
+}
+
+// Gets the linked program as an ELF executable with a loadable segment for each section
+func (res *Result) ELF() *elf.File {
+	file := &elf.File{Entry: res.Entry, Segments: make([]elf.Segment, 0), Symbols: make([]elf.Symbol, 0), SourceMap: res.SourceMap}
+	if res.Image == nil {
+		return file
+	}
+	for _, sec := range res.Map.Sections {
+		file.Segments = append(file.Segments, elf.Segment{
+			Name:       sec.Name,
+			Addr:       sec.Addr,
+			Data:       res.Image[sec.Addr : sec.Addr+sec.Size],
+			Executable: sec.Name == ".text",
+		})
+	}
+	for _, sym := range res.Map.Symbols {
+		file.Symbols = append(file.Symbols, elf.Symbol{Name: sym.Name, Value: sym.Value, Section: sym.Section, Global: sym.Global})
+	}
+	return file
+}
+
+// Gets the objects to link, which are all of the given objects and any library objects that define a symbol the others use
+func selectObjects(objects []*assembler.Object, libraries []*Library) []*input {
+	inputs := make([]*input, 0, len(objects))
+	for _, obj := range objects {
+		inputs = append(inputs, newInput(obj))
+	}
+
+	// Library objects can use symbols from other library objects, so keep going until nothing else is needed
+	used := make(map[*assembler.Object]bool)
+	for progress := true; progress; {
+		progress = false
+		needed := neededSymbols(inputs)
+		for _, lib := range libraries {
+			for _, obj := range lib.Objects {
+				if used[obj] || !definesAny(obj, needed) {
+					continue
+				}
+				used[obj] = true
+				inputs = append(inputs, newInput(obj))
+				needed = neededSymbols(inputs)
+				progress = true
+			}
+		}
+	}
+	return inputs
+}
+
+// Finds the symbols that are used by the inputs but not defined by any of them
+func neededSymbols(inputs []*input) map[string]bool {
+	defined := make(map[string]bool)
+	for _, in := range inputs {
+		for _, sym := range in.obj.Symbols {
+			if sym.Global && sym.Defined {
+				defined[sym.Name] = true
+			}
+		}
+	}
+	needed := make(map[string]bool)
+	for _, in := range inputs {
+		for _, sym := range in.obj.Symbols {
+			if !sym.Defined && !defined[sym.Name] {
+				needed[sym.Name] = true
+			}
+		}
+	}
+	return needed
+}
+
+// Determines if an object defines any of the needed symbols for other objects to use
+func definesAny(obj *assembler.Object, needed map[string]bool) bool {
+	for _, sym := range obj.Symbols {
+		if sym.Global && sym.Defined && needed[sym.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Gives every section of every input an address, grouping the sections with the same name, and returns the address right after the last one
+func placeSections(inputs []*input, baseAddr uint64, linkerMap *Map) uint64 {
+	// Sections are placed in the order their names first appear
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, in := range inputs {
+		for _, sec := range in.obj.Sections {
+			if !seen[sec.Name] {
+				seen[sec.Name] = true
+				names = append(names, sec.Name)
+			}
+		}
+	}
+
+	addr := baseAddr
+	for _, name := range names {
+		mapSec := MapSection{Name: name, Inputs: make([]MapInput, 0)}
+		for _, in := range inputs {
+			for _, sec := range in.obj.Sections {
+				if sec.Name != name {
+					continue
+				}
+				addr = alignUp(addr, sec.Align)
+				in.bases[name] = addr
+				if len(sec.Data) > 0 {
+					// The section starts where its first object is placed
+					if len(mapSec.Inputs) == 0 {
+						mapSec.Addr = addr
+					}
+					mapSec.Inputs = append(mapSec.Inputs, MapInput{Object: in.obj.Name, Addr: addr, Size: uint64(len(sec.Data))})
+				}
+				addr += uint64(len(sec.Data))
+			}
+		}
+
+		// Sections that are empty in every object are left out of the map
+		if len(mapSec.Inputs) > 0 {
+			mapSec.Size = addr - mapSec.Addr
+			linkerMap.Sections = append(linkerMap.Sections, mapSec)
+		}
+	}
+	return addr
+}
+
+// Rounds an address up to the next multiple of the alignment
+func alignUp(addr uint64, align uint64) uint64 {
+	if align <= 1 {
+		return addr
+	}
+	return (addr + align - 1) / align * align
+}
+
+// Fills in a value that depends on the address of a symbol
+func applyRelocation(image []uint8, in *input, reloc assembler.Relocation, globals map[string]*input) *assembler.Diagnostic {
+	// Symbols defined in the object are used before global symbols from other objects
+	var target uint64
+	if sym, exists := in.symbols[reloc.Symbol]; exists && sym.Defined {
+		target = in.value(sym)
+	} else if def, exists := globals[reloc.Symbol]; exists {
+		target = def.value(def.symbols[reloc.Symbol])
+	} else {
+		diag := newError(assembler.CodeUndefinedSymbol, reloc.File, reloc.Line, "Undefined symbol: %s is not defined in any object", reloc.Symbol)
+		diag.Suggestion = fmt.Sprintf("Link the object that defines %s and make sure it uses .global %s", reloc.Symbol, reloc.Symbol)
+		return diag
+	}
+
+	val := target + uint64(reloc.Addend)
+	addr := in.bases[reloc.Section] + reloc.Offset
+
+	switch reloc.Type {
+	case assembler.RelocBranch26, assembler.RelocBranch19:
+		if val%4 != 0 {
+			return newError(assembler.CodeRelocation, reloc.File, reloc.Line, "Bad branch address value: %s at address 0x%X is not word aligned", reloc.Symbol, val)
+		}
+		// The CPU adds the offset in words to the incremented program counter
+		offset := (int64(val) - int64(addr+4)) / 4
+		bits, shift := 26, 0
+		if reloc.Type == assembler.RelocBranch19 {
+			bits, shift = 19, 5
+		}
+		if offset < -(int64(1)<<(bits-1)) || offset >= int64(1)<<(bits-1) {
+			return newError(assembler.CodeRelocation, reloc.File, reloc.Line, "Bad branch address value: %s is %d instructions away but the offset must fit in %d bits", reloc.Symbol, offset, bits)
+		}
+		putField(image, addr, uint64(offset), bits, shift)
+
+	case assembler.RelocMovWide:
+		putField(image, addr, val>>reloc.Shift, 16, 5)
+
+	case assembler.RelocMov16:
+		if val > 0xFFFF {
+			diag := newError(assembler.CodeRelocation, reloc.File, reloc.Line, "Bad move immediate value: The address of %s is 0x%X, which does not fit in 16 bits", reloc.Symbol, val)
+			diag.Suggestion = "Load the address with MOVI"
+			return diag
+		}
+		putField(image, addr, val, 16, 5)
+
+	case assembler.RelocAbs32:
+		// Negative addends can make a value that is stored sign extended
+		if int64(val) > 0xFFFFFFFF || int64(val) < -(1<<31) {
+			diag := newError(assembler.CodeRelocation, reloc.File, reloc.Line, "Bad data value: The address of %s is 0x%X, which does not fit in 32 bits", reloc.Symbol, val)
+			diag.Suggestion = "Use .dword to store the address"
+			return diag
+		}
+		putValue(image, addr, val, 4)
+
+	case assembler.RelocAbs64:
+		putValue(image, addr, val, 8)
+	}
+	return nil
+}
+
+// Places a value in the field of the instruction at the address, keeping the other bits of the instruction
+func putField(image []uint8, addr uint64, val uint64, bits int, shift int) {
+	mask := uint64(1)<<bits - 1
+	instr := getValue(image, addr, 4)
+	instr = instr&^(mask<<shift) | (val&mask)<<shift
+	putValue(image, addr, instr, 4)
+}
+
+// Gets the big-endian value of size bytes at the address
+func getValue(image []uint8, addr uint64, size int) uint64 {
+	val := uint64(0)
+	for i := 0; i < size; i++ {
+		val = val<<8 | uint64(image[addr+uint64(i)])
+	}
+	return val
+}
+
+// Writes a value into the image in big-endian order
+func putValue(image []uint8, addr uint64, val uint64, size int) {
+	for i := 0; i < size; i++ {
+		image[addr+uint64(i)] = uint8(val >> (8 * (size - 1 - i)))
+	}
+}
+
+// Creates an error diagnostic at the given line
+func newError(code string, fileName string, lineNumber int, format string, args ...any) *assembler.Diagnostic {
+	return &assembler.Diagnostic{
+		File:     fileName,
+		Line:     lineNumber,
+		Severity: assembler.SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
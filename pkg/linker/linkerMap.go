@@ -0,0 +1,65 @@
+package linker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Struct for where the linker placed a section of an object
+type MapInput struct {
+	Object string `json:"object"` // The name of the object the section came from
+	Addr   uint64 `json:"addr"`   // The address the section was placed at
+	Size   uint64 `json:"size"`   // The number of bytes in the section
+}
+
+// Struct for a section of the linked program, made up of the sections with the same name from every object
+type MapSection struct {
+	Name   string     `json:"name"`   // The name of the section
+	Addr   uint64     `json:"addr"`   // The address of the start of the section
+	Size   uint64     `json:"size"`   // The number of bytes in the section, including padding between objects
+	Inputs []MapInput `json:"inputs"` // The sections of each object in the order they were placed
+}
+
+// Struct for the final value of a symbol
+type MapSymbol struct {
+	Name    string `json:"name"`    // The name of the symbol
+	Value   uint64 `json:"value"`   // The address of a label or the value of a constant
+	Section string `json:"section"` // The section a label is in, or "" for constants
+	Object  string `json:"object"`  // The object the symbol is defined in
+	Global  bool   `json:"global"`  // If the symbol can be used by other objects
+}
+
+// Struct for where everything in the linked program ended up
+type Map struct {
+	Sections []MapSection `json:"sections"` // The sections in order of address
+	Symbols  []MapSymbol  `json:"symbols"`  // The symbols in order of value
+}
+
+// Gets the text of the map with the sections, the objects in them, and the symbols
+func (linkerMap *Map) String() string {
+	var str strings.Builder
+
+	str.WriteString("Sections:\n")
+	for _, sec := range linkerMap.Sections {
+		str.WriteString(fmt.Sprintf("%-16s  %016X  %8X\n", sec.Name, sec.Addr, sec.Size))
+		for _, input := range sec.Inputs {
+			str.WriteString(fmt.Sprintf("  %-14s  %016X  %8X  %s\n", "", input.Addr, input.Size, input.Object))
+		}
+	}
+
+	str.WriteString("\nSymbols:\n")
+	for _, sym := range linkerMap.Symbols {
+		binding := "local"
+		if sym.Global {
+			binding = "global"
+		}
+		str.WriteString(fmt.Sprintf("%016X  %-6s  %-24s  %s\n", sym.Value, binding, sym.Name, sym.Object))
+	}
+	return str.String()
+}
+
+// Writes the text of the map to a file
+func (linkerMap *Map) WriteFile(filePath string) error {
+	return os.WriteFile(filePath, []byte(linkerMap.String()), 0644)
+}
@@ -0,0 +1,215 @@
+package linker
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+)
+
+// The program that uses the symbols of the other objects
+const mainSource = `.global main
+main:
+	B f
+	BL f
+	CBZ X1, f
+	B.NE f
+	MOVZ X3, #f, LSL 0
+	MOVI X2, #f
+	MOVZ X4, #here, LSL 0
+here:
+	HLT
+.data
+	.word f
+	.dword f
+`
+
+// An object with a global subroutine and a local label with the same name as one in mainSource
+const funcSource = `.global f
+f:
+	MOVZ X5, #here, LSL 0
+here:
+	RET
+`
+
+// Assembles a source into an object for the linker
+func assembleObject(t *testing.T, name string, src string) *assembler.Object {
+	t.Helper()
+	res, err := assembler.Assemble(strings.NewReader(src), assembler.Options{FileName: name, Relocatable: true})
+	if err != nil {
+		t.Fatalf("%s did not assemble: %v", name, err)
+	}
+	if err := res.Object.Validate(); err != nil {
+		t.Fatalf("%s assembled into a bad object: %v", name, err)
+	}
+	return res.Object
+}
+
+// Gets the big-endian word at the address of the image
+func wordAt(image []uint8, addr uint64) uint32 {
+	return uint32(getValue(image, addr, 4))
+}
+
+func TestLinkRelocations(t *testing.T) {
+	res, err := Link([]*assembler.Object{assembleObject(t, "main.s", mainSource), assembleObject(t, "f.s", funcSource)}, nil, Options{Entry: "main"})
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+
+	// f.s is placed right after the 11 instructions of main.s
+	if res.Symbols["main"] != 0 || res.Symbols["f"] != 0x2C {
+		t.Fatalf("Symbols = %v, want main at 0x0 and f at 0x2C", res.Symbols)
+	}
+	if res.Entry != 0 {
+		t.Errorf("Entry = 0x%X, want 0x0", res.Entry)
+	}
+
+	tests := []struct {
+		name string
+		addr uint64
+		word uint32
+	}{
+		{"B", 0x00, 0x1400000A},
+		{"BL", 0x04, 0x94000009},
+		{"CBZ", 0x08, 0xB4000101},
+		{"B.NE", 0x0C, 0x540000E1},
+		{"MOVZ", 0x10, 0xD2800583},
+		{"MOVI bits 0-15", 0x14, 0xD2800582},
+		{"MOVI bits 16-31", 0x18, 0xF2A00002},
+		{"MOVI bits 32-47", 0x1C, 0xF2C00002},
+		{"MOVI bits 48-63", 0x20, 0xF2E00002},
+		{"Local label in main.s", 0x24, 0xD2800504},
+		{"Local label in f.s", 0x2C, 0xD2800605},
+		{".word", 0x34, 0x2C},
+		{".dword top", 0x38, 0},
+		{".dword bottom", 0x3C, 0x2C},
+	}
+	for _, tc := range tests {
+		if word := wordAt(res.Image, tc.addr); word != tc.word {
+			t.Errorf("%s: word at 0x%X = 0x%08X, want 0x%08X", tc.name, tc.addr, word, tc.word)
+		}
+	}
+}
+
+func TestLinkLibrary(t *testing.T) {
+	unused := assembleObject(t, "unused.s", ".global g\ng:\n\tHLT\n")
+	lib := NewLibrary("lib", unused, assembleObject(t, "f.s", funcSource))
+
+	res, err := Link([]*assembler.Object{assembleObject(t, "main.s", "\tBL f\n\tHLT\n")}, []*Library{lib}, Options{})
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	// Only the object that defines f is brought in
+	if _, exists := res.Symbols["g"]; exists {
+		t.Errorf("g was linked in, but nothing uses it")
+	}
+	if res.Symbols["f"] != 0x8 {
+		t.Errorf("f = 0x%X, want 0x8", res.Symbols["f"])
+	}
+	if word := wordAt(res.Image, 0); word != 0x94000001 {
+		t.Errorf("BL = 0x%08X, want 0x94000001", word)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		opts    Options
+		code    string
+	}{
+		{"Undefined symbol", []string{"\tB missing\n"}, Options{}, assembler.CodeUndefinedSymbol},
+		{"Local symbols are not shared", []string{"\tB f\n", "f:\n\tHLT\n"}, Options{}, assembler.CodeUndefinedSymbol},
+		{"Duplicate global", []string{".global f\nf:\n\tHLT\n", ".global f\nf:\n\tHLT\n"}, Options{}, assembler.CodeDuplicateSymbol},
+		{"Undefined entry point", []string{"\tHLT\n"}, Options{Entry: "main"}, assembler.CodeUndefinedSymbol},
+		{"Too large", []string{"\t.space 16\n"}, Options{MaxSize: 8}, assembler.CodeProgramSize},
+		{"Address does not fit in .word", []string{"\t.word f + 0x100000000\n", ".global f\nf:\n\tHLT\n"}, Options{}, assembler.CodeRelocation},
+		{"Negative address does not fit in .word", []string{"\t.word f - 0x100000000\n", ".global f\nf:\n\tHLT\n"}, Options{}, assembler.CodeRelocation},
+		{"Address does not fit in MOVZ", []string{"\tMOVZ X1, #f, LSL 0\n", ".global f\n.org 0x10000\nf:\n\tHLT\n"}, Options{}, assembler.CodeRelocation},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			objects := make([]*assembler.Object, len(tc.sources))
+			for i, src := range tc.sources {
+				objects[i] = assembleObject(t, "obj.s", src)
+			}
+			res, err := Link(objects, nil, tc.opts)
+			if err == nil {
+				t.Fatalf("Link succeeded, want a %s error", tc.code)
+			}
+			if len(res.Diagnostics) == 0 || res.Diagnostics[0].Code != tc.code {
+				t.Errorf("Diagnostics = %v, want a %s error", res.Diagnostics, tc.code)
+			}
+		})
+	}
+}
+
+// Gets the entry of a symbol in the symbol table of an object
+func symbol(obj *assembler.Object, name string) *assembler.ObjectSymbol {
+	for i := range obj.Symbols {
+		if obj.Symbols[i].Name == name {
+			return &obj.Symbols[i]
+		}
+	}
+	return nil
+}
+
+func TestReadBadObjects(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(obj *assembler.Object)
+	}{
+		{"Relocation past the end", func(obj *assembler.Object) { obj.Relocations[0].Offset = 0x1000 }},
+		{"Relocation across the end", func(obj *assembler.Object) { obj.Relocations[0].Offset = uint64(len(obj.Sections[0].Data)) - 2 }},
+		{"Relocation that wraps around", func(obj *assembler.Object) { obj.Relocations[0].Offset = ^uint64(0) - 1 }},
+		{"Relocation in a missing section", func(obj *assembler.Object) { obj.Relocations[0].Section = ".bss" }},
+		{"Unknown relocation type", func(obj *assembler.Object) { obj.Relocations[0].Type = 99 }},
+		{"Symbol past the end", func(obj *assembler.Object) { symbol(obj, "main").Value = 0x1000 }},
+		{"Symbol in a missing section", func(obj *assembler.Object) { symbol(obj, "main").Section = ".bss" }},
+		{"Repeated section", func(obj *assembler.Object) { obj.Sections = append(obj.Sections, obj.Sections[0]) }},
+		{"Bad alignment", func(obj *assembler.Object) { obj.Sections[0].Align = 3 }},
+		{"Huge alignment", func(obj *assembler.Object) { obj.Sections[0].Align = 1 << 62 }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := assembleObject(t, "main.s", mainSource)
+			tc.change(obj)
+
+			dir := t.TempDir()
+			objPath, libPath := filepath.Join(dir, "main.o"), filepath.Join(dir, "lib.a")
+			if err := obj.WriteFile(objPath); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewLibrary("lib", obj).WriteFile(libPath); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := assembler.ReadObjectFile(objPath); err == nil {
+				t.Errorf("ReadObjectFile accepted the object")
+			}
+			if _, err := ReadLibraryFile(libPath); err == nil {
+				t.Errorf("ReadLibraryFile accepted the object")
+			}
+		})
+	}
+}
+
+func TestReadObjectRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.o")
+	if err := assembleObject(t, "main.s", mainSource).WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := assembler.ReadObjectFile(path)
+	if err != nil {
+		t.Fatalf("ReadObjectFile failed: %v", err)
+	}
+	res, err := Link([]*assembler.Object{obj, assembleObject(t, "f.s", funcSource)}, nil, Options{})
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if word := wordAt(res.Image, 0); word != 0x1400000A {
+		t.Errorf("B = 0x%08X, want 0x1400000A", word)
+	}
+}
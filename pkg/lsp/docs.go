@@ -0,0 +1,204 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
+)
+
+// Struct for the documentation of an instruction or pseudo-instruction
+type instructionDoc struct {
+	syntax      string   // How the instruction is written
+	description string   // What the instruction does
+	operands    []string // The description of each operand
+	format      string   // The encoding format, or "" for pseudo-instructions
+	opcode      uint32   // The bits of the opcode field
+}
+
+// The fields of each instruction format from the most significant bit down
+var formatLayouts = map[string]string{
+	"R":  "opcode (31-21) | Rm (20-16) | shamt (15-10) | Rn (9-5) | Rd (4-0)",
+	"I":  "opcode (31-22) | imm (21-10) | Rn (9-5) | Rd (4-0)",
+	"D":  "opcode (31-21) | addr (20-12) | op (11-10) | Rn (9-5) | Rt (4-0)",
+	"IM": "opcode (31-23) | hw (22-21) | imm (20-5) | Rd (4-0)",
+	"B":  "opcode (31-26) | addr (25-0)",
+	"CB": "opcode (31-24) | addr (23-5) | Rt (4-0)",
+}
+
+// The descriptions of the operands that many instructions share
+const (
+	opRd      = "Rd: The destination register (X0 - X30)"
+	opRm      = "Rm: The first register for the operation (X0 - X30, XZR)"
+	opRn      = "Rn: The second register for the operation (X0 - X30, XZR)"
+	opRmImm   = "Rm: The register for the operation (X0 - X30, XZR)"
+	opImm12   = "Imm: The 12-bit unsigned immediate value to add (0x000 - 0xFFF)"
+	opLogImm  = "Imm: The 12-bit unsigned immediate value for the operation (0x000 - 0xFFF)"
+	opShamt   = "Amt: The number of bits to shift by (0 - 63)"
+	opMovImm  = "Imm: The 16-bit constant to load to the register (0x0000 - 0xFFFF)"
+	opMovAmt  = "Amt: The amount to left-shift the immediate by (0, 16, 32, 48)"
+	opAddrReg = "Rm: The register to use in determining the address (X0 - X30, XZR)"
+	opAddr9   = "Addr: The 9-bit signed 2's complement value to add to the value in Rm to determine the memory location (-256 to 255)"
+	opCbAddr  = "Addr: The 19-bit signed 2's complement relative address to branch to in instructions (-262144 to 262143) or a label"
+	opRdData  = "Rd: The register to load to or store from (X0 - X30, or W0 - W30 for the lower 32 bits)"
+)
+
+// The documentation of every instruction and pseudo-instruction by mnemonic
+var instructionDocs = map[string]instructionDoc{
+	"ADD":    {"ADD Rd, Rm, Rn", "Adds the contents of 2 registers and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x458},
+	"ADDS":   {"ADDS Rd, Rm, Rn", "Adds the contents of 2 registers and saves the output in another register. The ALU flags ***ARE*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x558},
+	"SUB":    {"SUB Rd, Rm, Rn", "Subtracts the contents of 2 registers and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x658},
+	"SUBS":   {"SUBS Rd, Rm, Rn", "Subtracts the contents of 2 registers and saves the output in another register. The ALU flags ***ARE*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x758},
+	"MUL":    {"MUL Rd, Rm, Rn", "Multiplies the contents of 2 registers and saves the bottom 64 bits of the product in another register. It takes 1 cycle for each bit of Rn up to its highest 1. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x4D8},
+	"SMULH":  {"SMULH Rd, Rm, Rn", "Multiplies the contents of 2 registers as signed numbers and saves the top 64 bits of the 128-bit product in another register. It takes 1 cycle for each bit of Rn up to its highest 1. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x4DA},
+	"UMULH":  {"UMULH Rd, Rm, Rn", "Multiplies the contents of 2 registers as unsigned numbers and saves the top 64 bits of the 128-bit product in another register. It takes 1 cycle for each bit of Rn up to its highest 1. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x4DE},
+	"SDIV":   {"SDIV Rd, Rm, Rn", "Divides the contents of a register by another as signed numbers, rounding toward 0, and saves the quotient in another register. Dividing by 0 gives 0. It takes 64 cycles. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, "Rm: The register to divide (X0 - X30, XZR)", "Rn: The register to divide by (X0 - X30, XZR)"}, "R", 0x4D6},
+	"UDIV":   {"UDIV Rd, Rm, Rn", "Divides the contents of a register by another as unsigned numbers and saves the quotient in another register. Dividing by 0 gives 0. It takes 64 cycles. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, "Rm: The register to divide (X0 - X30, XZR)", "Rn: The register to divide by (X0 - X30, XZR)"}, "R", 0x4D6},
+	"ADDI":   {"ADDI Rd, Rm, Imm", "Adds a constant to the contents of a register and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRmImm, opImm12}, "I", 0x244},
+	"ADDIS":  {"ADDIS Rd, Rm, Imm", "Adds a constant to the contents of a register and saves the output in another register. The ALU flags ***ARE*** set from this instruction.", []string{opRd, opRmImm, opImm12}, "I", 0x2C4},
+	"SUBI":   {"SUBI Rd, Rm, Imm", "Subtracts a constant from the contents of a register and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRmImm, opImm12}, "I", 0x344},
+	"SUBIS":  {"SUBIS Rd, Rm, Imm", "Subtracts a constant from the contents of a register and saves the output in another register. The ALU flags ***ARE*** set from this instruction.", []string{opRd, opRmImm, opImm12}, "I", 0x3C4},
+	"AND":    {"AND Rd, Rm, Rn", "Performs a bitwise AND on the contents of 2 registers and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x450},
+	"ANDS":   {"ANDS Rd, Rm, Rn", "Performs a bitwise AND on the contents of 2 registers and saves the output in another register. The N and Z flags ***ARE*** set from this instruction, and C and V are cleared.", []string{opRd, opRm, opRn}, "R", 0x750},
+	"ORR":    {"ORR Rd, Rm, Rn", "Performs a bitwise OR on the contents of 2 registers and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x550},
+	"EOR":    {"EOR Rd, Rm, Rn", "Performs a bitwise exclusive OR on the contents of 2 registers and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRm, opRn}, "R", 0x650},
+	"ANDI":   {"ANDI Rd, Rm, Imm", "Performs a bitwise AND on the contents of a register and a constant and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRmImm, opLogImm}, "I", 0x248},
+	"ANDIS":  {"ANDIS Rd, Rm, Imm", "Performs a bitwise AND on the contents of a register and a constant and saves the output in another register. The N and Z flags ***ARE*** set from this instruction, and C and V are cleared.", []string{opRd, opRmImm, opLogImm}, "I", 0x3C8},
+	"ORRI":   {"ORRI Rd, Rm, Imm", "Performs a bitwise OR on the contents of a register and a constant and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRmImm, opLogImm}, "I", 0x2C8},
+	"EORI":   {"EORI Rd, Rm, Imm", "Performs a bitwise exclusive OR on the contents of a register and a constant and saves the output in another register. The ALU flags are ***NOT*** set from this instruction.", []string{opRd, opRmImm, opLogImm}, "I", 0x348},
+	"LSL":    {"LSL Rd, Rm, Amt", "Shifts the contents of a register left by a constant number of bits, filling in 0s, and saves the output in another register. The ALU flags are ***NOT*** changed by this instruction.", []string{opRd, opRmImm, opShamt}, "R", 0x69B},
+	"LSR":    {"LSR Rd, Rm, Amt", "Shifts the contents of a register right by a constant number of bits, filling in 0s, and saves the output in another register. The ALU flags are ***NOT*** changed by this instruction.", []string{opRd, opRmImm, opShamt}, "R", 0x69A},
+	"MOVZ":   {"MOVZ Rd, Imm, LSL Amt", "Loads a constant into a register ***WITHOUT*** retaining the previous contents of the register.", []string{opRd, opMovImm, opMovAmt}, "IM", 0x1A5},
+	"MOVK":   {"MOVK Rd, Imm, LSL Amt", "Loads a constant into a register ***AND*** retains the unaffected contents of the register.", []string{opRd, opMovImm, opMovAmt}, "IM", 0x1E5},
+	"LDUR":   {"LDUR Rd, Rm, Addr", "Loads a doubleword from memory into a register.", []string{opRd, opAddrReg, opAddr9}, "D", 0x7C2},
+	"LDURB":  {"LDURB Rd, Rm, Addr", "Loads a byte from memory into a register.", []string{opRdData, opAddrReg, opAddr9}, "D", 0x1C2},
+	"LDURH":  {"LDURH Rd, Rm, Addr", "Loads a halfword from memory into a register.", []string{opRdData, opAddrReg, opAddr9}, "D", 0x3C2},
+	"LDURSW": {"LDURSW Rd, Rm, Addr", "Loads a signed word from memory into a register.", []string{opRd, opAddrReg, opAddr9}, "D", 0x5C4},
+	"STUR":   {"STUR Rd, Rm, Addr", "Stores the contents of a register into memory.", []string{"Rd: The register whose contents should be stored (X0 - X30)", opAddrReg, opAddr9}, "D", 0x7C0},
+	"STURB":  {"STURB Rd, Rm, Addr", "Stores a byte from a register into memory.", []string{opRdData, opAddrReg, opAddr9}, "D", 0x1C0},
+	"STURH":  {"STURH Rd, Rm, Addr", "Stores a halfword from a register into memory.", []string{opRdData, opAddrReg, opAddr9}, "D", 0x3C0},
+	"STURW":  {"STURW Rd, Rm, Addr", "Stores a word from a register into memory.", []string{opRdData, opAddrReg, opAddr9}, "D", 0x5C0},
+	"B":      {"B Addr", "Branches to a new location in the program.", []string{"Addr: The 26-bit signed 2's complement relative address to branch to in instructions (-33554432 to 33554431) or a label"}, "B", 0x05},
+	"BL":     {"BL Addr", "Saves the address of the next instruction in LR (X30) and branches to a new location in the program. Use `RET` to return to the next instruction.", []string{"Addr: The 26-bit signed 2's complement relative address to branch to in instructions (-33554432 to 33554431) or a label"}, "B", 0x25},
+	"BR":     {"BR Rn", "Branches to the address in a register.", []string{"Rn: The register with the address to branch to (X0 - X30, XZR)"}, "R", 0x6B0},
+	"CBZ":    {"CBZ Rm, Addr", "Branches to a new location in the program if the given register ***IS*** equal to 0.", []string{"Rm: The register whose value should be tested", opCbAddr}, "CB", 0xB4},
+	"CBNZ":   {"CBNZ Rm, Addr", "Branches to a new location in the program if the given register is ***NOT*** equal to 0.", []string{"Rm: The register whose value should be tested", opCbAddr}, "CB", 0xB5},
+	"B.EQ":   {"B.EQ Addr", "Branches to a new location in the program if the flags show equal (Z is set).", []string{opCbAddr}, "CB", 0x54},
+	"B.NE":   {"B.NE Addr", "Branches to a new location in the program if the flags show not equal (Z is clear).", []string{opCbAddr}, "CB", 0x54},
+	"B.HS":   {"B.HS Addr", "Branches to a new location in the program if the flags show unsigned higher or same (C is set).", []string{opCbAddr}, "CB", 0x54},
+	"B.LO":   {"B.LO Addr", "Branches to a new location in the program if the flags show unsigned lower (C is clear).", []string{opCbAddr}, "CB", 0x54},
+	"B.MI":   {"B.MI Addr", "Branches to a new location in the program if the flags show negative (N is set).", []string{opCbAddr}, "CB", 0x54},
+	"B.PL":   {"B.PL Addr", "Branches to a new location in the program if the flags show positive or zero (N is clear).", []string{opCbAddr}, "CB", 0x54},
+	"B.VS":   {"B.VS Addr", "Branches to a new location in the program if the flags show overflow (V is set).", []string{opCbAddr}, "CB", 0x54},
+	"B.VC":   {"B.VC Addr", "Branches to a new location in the program if the flags show no overflow (V is clear).", []string{opCbAddr}, "CB", 0x54},
+	"B.HI":   {"B.HI Addr", "Branches to a new location in the program if the flags show unsigned higher (C is set and Z is clear).", []string{opCbAddr}, "CB", 0x54},
+	"B.LS":   {"B.LS Addr", "Branches to a new location in the program if the flags show unsigned lower or same (C is clear or Z is set).", []string{opCbAddr}, "CB", 0x54},
+	"B.GE":   {"B.GE Addr", "Branches to a new location in the program if the flags show signed greater than or equal (N equals V).", []string{opCbAddr}, "CB", 0x54},
+	"B.LT":   {"B.LT Addr", "Branches to a new location in the program if the flags show signed less than (N does not equal V).", []string{opCbAddr}, "CB", 0x54},
+	"B.GT":   {"B.GT Addr", "Branches to a new location in the program if the flags show signed greater than (Z is clear and N equals V).", []string{opCbAddr}, "CB", 0x54},
+	"B.LE":   {"B.LE Addr", "Branches to a new location in the program if the flags show signed less than or equal (Z is set or N does not equal V).", []string{opCbAddr}, "CB", 0x54},
+	"DATA":   {"DATA Val", "Places a value in memory.", []string{"Val: The 32-bit value to place in memory at the location within the program (equivalent to `.word Val`)"}, "", 0},
+	"HLT":    {"HLT", "Stops the program. It is encoded as a word of all 0s.", nil, "", 0},
+
+	"MOV":  {"MOV Rd, Rm", "Pseudo-instruction replaced with `ADD Rd, Rm, XZR`, or with `MOVI Rd, Imm` when the second operand is an immediate.", nil, "", 0},
+	"MOVI": {"MOVI Rd, Imm", "Pseudo-instruction replaced with `MOVZ Rd, Imm, LSL Amt` followed by a `MOVK` for each other 16-bit piece of the 64-bit constant that is not 0.", nil, "", 0},
+	"CMP":  {"CMP Rm, Rn", "Pseudo-instruction replaced with `SUBS XZR, Rm, Rn`, or with `SUBIS XZR, Rm, Imm` when the second operand is an immediate.", nil, "", 0},
+	"CMPI": {"CMPI Rm, Imm", "Pseudo-instruction replaced with `SUBIS XZR, Rm, Imm`.", nil, "", 0},
+	"NEG":  {"NEG Rd, Rn", "Pseudo-instruction replaced with `SUB Rd, XZR, Rn`.", nil, "", 0},
+	"NOP":  {"NOP", "Pseudo-instruction replaced with `ADD XZR, XZR, XZR`.", nil, "", 0},
+	"TST":  {"TST Rm, Rn", "Pseudo-instruction replaced with `ANDS XZR, Rm, Rn`, or with `ANDIS XZR, Rm, Imm` when the second operand is an immediate. `TST Rm` on its own is replaced with `ANDS XZR, Rm, Rm`.", nil, "", 0},
+	"RET":  {"RET Rn", "Pseudo-instruction replaced with `BR Rn`. `RET` on its own is replaced with `BR LR`, which returns from a subroutine called with `BL`.", nil, "", 0},
+}
+
+// Struct for the documentation of a directive
+type directiveDoc struct {
+	syntax      string // How the directive is written
+	description string // What the directive does
+}
+
+// The documentation of every directive by its lower case name
+var directiveDocs = map[string]directiveDoc{
+	".org":     {".org Addr", "Continues the program at the given address. The address cannot be lower than the current address."},
+	".align":   {".align N", "Pads with 0s until the address is a multiple of 2<sup>N</sup> bytes."},
+	".byte":    {".byte Val, ...", "Places 8-bit values."},
+	".hword":   {".hword Val, ...", "Places 16-bit values."},
+	".word":    {".word Val, ...", "Places 32-bit values."},
+	".dword":   {".dword Val, ...", "Places 64-bit values."},
+	".ascii":   {".ascii \"Str\", ...", "Places the characters of the strings."},
+	".asciz":   {".asciz \"Str\", ...", "Places the characters of the strings, each followed by a null terminator."},
+	".space":   {".space Size, Fill", "Places Size bytes with the value Fill, which is 0 if it is not given."},
+	".equ":     {".equ Name, Val", "Defines a constant that can be used as a value anywhere after it is defined."},
+	".text":    {".text", "Places what follows in the `.text` section. Programs start in this section."},
+	".data":    {".data", "Places what follows in the `.data` section."},
+	".section": {".section Name", "Places what follows in the section with the given name, such as `.rodata`."},
+	".global":  {".global Name, ...", "Lets other objects use the symbols when the program is linked."},
+	".globl":   {".globl Name, ...", "Same as `.global`."},
+	".macro":   {".macro Name Param, ...", "Starts the definition of a macro. Inside the macro, `\\Param` is replaced with the argument given for that parameter."},
+	".endm":    {".endm", "Ends the definition of a macro."},
+	".include": {".include \"File\"", "Assembles the lines of another file as if they were written in place of the directive."},
+	".if":      {".if Expr", "Assembles the lines up to the next `.elseif`, `.else`, or `.endif` only if the constant expression is not 0. The expression can use defines and constants defined before it, but not labels."},
+	".ifdef":   {".ifdef Name", "Assembles the lines up to the next `.elseif`, `.else`, or `.endif` only if Name is a define or was defined before it."},
+	".ifndef":  {".ifndef Name", "Assembles the lines up to the next `.elseif`, `.else`, or `.endif` only if Name is not a define and was not defined before it."},
+	".elseif":  {".elseif Expr", "Assembles the lines up to the next `.elseif`, `.else`, or `.endif` only if no branch before it was assembled and the constant expression is not 0."},
+	".else":    {".else", "Assembles the lines up to the `.endif` only if no branch before it was assembled."},
+	".endif":   {".endif", "Ends a conditional block."},
+}
+
+// What the registers with an alias are used for by convention
+var specialRegisters = map[uint32]string{
+	16: "the first intra-procedure-call scratch register",
+	17: "the second intra-procedure-call scratch register",
+	28: "the stack pointer",
+	29: "the frame pointer",
+	30: "the link register",
+}
+
+// Gets the documentation of an instruction as Markdown in the style of the README
+func (doc instructionDoc) markdown(mnemonic string) string {
+	var str strings.Builder
+	str.WriteString(fmt.Sprintf("**%s** - %s\n```\n%s\n```\n", mnemonic, doc.description, doc.syntax))
+	for i, op := range doc.operands {
+		if i > 0 {
+			str.WriteString(" <br />\n")
+		}
+		str.WriteString(fmt.Sprintf("*%s*", op))
+	}
+	if doc.format != "" {
+		str.WriteString(fmt.Sprintf("\n\n%s format, opcode `0x%X`: `%s`", doc.format, doc.opcode, formatLayouts[doc.format]))
+	}
+	return strings.TrimRight(str.String(), "\n")
+}
+
+// Gets the documentation of a directive as Markdown
+func (doc directiveDoc) markdown() string {
+	return fmt.Sprintf("```\n%s\n```\n%s", doc.syntax, doc.description)
+}
+
+// Gets the documentation of a register as Markdown, or "" if the name is not a register
+func registerDoc(name string) string {
+	name = strings.ToUpper(name)
+	if reg, exists := disassembler.AliasRegister(name); exists {
+		return fmt.Sprintf("**%s** - Another name for X%d, used as %s, %s.", name, reg, name, specialRegisters[reg])
+	}
+	switch name {
+	case "XZR":
+		return "**XZR** - The zero register, which always reads as 0. Values written to it are thrown away."
+	case "WZR":
+		return "**WZR** - The 32-bit view of the zero register, which can be used when loading or storing a byte, halfword, or word."
+	}
+	if len(name) < 2 || (name[0] != 'X' && name[0] != 'W') {
+		return ""
+	}
+	reg, err := strconv.Atoi(name[1:])
+	if err != nil || reg < 0 || reg > 30 || name[1:] != strconv.Itoa(reg) {
+		return ""
+	}
+	if name[0] == 'W' {
+		return fmt.Sprintf("**W%d** - The lower 32 bits of X%d, which can be used when loading or storing a byte, halfword, or word.", reg, reg)
+	}
+	if alias, exists := disassembler.RegisterAliases[uint32(reg)]; exists {
+		return fmt.Sprintf("**X%d** - General purpose register %d, used as %s, %s.", reg, reg, alias, specialRegisters[uint32(reg)])
+	}
+	return fmt.Sprintf("**X%d** - General purpose register %d.", reg, reg)
+}
@@ -0,0 +1,376 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joshuaseligman/GoVM/pkg/assembler"
+	"github.com/joshuaseligman/GoVM/pkg/disassembler"
+)
+
+// The most bytes of data shown for a single line when hovering
+const maxHoverData = 8
+
+// Struct for an open .goas file and what the assembler found in it
+type document struct {
+	uri         string            // The URI the client uses for the document
+	path        string            // The file path of the document, which is also the file name given to the assembler
+	lines       []string          // The lines of the text
+	relocatable bool              // If the document was assembled into an object because it is meant to be linked
+	result      *assembler.Result // The result of assembling the text
+}
+
+// Function that creates a document and assembles its text
+func newDocument(uri string, text string) *document {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	doc := &document{uri: uri, path: uriToPath(uri), lines: strings.Split(text, "\n")}
+	doc.relocatable = usesLinker(doc.lines)
+
+	// Included files can only be found for documents that are saved on disk
+	opts := assembler.Options{
+		FileName:    doc.path,
+		Listing:     true,
+		Relocatable: doc.relocatable,
+		NoIncludes:  !strings.HasPrefix(uri, "file:"),
+	}
+	doc.result, _ = assembler.Assemble(strings.NewReader(text), opts)
+	return doc
+}
+
+// Gets the file path of a file URI, or the URI itself for documents that are not files
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// Gets the URI of a file path
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// Determines if a program uses directives that only work in objects for the linker, which means names it does not define come from other objects
+func usesLinker(lines []string) bool {
+	for _, line := range lines {
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' }) {
+			if strings.HasPrefix(field, ";") || strings.HasPrefix(field, "//") {
+				break
+			}
+			switch strings.ToLower(field) {
+			case ".global", ".globl", ".data", ".section":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Determines if a character can be part of a mnemonic, directive, register, or symbol
+func isWordChar(char byte) bool {
+	return char == '_' || char == '.' || char >= '0' && char <= '9' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+// Gets the word at or right before the position and its range
+func (doc *document) wordAt(pos Position) (string, Range) {
+	if pos.Line < 0 || pos.Line >= len(doc.lines) || pos.Character < 0 {
+		return "", Range{}
+	}
+	text := doc.lines[pos.Line]
+	start := pos.Character
+	if start > len(text) {
+		start = len(text)
+	}
+	// The cursor can be right after the end of the word
+	if (start == len(text) || !isWordChar(text[start])) && start > 0 && isWordChar(text[start-1]) {
+		start--
+	}
+	if start >= len(text) || !isWordChar(text[start]) {
+		return "", Range{}
+	}
+	end := start
+	for start > 0 && isWordChar(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordChar(text[end]) {
+		end++
+	}
+	return text[start:end], Range{Start: Position{pos.Line, start}, End: Position{pos.Line, end}}
+}
+
+// Gets the range of the token that starts at the column, or of the whole line if the column is negative
+func (doc *document) tokenRange(line int, column int) Range {
+	if len(doc.lines) == 0 || line < 0 {
+		return Range{}
+	}
+	if line >= len(doc.lines) {
+		line = len(doc.lines) - 1
+	}
+	text := doc.lines[line]
+	if column < 0 || column >= len(text) {
+		start := len(text) - len(strings.TrimLeft(text, " \t"))
+		return Range{Start: Position{line, start}, End: Position{line, len(strings.TrimRight(text, " \t"))}}
+	}
+	end := column
+	for end < len(text) && !strings.ContainsRune(" \t,", rune(text[end])) {
+		end++
+	}
+	if end == column {
+		end++
+	}
+	return Range{Start: Position{line, column}, End: Position{line, end}}
+}
+
+// Gets the errors and warnings of the document for the editor
+func (doc *document) diagnostics() []Diagnostic {
+	diags := make([]Diagnostic, 0, len(doc.result.Diagnostics))
+	for _, diag := range doc.result.Diagnostics {
+		msg := diag.Message
+		if diag.Suggestion != "" {
+			msg += "\nSuggestion: " + diag.Suggestion
+		}
+
+		// Problems in included files are shown on the first line since they are not in this document
+		line, column := diag.Line-1, diag.Column-1
+		if diag.File != doc.path {
+			msg = fmt.Sprintf("%s:%d: %s", diag.File, diag.Line, msg)
+			line, column = 0, -1
+		}
+
+		severity := severityError
+		if diag.Severity == assembler.SeverityWarning {
+			severity = severityWarning
+		}
+		diags = append(diags, Diagnostic{
+			Range:    doc.tokenRange(line, column),
+			Severity: severity,
+			Code:     diag.Code,
+			Source:   "govm",
+			Message:  msg,
+		})
+	}
+	return diags
+}
+
+// Gets the documentation of the mnemonic, directive, register, or symbol under the cursor
+func (doc *document) hover(pos Position) *Hover {
+	word, wordRange := doc.wordAt(pos)
+	if word == "" {
+		return nil
+	}
+
+	var text string
+	upper := strings.ToUpper(word)
+	if _, sym, exists := doc.lookupSymbol(word, wordRange); exists {
+		text = doc.symbolMarkdown(word, sym)
+	} else if instr, exists := instructionDocs[upper]; exists {
+		text = instr.markdown(upper)
+		if encoding := doc.encoding(pos.Line); encoding != "" {
+			text += "\n\n" + encoding
+		}
+	} else if dir, exists := directiveDocs[strings.ToLower(word)]; exists {
+		text = dir.markdown()
+		if encoding := doc.encoding(pos.Line); encoding != "" {
+			text += "\n\n" + encoding
+		}
+	} else if reg := registerDoc(word); reg != "" {
+		text = reg
+	} else {
+		return nil
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &wordRange}
+}
+
+// Gets the description of a symbol as Markdown
+func (doc *document) symbolMarkdown(name string, sym assembler.Symbol) string {
+	if !sym.IsLabel {
+		return fmt.Sprintf("**%s** - Constant equal to `%d` (`0x%X`), defined at %s:%d", name, int64(sym.Value), sym.Value, filepath.Base(sym.File), sym.Line)
+	}
+	// Labels in objects are relative to their section until the program is linked
+	if doc.relocatable {
+		return fmt.Sprintf("**%s** - Label at offset `0x%X` in `%s`, defined at %s:%d", name, sym.Value, sym.Section, filepath.Base(sym.File), sym.Line)
+	}
+	return fmt.Sprintf("**%s** - Label at address `0x%X`, defined at %s:%d", name, sym.Value, filepath.Base(sym.File), sym.Line)
+}
+
+// Finds the symbol the word at a range refers to, returning the name it is written with where it is defined.
+// Numeric labels such as 1b and scoped labels such as .Lloop are found from the references the assembler resolved.
+func (doc *document) lookupSymbol(word string, wordRange Range) (string, assembler.Symbol, bool) {
+	if word == "" {
+		return word, assembler.Symbol{}, false
+	}
+	for _, ref := range doc.result.References {
+		if ref.File != doc.path || ref.Line != wordRange.Start.Line+1 || ref.Column != wordRange.Start.Character+1 || ref.Name != word {
+			continue
+		}
+		sym, exists := doc.result.Symbols[ref.Symbol]
+		return doc.definedName(ref.Symbol, sym, word), sym, exists
+	}
+	sym, exists := doc.result.Symbols[word]
+	return word, sym, exists
+}
+
+// Gets the name a local label is written with where it is defined, or name if the definition is not a known reference
+func (doc *document) definedName(symbol string, sym assembler.Symbol, name string) string {
+	for _, ref := range doc.result.References {
+		if ref.Symbol == symbol && ref.File == sym.File && ref.Line == sym.Line {
+			return ref.Name
+		}
+	}
+	return name
+}
+
+// Gets the addresses, data, and instruction fields that a line was assembled into, or "" if the line places nothing or the program has errors
+func (doc *document) encoding(line int) string {
+	if doc.result.Listing == nil {
+		return ""
+	}
+	var str strings.Builder
+	for _, listingLine := range doc.result.Listing.Lines {
+		if listingLine.File != doc.path || listingLine.Line != line+1 || listingLine.Macro != "" || len(listingLine.Data) == 0 {
+			continue
+		}
+		data := fmt.Sprintf("%X", listingLine.Data)
+		if len(listingLine.Data) > maxHoverData {
+			data = fmt.Sprintf("%X...", listingLine.Data[:maxHoverData])
+		}
+		str.WriteString(fmt.Sprintf("%08X  %-16s", listingLine.Addr, data))
+		if listingLine.Expanded {
+			str.WriteString("  " + listingLine.Source)
+		}
+		if listingLine.Fields != "" {
+			str.WriteString("  " + listingLine.Fields)
+		}
+		str.WriteString("\n")
+	}
+	if str.Len() == 0 {
+		return ""
+	}
+	return "```\n" + str.String() + "```"
+}
+
+// Gets the location where the symbol under the cursor is defined
+func (doc *document) definition(pos Position) *Location {
+	word, wordRange := doc.wordAt(pos)
+	name, sym, exists := doc.lookupSymbol(word, wordRange)
+	if !exists || sym.Line < 1 {
+		return nil
+	}
+	word = name
+
+	uri, lines := doc.uri, doc.lines
+	if sym.File != doc.path {
+		uri = pathToURI(sym.File)
+		data, err := os.ReadFile(sym.File)
+		if err != nil {
+			return &Location{URI: uri, Range: Range{Start: Position{sym.Line - 1, 0}, End: Position{sym.Line - 1, 0}}}
+		}
+		lines = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	}
+
+	// Point at the name on the line that defines it
+	start := 0
+	if sym.Line <= len(lines) {
+		if index := strings.Index(lines[sym.Line-1], word); index >= 0 {
+			start = index
+		}
+	}
+	return &Location{URI: uri, Range: Range{Start: Position{sym.Line - 1, start}, End: Position{sym.Line - 1, start + len(word)}}}
+}
+
+// Gets the mnemonics, directives, registers, and symbols that can be written at the cursor
+func (doc *document) completion(pos Position) []CompletionItem {
+	items := make([]CompletionItem, 0)
+
+	mnemonics := make([]string, 0, len(instructionDocs))
+	for mnemonic := range instructionDocs {
+		mnemonics = append(mnemonics, mnemonic)
+	}
+	sort.Strings(mnemonics)
+	for _, mnemonic := range mnemonics {
+		instr := instructionDocs[mnemonic]
+		items = append(items, CompletionItem{Label: mnemonic, Kind: completionKeyword, Detail: instr.syntax, Documentation: &MarkupContent{Kind: "markdown", Value: instr.markdown(mnemonic)}})
+	}
+
+	directives := make([]string, 0, len(directiveDocs))
+	for name := range directiveDocs {
+		directives = append(directives, name)
+	}
+	sort.Strings(directives)
+	for _, name := range directives {
+		dir := directiveDocs[name]
+		items = append(items, CompletionItem{Label: name, Kind: completionKeyword, Detail: dir.syntax, Documentation: &MarkupContent{Kind: "markdown", Value: dir.description}})
+	}
+
+	for reg := 0; reg <= 30; reg++ {
+		name := fmt.Sprintf("X%d", reg)
+		items = append(items, CompletionItem{Label: name, Kind: completionVariable, Documentation: &MarkupContent{Kind: "markdown", Value: registerDoc(name)}})
+	}
+	for _, name := range append([]string{"XZR"}, disassembler.AliasNames()...) {
+		items = append(items, CompletionItem{Label: name, Kind: completionVariable, Documentation: &MarkupContent{Kind: "markdown", Value: registerDoc(name)}})
+	}
+
+	for _, name := range doc.symbolNames() {
+		sym := doc.result.Symbols[name]
+		kind := completionConstant
+		if sym.IsLabel {
+			kind = completionFunction
+		}
+		items = append(items, CompletionItem{Label: name, Kind: kind, Detail: fmt.Sprintf("0x%X", sym.Value)})
+	}
+	return items
+}
+
+// Gets the labels and constants defined in the document
+func (doc *document) symbols() []DocumentSymbol {
+	symbols := make([]DocumentSymbol, 0)
+	for _, name := range doc.symbolNames() {
+		sym := doc.result.Symbols[name]
+		if sym.File != doc.path || sym.Line < 1 || sym.Line > len(doc.lines) {
+			continue
+		}
+		kind, detail := symbolConstant, fmt.Sprintf("0x%X", sym.Value)
+		if sym.IsLabel {
+			kind = symbolFunction
+			if doc.relocatable {
+				detail = fmt.Sprintf("%s+0x%X", sym.Section, sym.Value)
+			}
+		}
+
+		selection := Range{Start: Position{sym.Line - 1, 0}, End: Position{sym.Line - 1, 0}}
+		if index := strings.Index(doc.lines[sym.Line-1], name); index >= 0 {
+			selection = Range{Start: Position{sym.Line - 1, index}, End: Position{sym.Line - 1, index + len(name)}}
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           name,
+			Detail:         detail,
+			Kind:           kind,
+			Range:          doc.tokenRange(sym.Line-1, -1),
+			SelectionRange: selection,
+		})
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].Range.Start.Line < symbols[j].Range.Start.Line
+	})
+	return symbols
+}
+
+// Gets the names of the symbols in the program in order, leaving out the labels that are local to a macro expansion
+func (doc *document) symbolNames() []string {
+	names := make([]string, 0, len(doc.result.Symbols))
+	for name := range doc.result.Symbols {
+		if !assembler.IsGeneratedName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,43 @@
+package lsp
+
+import "testing"
+
+// A program that uses most of what the server knows about
+const testProgram = `.equ N, 5
+main:
+	MOVZ X1, #N, LSL 0
+1:
+	SUBI X1, X1, #1
+	CBNZ X1, 1b
+	B .Lend
+.Lend:
+	HLT
+`
+
+func TestPositionsOutsideDocument(t *testing.T) {
+	doc := newDocument("untitled:test", testProgram)
+	for _, pos := range []Position{{-1, 0}, {0, -1}, {2, -5}, {100, 0}, {2, 100}} {
+		if hover := doc.hover(pos); hover != nil {
+			t.Errorf("hover(%v) = %+v, want nil", pos, hover)
+		}
+		if loc := doc.definition(pos); loc != nil {
+			t.Errorf("definition(%v) = %+v, want nil", pos, loc)
+		}
+		doc.completion(pos)
+	}
+}
+
+func FuzzDocument(f *testing.F) {
+	f.Add(testProgram, 2, 8)
+	f.Add(".global f\nf: B .Lx\n.Lx: HLT\n.data\n.word f\n", 1, 4)
+	f.Fuzz(func(t *testing.T, text string, line int, character int) {
+		// Nothing the user types or points at should crash the server
+		doc := newDocument("untitled:fuzz", text)
+		doc.diagnostics()
+		pos := Position{Line: line, Character: character}
+		doc.hover(pos)
+		doc.definition(pos)
+		doc.completion(pos)
+		doc.symbols()
+	})
+}
@@ -0,0 +1,196 @@
+package lsp
+
+import "encoding/json"
+
+// The JSON-RPC error codes used by the server
+const (
+	codeParseError     = -32700 // The message is not valid JSON
+	codeMethodNotFound = -32601 // The server does not handle the method
+	codeInvalidParams  = -32602 // The parameters of the request are not valid
+	codeInternalError  = -32603 // The server failed while handling the request
+)
+
+// The kinds of text synchronization a server can ask for
+const syncFull = 1 // The client sends the whole text of the document on every change
+
+// The severities of diagnostics
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// The kinds of completion items used by the server
+const (
+	completionFunction = 3
+	completionVariable = 6
+	completionKeyword  = 14
+	completionConstant = 21
+)
+
+// The kinds of document symbols used by the server
+const (
+	symbolFunction = 12
+	symbolConstant = 14
+)
+
+// Struct for a message from the client, which is a request if it has an ID and a notification otherwise
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Struct for a successful response to a request
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+// Struct for a response to a request that failed
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   responseError   `json:"error"`
+}
+
+// Struct for the reason a request failed
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Struct for a notification sent to the client
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// Struct for a location in a document (0-based)
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Struct for a span of text in a document
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Struct for a span of text in a specific document
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Struct for a problem shown in the editor
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// Struct for the diagnostics of a document
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Struct for the text of a document that was opened
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// Struct for the document a request is about
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// Struct for the parameters of textDocument/didOpen
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+// Struct for a change to the text of a document, which is the whole text since the server asks for full synchronization
+type contentChange struct {
+	Text string `json:"text"`
+}
+
+// Struct for the parameters of textDocument/didChange
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []contentChange        `json:"contentChanges"`
+}
+
+// Struct for the parameters of textDocument/didClose and textDocument/documentSymbol
+type documentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+// Struct for the parameters of requests about a position in a document
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// Struct for text shown to the user as Markdown
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Struct for the result of textDocument/hover
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// Struct for a suggestion given by textDocument/completion
+type CompletionItem struct {
+	Label         string         `json:"label"`
+	Kind          int            `json:"kind"`
+	Detail        string         `json:"detail,omitempty"`
+	Documentation *MarkupContent `json:"documentation,omitempty"`
+}
+
+// Struct for a symbol given by textDocument/documentSymbol
+type DocumentSymbol struct {
+	Name           string `json:"name"`
+	Detail         string `json:"detail,omitempty"`
+	Kind           int    `json:"kind"`
+	Range          Range  `json:"range"`
+	SelectionRange Range  `json:"selectionRange"`
+}
+
+// Struct for the features the server supports
+type serverCapabilities struct {
+	TextDocumentSync       int               `json:"textDocumentSync"`
+	HoverProvider          bool              `json:"hoverProvider"`
+	DefinitionProvider     bool              `json:"definitionProvider"`
+	CompletionProvider     completionOptions `json:"completionProvider"`
+	DocumentSymbolProvider bool              `json:"documentSymbolProvider"`
+}
+
+// Struct for how the server gives completions
+type completionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+// Struct for the name of the server
+type serverInfo struct {
+	Name string `json:"name"`
+}
+
+// Struct for the result of initialize
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+	ServerInfo   serverInfo         `json:"serverInfo"`
+}
@@ -0,0 +1,211 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"runtime/debug"
+	"strconv"
+)
+
+// The largest message body the server reads, which is far more than any program needs
+const maxMessageSize = 1 << 24
+
+// Struct for a language server for .goas files that talks to an editor over a pair of streams
+type Server struct {
+	in        *bufio.Reader        // The stream the messages from the client are read from
+	out       io.Writer            // The stream the messages to the client are written to
+	documents map[string]*document // The open documents by URI
+	shutdown  bool                 // If the client asked the server to shut down
+}
+
+// Function that creates a server that reads from in and writes to out, such as stdin and stdout
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Handles messages from the client until it sends exit or closes the stream
+func (server *Server) Run() error {
+	for {
+		body, err := server.readMessage()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			server.writeError(nil, codeParseError, err.Error())
+			continue
+		}
+		if msg.Method == "exit" {
+			if !server.shutdown {
+				return fmt.Errorf("Client exited without shutting down the server")
+			}
+			return nil
+		}
+		if err := server.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the body of the next message, which comes after headers that give its length
+func (server *Server) readMessage() ([]byte, error) {
+	headers, err := textproto.NewReader(server.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || (err == io.ErrUnexpectedEOF && len(headers) == 0) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("Bad message header: Content-Length is %q", headers.Get("Content-Length"))
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("Bad message header: Content-Length is %d but the limit is %d bytes", length, maxMessageSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(server.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Writes a message to the client
+func (server *Server) writeMessage(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(server.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = server.out.Write(body)
+	return err
+}
+
+// Sends the result of a request
+func (server *Server) writeResult(id json.RawMessage, result any) error {
+	return server.writeMessage(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// Sends the reason a request failed
+func (server *Server) writeError(id json.RawMessage, code int, msg string) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return server.writeMessage(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: msg}})
+}
+
+// Sends a notification
+func (server *Server) notify(method string, params any) error {
+	return server.writeMessage(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Handles a single request or notification
+func (server *Server) handle(msg message) (err error) {
+	// A bug in the analysis of a document is logged and fails the request instead of stopping the server
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Crashed while handling %s: %v\n%s", msg.Method, r, debug.Stack())
+			if msg.ID != nil {
+				err = server.writeError(msg.ID, codeInternalError, fmt.Sprintf("Internal error: %v", r))
+			}
+		}
+	}()
+
+	switch msg.Method {
+	case "initialize":
+		return server.writeResult(msg.ID, initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:       syncFull,
+				HoverProvider:          true,
+				DefinitionProvider:     true,
+				CompletionProvider:     completionOptions{TriggerCharacters: []string{"."}},
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "govm-lsp"},
+		})
+
+	case "shutdown":
+		server.shutdown = true
+		return server.writeResult(msg.ID, nil)
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		doc := newDocument(params.TextDocument.URI, params.TextDocument.Text)
+		server.documents[doc.uri] = doc
+		return server.publishDiagnostics(doc)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if json.Unmarshal(msg.Params, &params) != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// With full synchronization the last change has the whole text
+		doc := newDocument(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		server.documents[doc.uri] = doc
+		return server.publishDiagnostics(doc)
+
+	case "textDocument/didClose":
+		var params documentParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		delete(server.documents, params.TextDocument.URI)
+		return server.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params positionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return server.writeError(msg.ID, codeInvalidParams, err.Error())
+		}
+		doc, exists := server.documents[params.TextDocument.URI]
+		if !exists {
+			return server.writeResult(msg.ID, nil)
+		}
+		switch msg.Method {
+		case "textDocument/hover":
+			return server.writeResult(msg.ID, doc.hover(params.Position))
+		case "textDocument/definition":
+			return server.writeResult(msg.ID, doc.definition(params.Position))
+		default:
+			return server.writeResult(msg.ID, doc.completion(params.Position))
+		}
+
+	case "textDocument/documentSymbol":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return server.writeError(msg.ID, codeInvalidParams, err.Error())
+		}
+		doc, exists := server.documents[params.TextDocument.URI]
+		if !exists {
+			return server.writeResult(msg.ID, []DocumentSymbol{})
+		}
+		return server.writeResult(msg.ID, doc.symbols())
+	}
+
+	// Notifications the server does not use are ignored, but requests always get a response
+	if msg.ID != nil {
+		return server.writeError(msg.ID, codeMethodNotFound, fmt.Sprintf("Method not found: %s", msg.Method))
+	}
+	return nil
+}
+
+// Sends the diagnostics of a document to the client
+func (server *Server) publishDiagnostics(doc *document) error {
+	return server.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: doc.uri, Diagnostics: doc.diagnostics()})
+}
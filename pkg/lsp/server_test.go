@@ -0,0 +1,351 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Gets a message with the header that gives its length
+func frame(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func TestReadMessageBadLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"Negative", "Content-Length: -1\r\n\r\n"},
+		{"Too large", fmt.Sprintf("Content-Length: %d\r\n\r\n", maxMessageSize+1)},
+		{"Not a number", "Content-Length: ten\r\n\r\n"},
+		{"Missing", "Content-Type: text/plain\r\n\r\n{}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(strings.NewReader(tc.input), &bytes.Buffer{})
+			if _, err := server.readMessage(); err == nil || !strings.Contains(err.Error(), "Content-Length") {
+				t.Errorf("err = %v, want a Content-Length error", err)
+			}
+		})
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	server := NewServer(strings.NewReader(frame(`{"a":1}`)+frame(`{}`)), &bytes.Buffer{})
+	for _, want := range []string{`{"a":1}`, `{}`} {
+		body, err := server.readMessage()
+		if err != nil || string(body) != want {
+			t.Errorf("readMessage = %q, %v, want %q", body, err, want)
+		}
+	}
+}
+
+// Struct for a message the server sends, which is a response if it has an ID and a notification otherwise
+type serverMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// Gets the JSON of a request, or of a notification if the id is 0
+func request(id int, method string, params any) string {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != 0 {
+		msg["id"] = id
+	}
+	data, _ := json.Marshal(msg)
+	return string(data)
+}
+
+// Gets the JSON of the notification that opens a document
+func didOpen(uri string, text string) string {
+	return request(0, "textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, LanguageID: "goas", Version: 1, Text: text}})
+}
+
+// Gets the JSON of a request about a position in a document
+func positionRequest(id int, method string, uri string, line int, character int) string {
+	return request(id, method, positionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: Position{line, character}})
+}
+
+// Runs a server on the messages, shutting it down at the end, and gets the messages it sends back
+func runServer(t *testing.T, msgs ...string) []serverMessage {
+	t.Helper()
+	var in strings.Builder
+	for _, msg := range append(msgs, request(999, "shutdown", nil), request(0, "exit", nil)) {
+		in.WriteString(frame(msg))
+	}
+	var out bytes.Buffer
+	if err := NewServer(strings.NewReader(in.String()), &out).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// The responses are framed the same way as the messages from the client
+	reader := NewServer(&out, io.Discard)
+	sent := make([]serverMessage, 0)
+	for {
+		body, err := reader.readMessage()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Bad message from the server: %v", err)
+		}
+		var msg serverMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("Bad message from the server: %v: %s", err, body)
+		}
+		sent = append(sent, msg)
+	}
+
+	// Leave out the response to shutdown
+	if len(sent) == 0 || string(sent[len(sent)-1].ID) != "999" {
+		t.Fatalf("The server did not respond to shutdown: %+v", sent)
+	}
+	return sent[:len(sent)-1]
+}
+
+// Gets the result of the response to a request, decoded into result
+func responseTo(t *testing.T, sent []serverMessage, id int, result any) {
+	t.Helper()
+	for _, msg := range sent {
+		if string(msg.ID) != fmt.Sprint(id) {
+			continue
+		}
+		if msg.Error != nil {
+			t.Fatalf("Request %d failed: %+v", id, msg.Error)
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			t.Fatalf("Bad result for request %d: %v: %s", id, err, msg.Result)
+		}
+		return
+	}
+	t.Fatalf("No response to request %d", id)
+}
+
+// Gets the diagnostics of every publishDiagnostics notification in order
+func publishedDiagnostics(t *testing.T, sent []serverMessage) []publishDiagnosticsParams {
+	t.Helper()
+	published := make([]publishDiagnosticsParams, 0)
+	for _, msg := range sent {
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatalf("Bad diagnostics: %v", err)
+		}
+		published = append(published, params)
+	}
+	return published
+}
+
+func TestInitialize(t *testing.T) {
+	sent := runServer(t, request(1, "initialize", map[string]any{}))
+	var result initializeResult
+	responseTo(t, sent, 1, &result)
+	caps := result.Capabilities
+	if caps.TextDocumentSync != syncFull || !caps.HoverProvider || !caps.DefinitionProvider || !caps.DocumentSymbolProvider {
+		t.Errorf("Capabilities = %+v, want full sync, hover, definition, and document symbols", caps)
+	}
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	const uri = "untitled:test"
+	sent := runServer(t,
+		didOpen(uri, "main:\n\tADD X1, X2\n\tHLT\n"),
+		request(0, "textDocument/didChange", didChangeParams{TextDocument: textDocumentIdentifier{URI: uri}, ContentChanges: []contentChange{{Text: testProgram}}}),
+		request(0, "textDocument/didClose", documentParams{TextDocument: textDocumentIdentifier{URI: uri}}),
+	)
+
+	published := publishedDiagnostics(t, sent)
+	if len(published) != 3 {
+		t.Fatalf("Got %d publishDiagnostics notifications, want 3", len(published))
+	}
+	for _, params := range published {
+		if params.URI != uri {
+			t.Errorf("Diagnostics are for %s, want %s", params.URI, uri)
+		}
+	}
+
+	// The bad instruction is marked from its mnemonic to the end of the token
+	opened := published[0].Diagnostics
+	want := Diagnostic{Range: Range{Start: Position{1, 1}, End: Position{1, 4}}, Severity: severityError, Code: "operand-count", Source: "govm"}
+	if len(opened) != 1 {
+		t.Fatalf("Diagnostics after didOpen = %+v, want 1", opened)
+	}
+	if got := opened[0]; got.Range != want.Range || got.Severity != want.Severity || got.Code != want.Code || got.Source != want.Source {
+		t.Errorf("Diagnostic after didOpen = %+v, want %+v", got, want)
+	}
+	if changed := published[1].Diagnostics; len(changed) != 0 {
+		t.Errorf("Diagnostics after didChange = %+v, want none", changed)
+	}
+	if closed := published[2].Diagnostics; len(closed) != 0 {
+		t.Errorf("Diagnostics after didClose = %+v, want none", closed)
+	}
+}
+
+func TestHover(t *testing.T) {
+	const uri = "untitled:test"
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      string // Text the hover has to contain, or "" for no hover
+	}{
+		{"Mnemonic", 2, 2, "MOVZ"},
+		{"Encoding", 2, 2, "00000000"},
+		{"Constant", 2, 11, "Constant equal to `5`"},
+		{"Label", 6, 4, "Label at address `0x10`"},
+		{"Numeric label", 5, 10, "Label at address `0x4`"},
+		{"Register", 2, 6, "X1"},
+		{"Directive", 0, 2, ".equ"},
+		{"Blank", 3, 5, ""},
+	}
+
+	msgs := []string{didOpen(uri, testProgram)}
+	for i, tc := range tests {
+		msgs = append(msgs, positionRequest(i+1, "textDocument/hover", uri, tc.line, tc.character))
+	}
+	sent := runServer(t, msgs...)
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var hover *Hover
+			responseTo(t, sent, i+1, &hover)
+			if tc.want == "" {
+				if hover != nil {
+					t.Errorf("Hover = %+v, want none", hover)
+				}
+				return
+			}
+			if hover == nil || !strings.Contains(hover.Contents.Value, tc.want) {
+				t.Errorf("Hover = %+v, want it to contain %q", hover, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	const uri = "untitled:test"
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      *Location
+	}{
+		{"Constant", 2, 11, &Location{URI: uri, Range: Range{Start: Position{0, 5}, End: Position{0, 6}}}},
+		{"Numeric label", 5, 10, &Location{URI: uri, Range: Range{Start: Position{3, 0}, End: Position{3, 1}}}},
+		{"Scoped label", 6, 4, &Location{URI: uri, Range: Range{Start: Position{7, 0}, End: Position{7, 5}}}},
+		{"Mnemonic", 2, 2, nil},
+	}
+
+	msgs := []string{didOpen(uri, testProgram)}
+	for i, tc := range tests {
+		msgs = append(msgs, positionRequest(i+1, "textDocument/definition", uri, tc.line, tc.character))
+	}
+	sent := runServer(t, msgs...)
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var loc *Location
+			responseTo(t, sent, i+1, &loc)
+			if !reflect.DeepEqual(loc, tc.want) {
+				t.Errorf("Definition = %+v, want %+v", loc, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefinitionLocalLabels(t *testing.T) {
+	const uri = "untitled:test"
+	const src = "a:\n.Lx:\tB .Lx\nb:\n.Lx:\tB .Lx\n1:\tB 1f\n1:\tB 1b\n\tHLT\n"
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      Range
+	}{
+		{"Scoped label in the first scope", 1, 7, Range{Start: Position{1, 0}, End: Position{1, 3}}},
+		{"Scoped label in the second scope", 3, 7, Range{Start: Position{3, 0}, End: Position{3, 3}}},
+		{"Forward numeric label", 4, 5, Range{Start: Position{5, 0}, End: Position{5, 1}}},
+		{"Backward numeric label on its own line", 5, 5, Range{Start: Position{5, 0}, End: Position{5, 1}}},
+		{"Numeric label definition", 4, 0, Range{Start: Position{4, 0}, End: Position{4, 1}}},
+	}
+
+	msgs := []string{didOpen(uri, src)}
+	for i, tc := range tests {
+		msgs = append(msgs, positionRequest(i+1, "textDocument/definition", uri, tc.line, tc.character))
+	}
+	sent := runServer(t, msgs...)
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var loc *Location
+			responseTo(t, sent, i+1, &loc)
+			if loc == nil || loc.URI != uri || loc.Range != tc.want {
+				t.Errorf("Definition = %+v, want %+v", loc, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	const uri = "untitled:test"
+	sent := runServer(t, didOpen(uri, testProgram), positionRequest(1, "textDocument/completion", uri, 8, 1))
+
+	var items []CompletionItem
+	responseTo(t, sent, 1, &items)
+	kinds := make(map[string]int)
+	for _, item := range items {
+		kinds[item.Label] = item.Kind
+	}
+	for label, kind := range map[string]int{"MOVZ": completionKeyword, ".word": completionKeyword, "X1": completionVariable, "LR": completionVariable, "main": completionFunction, "N": completionConstant} {
+		if got, exists := kinds[label]; !exists || got != kind {
+			t.Errorf("Completion %s has kind %d (found: %t), want %d", label, got, exists, kind)
+		}
+	}
+	// Labels that only exist inside the assembler are not suggested
+	for label := range kinds {
+		if strings.Contains(label, "@") {
+			t.Errorf("Completion %s is an internal name", label)
+		}
+	}
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	const uri = "untitled:test"
+	sent := runServer(t, didOpen(uri, testProgram),
+		request(1, "textDocument/documentSymbol", documentParams{TextDocument: textDocumentIdentifier{URI: uri}}),
+		request(2, "textDocument/documentSymbol", documentParams{TextDocument: textDocumentIdentifier{URI: "untitled:closed"}}),
+	)
+
+	var symbols []DocumentSymbol
+	responseTo(t, sent, 1, &symbols)
+	want := []DocumentSymbol{
+		{Name: "N", Detail: "0x5", Kind: symbolConstant, Range: Range{Start: Position{0, 0}, End: Position{0, 9}}, SelectionRange: Range{Start: Position{0, 5}, End: Position{0, 6}}},
+		{Name: "main", Detail: "0x0", Kind: symbolFunction, Range: Range{Start: Position{1, 0}, End: Position{1, 5}}, SelectionRange: Range{Start: Position{1, 0}, End: Position{1, 4}}},
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("Symbols = %+v, want %+v", symbols, want)
+	}
+
+	var closed []DocumentSymbol
+	responseTo(t, sent, 2, &closed)
+	if len(closed) != 0 {
+		t.Errorf("Symbols of a document that is not open = %+v, want none", closed)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	sent := runServer(t, request(1, "textDocument/rename", map[string]any{}), request(0, "$/cancelRequest", map[string]any{"id": 1}))
+	if len(sent) != 1 || sent[0].Error == nil || sent[0].Error.Code != codeMethodNotFound {
+		t.Errorf("Messages = %+v, want a single method not found error", sent)
+	}
+}
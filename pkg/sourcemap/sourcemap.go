@@ -0,0 +1,43 @@
+package sourcemap
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Struct for the part of the image placed by a single line of the program
+type Entry struct {
+	Addr   uint64 `json:"addr"`   // The address of the first byte placed by the line
+	Size   uint64 `json:"size"`   // The number of bytes placed by the line
+	File   string `json:"file"`   // The file the line is in
+	Line   int    `json:"line"`   // The line in the source
+	Column int    `json:"column"` // The column the instruction or directive starts in
+}
+
+// Gets the location of the line as file:line:column
+func (entry Entry) String() string {
+	return fmt.Sprintf("%s:%d:%d", entry.File, entry.Line, entry.Column)
+}
+
+// The lines that placed each part of the image, in order of address
+type SourceMap []Entry
+
+// Finds the line that placed the data at the given address
+func (sourceMap SourceMap) Lookup(addr uint64) (Entry, bool) {
+	// Find the first entry that ends after the address
+	i := sort.Search(len(sourceMap), func(i int) bool {
+		return sourceMap[i].Addr+sourceMap[i].Size > addr
+	})
+	if i < len(sourceMap) && sourceMap[i].Addr <= addr {
+		return sourceMap[i], true
+	}
+	return Entry{}, false
+}
+
+// Gets the file, line, and column of the instruction or data at the given address, or "" if no line placed it
+func (sourceMap SourceMap) Locate(addr uint64) string {
+	if entry, found := sourceMap.Lookup(addr); found {
+		return entry.String()
+	}
+	return ""
+}